@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/config"
+	"github.com/fekuna/omnipos-customer-service/internal/customer/listener"
+	"github.com/fekuna/omnipos-pkg/logger"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// dlq-replay moves dead-lettered order events back onto their original topic
+// so the listener processes them again. Run it once the underlying failure has
+// been fixed.
+func main() {
+	limit := flag.Int("limit", 0, "maximum number of messages to replay (0 = no limit)")
+	idle := flag.Duration("idle", 10*time.Second, "stop after waiting this long for a message")
+	flag.Parse()
+
+	cfg := config.LoadEnv()
+	log := logger.NewZapLogger(&logger.ZapLoggerConfig{
+		IsDevelopment: true,
+		Encoding:      "console",
+		Level:         "info",
+	})
+	defer log.Sync()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: cfg.Kafka.Brokers,
+		Topic:   cfg.Kafka.DLQTopic,
+		GroupID: cfg.Kafka.GroupID + "-dlq-replay",
+	})
+	defer reader.Close()
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Kafka.Brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}
+	defer writer.Close()
+
+	replayed := 0
+	for *limit == 0 || replayed < *limit {
+		fetchCtx, cancel := context.WithTimeout(ctx, *idle)
+		msg, err := reader.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				log.Info("No more dead-lettered messages")
+				break
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			log.Error("Failed to read dead-letter topic", zap.Error(err))
+			os.Exit(1)
+		}
+
+		topic := cfg.Kafka.Topic
+		var headers []kafka.Header
+		for _, h := range msg.Headers {
+			if h.Key == listener.HeaderDLQOriginalTopic && len(h.Value) > 0 {
+				topic = string(h.Value)
+			}
+			if !listener.IsDeadLetterHeader(h.Key) {
+				headers = append(headers, h)
+			}
+		}
+
+		if err := writer.WriteMessages(ctx, kafka.Message{
+			Topic:   topic,
+			Key:     msg.Key,
+			Value:   msg.Value,
+			Headers: headers,
+		}); err != nil {
+			log.Error("Failed to replay message", zap.Int64("offset", msg.Offset), zap.Error(err))
+			os.Exit(1)
+		}
+		if err := reader.CommitMessages(ctx, msg); err != nil {
+			log.Error("Failed to commit dead-letter offset", zap.Int64("offset", msg.Offset), zap.Error(err))
+			os.Exit(1)
+		}
+		replayed++
+	}
+
+	log.Info("Replay finished", zap.Int("replayed", replayed))
+}
@@ -9,11 +9,17 @@ import (
 	"syscall"
 
 	"github.com/fekuna/omnipos-customer-service/config"
+	"github.com/fekuna/omnipos-customer-service/internal/customer/expirer"
 	"github.com/fekuna/omnipos-customer-service/internal/customer/handler"
 	"github.com/fekuna/omnipos-customer-service/internal/customer/listener"
+	"github.com/fekuna/omnipos-customer-service/internal/customer/purger"
+	"github.com/fekuna/omnipos-customer-service/internal/customer/relay"
 	"github.com/fekuna/omnipos-customer-service/internal/customer/repository"
+	"github.com/fekuna/omnipos-customer-service/internal/customer/segmenter"
+	"github.com/fekuna/omnipos-customer-service/internal/customer/tierer"
 	"github.com/fekuna/omnipos-customer-service/internal/customer/usecase"
-	"github.com/fekuna/omnipos-pkg/broker"
+	"github.com/fekuna/omnipos-customer-service/internal/lifecycle"
+	appmiddleware "github.com/fekuna/omnipos-customer-service/internal/middleware"
 	"github.com/fekuna/omnipos-pkg/database/postgres"
 	"github.com/fekuna/omnipos-pkg/logger"
 	"github.com/fekuna/omnipos-pkg/middleware"
@@ -65,7 +71,6 @@ func main() {
 	if err != nil {
 		log.Fatal("Could not connect to database", zap.Error(err))
 	}
-	defer db.Close()
 
 	if err := db.Ping(); err != nil {
 		log.Fatal("Could not ping database", zap.Error(err))
@@ -77,15 +82,51 @@ func main() {
 	useCase := usecase.NewCustomerUseCase(repo, log)
 	customerHandler := handler.NewCustomerHandler(useCase, log)
 
+	// Background components share one lifecycle so SIGTERM drains them
+	// before the consumer and database are closed.
+	app := lifecycle.NewManager(log, cfg.Server.ShutdownTimeout)
+
 	// 5.1 Initialize Kafka
-	kafkaConsumer := broker.NewConsumer(&broker.Config{
-		Brokers: cfg.Kafka.Brokers,
-		Topic:   cfg.Kafka.Topic,
-		GroupID: cfg.Kafka.GroupID,
-	})
+	kafkaConsumer := listener.NewKafkaConsumer(cfg.Kafka.Brokers, cfg.Kafka.Topic, cfg.Kafka.GroupID)
 	log.Info("Connected to Kafka Consumer", zap.Strings("brokers", cfg.Kafka.Brokers), zap.String("topic", cfg.Kafka.Topic))
-	customerListener := listener.NewCustomerListener(kafkaConsumer, useCase, log)
-	go customerListener.Start(context.Background())
+	deadLetters := listener.NewKafkaDeadLetterPublisher(cfg.Kafka.Brokers, cfg.Kafka.DLQTopic)
+	customerListener := listener.NewCustomerListener(kafkaConsumer, useCase, log, deadLetters, listener.Options{
+		Retry: listener.RetryPolicy{
+			MaxAttempts:    cfg.Kafka.MaxAttempts,
+			InitialBackoff: cfg.Kafka.RetryBackoff,
+			MaxBackoff:     cfg.Kafka.RetryMaxBackoff,
+		},
+		Workers:   cfg.Kafka.Workers,
+		QueueSize: cfg.Kafka.QueueSize,
+	})
+	app.Go("kafka listener", func(ctx context.Context) { customerListener.Start(ctx, app.Drain()) })
+
+	// 5.2 Initialize Purger for soft-deleted customers
+	customerPurger := purger.NewCustomerPurger(useCase, log, cfg.Purge.Retention, cfg.Purge.Interval)
+	app.Go("customer purger", customerPurger.Start)
+
+	// 5.3 Initialize Expirer for loyalty points
+	pointsExpirer := expirer.NewPointsExpirer(useCase, log, cfg.Expiry.Interval, cfg.Expiry.BatchSize)
+	app.Go("points expirer", pointsExpirer.Start)
+
+	// 5.4 Initialize Outbox Relay for customer domain events
+	eventPublisher := relay.NewKafkaPublisher(cfg.Kafka.Brokers, cfg.Kafka.EventsTopic)
+	outboxRelay := relay.NewOutboxRelay(repo, eventPublisher, log, cfg.Outbox.Interval, cfg.Outbox.BatchSize, cfg.Outbox.Retention)
+	app.Go("outbox relay", outboxRelay.Start)
+
+	// 5.5 Initialize Refresher for time-based customer segment rules
+	segmentRefresher := segmenter.NewSegmentRefresher(useCase, log, cfg.Segment.MaxAge, cfg.Segment.Interval, cfg.Segment.BatchSize)
+	app.Go("segment refresher", segmentRefresher.Start)
+
+	// 5.6 Initialize Refresher for loyalty tiers
+	tierRefresher := tierer.NewTierRefresher(useCase, log, cfg.Tier.MaxAge, cfg.Tier.Interval, cfg.Tier.BatchSize)
+	app.Go("tier refresher", tierRefresher.Start)
+
+	// Closers run in order once every component has returned.
+	app.OnShutdown("kafka consumer", func(context.Context) error { return kafkaConsumer.Close() })
+	app.OnShutdown("dead-letter publisher", func(context.Context) error { return deadLetters.Close() })
+	app.OnShutdown("event publisher", func(context.Context) error { return eventPublisher.Close() })
+	app.OnShutdown("database", func(context.Context) error { return db.Close() })
 
 	// 6. Start gRPC Server
 	lis, err := net.Listen("tcp", cfg.Server.GRPCPort)
@@ -94,7 +135,12 @@ func main() {
 	}
 
 	grpcServer := grpc.NewServer(
-		grpc.UnaryInterceptor(middleware.ContextInterceptor()), // Enable i18n/Timezone propagation
+		grpc.ChainUnaryInterceptor(
+			appmiddleware.NewErrorInterceptor(log).Unary(),       // Map domain errors to gRPC status codes
+			appmiddleware.NewAuthContextInterceptor(log).Unary(), // Put the caller's merchant in the context
+			middleware.ContextInterceptor(),                      // Enable i18n/Timezone propagation
+		),
+		grpc.WaitForHandlers(true), // Stop returns only once cancelled handlers are done with the database
 	)
 	customerv1.RegisterCustomerServiceServer(grpcServer, customerHandler)
 
@@ -108,16 +154,31 @@ func main() {
 			log.Fatal("Failed to serve gRPC", zap.Error(err))
 		}
 	}()
+	app.Go("grpc server", func(ctx context.Context) {
+		<-ctx.Done()
+		// In-flight RPCs may finish until the shutdown deadline, after
+		// which they are cancelled.
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-app.Drain().Done():
+			grpcServer.Stop()
+			<-stopped
+		}
+	})
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
 
 	log.Info("Shutting down server...")
-	grpcServer.GracefulStop()
-
-	// Close DB connection (defer handles it, but good to be explicit/log)
-	// db.Close() comes from defer.
+	if err := app.Shutdown(); err != nil {
+		log.Error("Shutdown did not complete cleanly", zap.Error(err))
+	}
 
 	log.Info("Server exited")
 }
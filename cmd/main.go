@@ -10,12 +10,17 @@ import (
 	"syscall"
 
 	"github.com/fekuna/omnipos-customer-service/config"
+	"github.com/fekuna/omnipos-customer-service/internal/customer/expirer"
 	"github.com/fekuna/omnipos-customer-service/internal/customer/handler"
 	"github.com/fekuna/omnipos-customer-service/internal/customer/listener"
+	"github.com/fekuna/omnipos-customer-service/internal/customer/purger"
+	"github.com/fekuna/omnipos-customer-service/internal/customer/relay"
 	"github.com/fekuna/omnipos-customer-service/internal/customer/repository"
+	"github.com/fekuna/omnipos-customer-service/internal/customer/segmenter"
+	"github.com/fekuna/omnipos-customer-service/internal/customer/tierer"
 	"github.com/fekuna/omnipos-customer-service/internal/customer/usecase"
+	"github.com/fekuna/omnipos-customer-service/internal/lifecycle"
 	"github.com/fekuna/omnipos-customer-service/internal/middleware"
-	"github.com/fekuna/omnipos-pkg/broker"
 	"github.com/fekuna/omnipos-pkg/database/postgres"
 	"github.com/fekuna/omnipos-pkg/logger"
 	customerv1 "github.com/fekuna/omnipos-proto/gen/go/omnipos/customer/v1"
@@ -62,7 +67,6 @@ func main() {
 	if err != nil {
 		appLogger.Fatal("Could not connect to database", zap.Error(err))
 	}
-	defer db.Close()
 	appLogger.Info("Connected to PostgreSQL database", zap.String("db_name", cfg.Postgres.DBName))
 
 	// 4. Initialize Components
@@ -72,22 +76,56 @@ func main() {
 
 	// Initialize Middleware
 	authInterceptor := middleware.NewAuthContextInterceptor(appLogger)
+	errorInterceptor := middleware.NewErrorInterceptor(appLogger)
+
+	// Background components share one lifecycle so SIGTERM drains them
+	// before the consumer and database are closed.
+	app := lifecycle.NewManager(appLogger, cfg.Server.ShutdownTimeout)
 
 	// 4.5 Initialize Kafka Listener
-	kafkaConsumer := broker.NewConsumer(&broker.Config{
-		Brokers: cfg.Kafka.Brokers,
-		Topic:   cfg.Kafka.Topic,
-		GroupID: cfg.Kafka.GroupID,
-	})
+	kafkaConsumer := listener.NewKafkaConsumer(cfg.Kafka.Brokers, cfg.Kafka.Topic, cfg.Kafka.GroupID)
 	appLogger.Info("Connected to Kafka Consumer", zap.Strings("brokers", cfg.Kafka.Brokers), zap.String("topic", cfg.Kafka.Topic))
 
-	importCmdContext := context.Background() // Need context for listener? Listener.Start takes context.
-	// But Start() usually blocks?
-	// listener implementation: func (l *CustomerListener) Start(ctx context.Context)
-	// We run it in goroutine.
+	deadLetters := listener.NewKafkaDeadLetterPublisher(cfg.Kafka.Brokers, cfg.Kafka.DLQTopic)
+	listenerOpts := listener.Options{
+		Retry: listener.RetryPolicy{
+			MaxAttempts:    cfg.Kafka.MaxAttempts,
+			InitialBackoff: cfg.Kafka.RetryBackoff,
+			MaxBackoff:     cfg.Kafka.RetryMaxBackoff,
+		},
+		Workers:   cfg.Kafka.Workers,
+		QueueSize: cfg.Kafka.QueueSize,
+	}
+
+	customerListener := listener.NewCustomerListener(kafkaConsumer, uc, appLogger, deadLetters, listenerOpts)
+	app.Go("kafka listener", func(ctx context.Context) { customerListener.Start(ctx, app.Drain()) })
+
+	// 4.6 Initialize Purger for soft-deleted customers
+	customerPurger := purger.NewCustomerPurger(uc, appLogger, cfg.Purge.Retention, cfg.Purge.Interval)
+	app.Go("customer purger", customerPurger.Start)
+
+	// 4.7 Initialize Expirer for loyalty points
+	pointsExpirer := expirer.NewPointsExpirer(uc, appLogger, cfg.Expiry.Interval, cfg.Expiry.BatchSize)
+	app.Go("points expirer", pointsExpirer.Start)
 
-	customerListener := listener.NewCustomerListener(kafkaConsumer, uc, appLogger)
-	go customerListener.Start(importCmdContext)
+	// 4.8 Initialize Outbox Relay for customer domain events
+	eventPublisher := relay.NewKafkaPublisher(cfg.Kafka.Brokers, cfg.Kafka.EventsTopic)
+	outboxRelay := relay.NewOutboxRelay(repo, eventPublisher, appLogger, cfg.Outbox.Interval, cfg.Outbox.BatchSize, cfg.Outbox.Retention)
+	app.Go("outbox relay", outboxRelay.Start)
+
+	// 4.9 Initialize Refresher for time-based customer segment rules
+	segmentRefresher := segmenter.NewSegmentRefresher(uc, appLogger, cfg.Segment.MaxAge, cfg.Segment.Interval, cfg.Segment.BatchSize)
+	app.Go("segment refresher", segmentRefresher.Start)
+
+	// 4.10 Initialize Refresher for loyalty tiers
+	tierRefresher := tierer.NewTierRefresher(uc, appLogger, cfg.Tier.MaxAge, cfg.Tier.Interval, cfg.Tier.BatchSize)
+	app.Go("tier refresher", tierRefresher.Start)
+
+	// Closers run in order once the components above have returned.
+	app.OnShutdown("kafka consumer", func(context.Context) error { return kafkaConsumer.Close() })
+	app.OnShutdown("dead-letter publisher", func(context.Context) error { return deadLetters.Close() })
+	app.OnShutdown("event publisher", func(context.Context) error { return eventPublisher.Close() })
+	app.OnShutdown("database", func(context.Context) error { return db.Close() })
 
 	// 5. Start gRPC Server
 	port := cfg.Server.GRPCPort
@@ -101,7 +139,13 @@ func main() {
 	}
 
 	grpcServer := grpc.NewServer(
-		grpc.UnaryInterceptor(authInterceptor.Unary()),
+		grpc.ChainUnaryInterceptor(
+			errorInterceptor.Unary(),
+			authInterceptor.Unary(),
+		),
+		// Stop returns only once cancelled handlers are done with the
+		// database.
+		grpc.WaitForHandlers(true),
 	)
 
 	// Register Services
@@ -118,12 +162,30 @@ func main() {
 			appLogger.Fatal("failed to serve", zap.Error(err))
 		}
 	}()
+	app.Go("grpc server", func(ctx context.Context) {
+		<-ctx.Done()
+		// In-flight RPCs may finish until the shutdown deadline, after
+		// which they are cancelled.
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-app.Drain().Done():
+			grpcServer.Stop()
+			<-stopped
+		}
+	})
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
 
 	appLogger.Info("Shutting down server...")
-	grpcServer.GracefulStop()
+	if err := app.Shutdown(); err != nil {
+		appLogger.Error("Shutdown did not complete cleanly", zap.Error(err))
+	}
 	appLogger.Info("Server stopped")
 }
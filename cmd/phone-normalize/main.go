@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fekuna/omnipos-customer-service/config"
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/fekuna/omnipos-pkg/database/postgres"
+	"github.com/fekuna/omnipos-pkg/logger"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// phone-normalize fills customers.phone_e164 from the phone as entered, using
+// each merchant's default country, and reports live customers whose numbers
+// normalize to the same E.164 number. With -enforce, and once no such
+// collisions remain, it moves phone uniqueness from the raw phone to
+// phone_e164 without blocking writes, ahead of migration 000019 doing the
+// same under a lock. Run it again after changing a merchant's phone country.
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report changes and collisions without writing")
+	enforce := flag.Bool("enforce", false, "make phone_e164 unique per merchant if there are no collisions")
+	batch := flag.Int("batch", 500, "customers to read per batch")
+	flag.Parse()
+
+	cfg := config.LoadEnv()
+	log := logger.NewZapLogger(&logger.ZapLoggerConfig{
+		IsDevelopment: true,
+		Encoding:      "console",
+		Level:         "info",
+	})
+	defer log.Sync()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db, err := postgres.NewPostgres(&postgres.Config{
+		Host:            cfg.Postgres.Host,
+		Port:            cfg.Postgres.Port,
+		User:            cfg.Postgres.User,
+		Password:        cfg.Postgres.Password,
+		DBName:          cfg.Postgres.DBName,
+		SSLMode:         cfg.Postgres.SSLMode,
+		MaxOpenConns:    cfg.Postgres.MaxOpenConns,
+		MaxIdleConns:    cfg.Postgres.MaxIdleConns,
+		ConnMaxLifetime: cfg.Postgres.ConnMaxLifetime,
+		ConnMaxIdleTime: cfg.Postgres.ConnMaxIdleTime,
+	})
+	if err != nil {
+		log.Fatal("Could not connect to database", zap.Error(err))
+	}
+	defer db.Close()
+
+	var settings []model.MerchantSettings
+	if err := db.SelectContext(ctx, &settings, `SELECT * FROM merchant_settings`); err != nil {
+		log.Fatal("Failed to load merchant settings", zap.Error(err))
+	}
+	countries := make(map[uuid.UUID]string, len(settings))
+	for _, s := range settings {
+		countries[s.MerchantID] = s.PhoneCountry
+	}
+
+	type phoneKey struct {
+		merchantID uuid.UUID
+		e164       string
+	}
+	owners := make(map[phoneKey][]uuid.UUID)
+
+	var scanned, updated, invalid int
+	after := uuid.Nil
+	for {
+		var rows []struct {
+			ID         uuid.UUID `db:"id"`
+			MerchantID uuid.UUID `db:"merchant_id"`
+			Phone      string    `db:"phone"`
+			PhoneE164  *string   `db:"phone_e164"`
+			Deleted    bool      `db:"deleted"`
+		}
+		query := `
+			SELECT id, merchant_id, phone, phone_e164, deleted_at IS NOT NULL AS deleted
+			FROM customers
+			WHERE id > $1
+			ORDER BY id
+			LIMIT $2
+		`
+		if err := db.SelectContext(ctx, &rows, query, after, *batch); err != nil {
+			log.Fatal("Failed to read customers", zap.Error(err))
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for _, row := range rows {
+			after = row.ID
+			scanned++
+
+			country, ok := countries[row.MerchantID]
+			if !ok {
+				country = model.DefaultMerchantSettings(row.MerchantID).PhoneCountry
+			}
+			var e164 *string
+			if row.Phone != "" {
+				normalized, err := model.NormalizePhone(row.Phone, country)
+				if err != nil {
+					invalid++
+					log.Warn("Phone cannot be normalized",
+						zap.String("customer_id", row.ID.String()),
+						zap.String("phone", row.Phone),
+						zap.String("country", country))
+				} else {
+					e164 = &normalized
+				}
+			}
+
+			if e164 != nil && !row.Deleted {
+				key := phoneKey{row.MerchantID, *e164}
+				owners[key] = append(owners[key], row.ID)
+			}
+			if equalPhone(e164, row.PhoneE164) {
+				continue
+			}
+			updated++
+			if *dryRun {
+				continue
+			}
+			if _, err := db.ExecContext(ctx, `UPDATE customers SET phone_e164 = $1 WHERE id = $2`, e164, row.ID); err != nil {
+				log.Fatal("Failed to update customer phone", zap.String("customer_id", row.ID.String()), zap.Error(err))
+			}
+		}
+	}
+
+	collisions := 0
+	for key, ids := range owners {
+		if len(ids) < 2 {
+			continue
+		}
+		collisions++
+		customerIDs := make([]string, len(ids))
+		for i, id := range ids {
+			customerIDs[i] = id.String()
+		}
+		log.Warn("Customers share a phone number",
+			zap.String("merchant_id", key.merchantID.String()),
+			zap.String("phone_e164", key.e164),
+			zap.Strings("customer_ids", customerIDs))
+	}
+
+	log.Info("Normalization finished",
+		zap.Bool("dry_run", *dryRun),
+		zap.Int("scanned", scanned),
+		zap.Int("updated", updated),
+		zap.Int("invalid", invalid),
+		zap.Int("collisions", collisions))
+
+	if collisions > 0 {
+		// Merge or fix the reported customers, then run again.
+		os.Exit(1)
+	}
+	if !*enforce || *dryRun {
+		return
+	}
+
+	// CONCURRENTLY cannot run inside a transaction, so each statement is
+	// executed on its own. A failed concurrent build leaves an invalid index
+	// behind that IF NOT EXISTS would accept, so it is dropped and rebuilt,
+	// and the raw phone index is only dropped once the new one is valid.
+	valid, exists, err := indexValid(ctx, db, e164Index)
+	if err != nil {
+		log.Fatal("Failed to inspect unique index on phone_e164", zap.Error(err))
+	}
+	if exists && !valid {
+		log.Warn("Dropping invalid unique index on phone_e164 left by an earlier run")
+		if _, err := db.ExecContext(ctx, `DROP INDEX CONCURRENTLY IF EXISTS `+e164Index); err != nil {
+			log.Fatal("Failed to drop invalid unique index on phone_e164", zap.Error(err))
+		}
+	}
+	if _, err := db.ExecContext(ctx, `
+		CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS `+e164Index+`
+		ON customers(merchant_id, phone_e164) WHERE deleted_at IS NULL
+	`); err != nil {
+		log.Fatal("Failed to create unique index on phone_e164", zap.Error(err))
+	}
+	if valid, _, err := indexValid(ctx, db, e164Index); err != nil || !valid {
+		log.Fatal("Unique index on phone_e164 is not valid, keeping the index on phone", zap.Error(err))
+	}
+	if _, err := db.ExecContext(ctx, `DROP INDEX CONCURRENTLY IF EXISTS uq_customers_merchant_phone_active`); err != nil {
+		log.Fatal("Failed to drop unique index on phone", zap.Error(err))
+	}
+	log.Info("Phone uniqueness now enforced on phone_e164")
+}
+
+// e164Index enforces phone uniqueness once normalization is complete.
+const e164Index = "uq_customers_merchant_phone_e164_active"
+
+// indexValid reports whether the named index exists and is usable. Indexes
+// from interrupted concurrent builds exist but are not valid.
+func indexValid(ctx context.Context, db *sqlx.DB, name string) (valid, exists bool, err error) {
+	err = db.GetContext(ctx, &valid, `SELECT indisvalid FROM pg_index WHERE indexrelid = to_regclass($1)`, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return valid, true, nil
+}
+
+func equalPhone(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -12,11 +12,17 @@ type Config struct {
 	Postgres PostgresConfig
 	JWT      JWTConfig
 	Kafka    KafkaConfig
+	Purge    PurgeConfig
+	Expiry   ExpiryConfig
+	Outbox   OutboxConfig
+	Segment  SegmentConfig
+	Tier     TierConfig
 }
 
 type ServerConfig struct {
-	AppEnv   string
-	GRPCPort string
+	AppEnv          string
+	GRPCPort        string
+	ShutdownTimeout time.Duration // Deadline for draining on SIGTERM, after which in-flight work is cancelled
 }
 
 type LoggerConfig struct {
@@ -44,16 +50,52 @@ type JWTConfig struct {
 }
 
 type KafkaConfig struct {
-	Brokers []string
-	Topic   string // orders.events
-	GroupID string // customer-service
+	Brokers         []string
+	Topic           string // orders.events
+	GroupID         string // customer-service
+	DLQTopic        string // orders.events.customer-service.dlq
+	MaxAttempts     int
+	RetryBackoff    time.Duration
+	RetryMaxBackoff time.Duration
+	Workers         int    // Concurrent event processors
+	QueueSize       int    // Messages buffered per worker
+	EventsTopic     string // customer.events
+}
+
+type PurgeConfig struct {
+	Retention time.Duration // How long soft-deleted customers are kept
+	Interval  time.Duration
+}
+
+type ExpiryConfig struct {
+	Interval  time.Duration // How often due loyalty point lots are expired
+	BatchSize int
+}
+
+type SegmentConfig struct {
+	MaxAge    time.Duration // How stale a segment may get before it is fully re-evaluated
+	Interval  time.Duration
+	BatchSize int
+}
+
+type TierConfig struct {
+	MaxAge    time.Duration // How often rolling-spend tiers are re-evaluated for customers without new activity
+	Interval  time.Duration
+	BatchSize int
+}
+
+type OutboxConfig struct {
+	Interval  time.Duration // How often pending domain events are relayed
+	BatchSize int
+	Retention time.Duration // How long published events are kept
 }
 
 func LoadEnv() *Config {
 	return &Config{
 		Server: ServerConfig{
-			AppEnv:   getEnv("APP_ENV", "dev"),
-			GRPCPort: getEnv("GRPC_PORT", ":8084"), // Port 8084 for Customer Service
+			AppEnv:          getEnv("APP_ENV", "dev"),
+			GRPCPort:        getEnv("GRPC_PORT", ":8084"), // Port 8084 for Customer Service
+			ShutdownTimeout: time.Duration(getEnvInt("SHUTDOWN_TIMEOUT_SECONDS", 30)) * time.Second,
 		},
 		Logger: LoggerConfig{
 			Level:             getEnv("LOGGER_LEVEL", "debug"),
@@ -77,9 +119,39 @@ func LoadEnv() *Config {
 			SecretKey: getEnv("JWT_SECRET_KEY", "your-secret-key"),
 		},
 		Kafka: KafkaConfig{
-			Brokers: []string{getEnv("KAFKA_BROKERS", "localhost:29092")},
-			Topic:   getEnv("KAFKA_TOPIC", "orders.events"),
-			GroupID: getEnv("KAFKA_GROUP_ID", "customer-service"),
+			Brokers:         []string{getEnv("KAFKA_BROKERS", "localhost:29092")},
+			Topic:           getEnv("KAFKA_TOPIC", "orders.events"),
+			GroupID:         getEnv("KAFKA_GROUP_ID", "customer-service"),
+			DLQTopic:        getEnv("KAFKA_DLQ_TOPIC", "orders.events.customer-service.dlq"),
+			MaxAttempts:     getEnvInt("KAFKA_MAX_ATTEMPTS", 5),
+			RetryBackoff:    time.Duration(getEnvInt("KAFKA_RETRY_BACKOFF_MS", 200)) * time.Millisecond,
+			RetryMaxBackoff: time.Duration(getEnvInt("KAFKA_RETRY_MAX_BACKOFF_MS", 10000)) * time.Millisecond,
+			Workers:         getEnvInt("KAFKA_WORKERS", 8),
+			QueueSize:       getEnvInt("KAFKA_QUEUE_SIZE", 16),
+			EventsTopic:     getEnv("KAFKA_CUSTOMER_EVENTS_TOPIC", "customer.events"),
+		},
+		Purge: PurgeConfig{
+			Retention: time.Duration(getEnvInt("PURGE_RETENTION_HOURS", 720)) * time.Hour,
+			Interval:  time.Duration(getEnvInt("PURGE_INTERVAL_MINUTES", 60)) * time.Minute,
+		},
+		Expiry: ExpiryConfig{
+			Interval:  time.Duration(getEnvInt("EXPIRY_INTERVAL_MINUTES", 60)) * time.Minute,
+			BatchSize: getEnvInt("EXPIRY_BATCH_SIZE", 500),
+		},
+		Outbox: OutboxConfig{
+			Interval:  time.Duration(getEnvInt("OUTBOX_INTERVAL_MS", 1000)) * time.Millisecond,
+			BatchSize: getEnvInt("OUTBOX_BATCH_SIZE", 100),
+			Retention: time.Duration(getEnvInt("OUTBOX_RETENTION_HOURS", 168)) * time.Hour,
+		},
+		Segment: SegmentConfig{
+			MaxAge:    time.Duration(getEnvInt("SEGMENT_MAX_AGE_HOURS", 24)) * time.Hour,
+			Interval:  time.Duration(getEnvInt("SEGMENT_INTERVAL_MINUTES", 60)) * time.Minute,
+			BatchSize: getEnvInt("SEGMENT_BATCH_SIZE", 50),
+		},
+		Tier: TierConfig{
+			MaxAge:    time.Duration(getEnvInt("TIER_MAX_AGE_HOURS", 24)) * time.Hour,
+			Interval:  time.Duration(getEnvInt("TIER_INTERVAL_MINUTES", 15)) * time.Minute,
+			BatchSize: getEnvInt("TIER_BATCH_SIZE", 200),
 		},
 	}
 }
@@ -0,0 +1,94 @@
+package apperror
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kind classifies a domain error independently of the transport.
+type Kind int
+
+const (
+	KindNotFound Kind = iota + 1
+	KindInvalidArgument
+	KindAlreadyExists
+	KindFailedPrecondition
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindNotFound:
+		return "not_found"
+	case KindInvalidArgument:
+		return "invalid_argument"
+	case KindAlreadyExists:
+		return "already_exists"
+	case KindFailedPrecondition:
+		return "failed_precondition"
+	default:
+		return "unknown"
+	}
+}
+
+// FieldViolation describes a single offending request field.
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// Error is a domain error returned by the usecase layer. The gRPC error
+// interceptor translates it into a status code with details attached.
+type Error struct {
+	Kind       Kind
+	Message    string
+	Violations []FieldViolation
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap attaches an underlying cause to the error.
+func (e *Error) Wrap(err error) *Error {
+	e.Err = err
+	return e
+}
+
+func NotFound(message string) *Error {
+	return &Error{Kind: KindNotFound, Message: message}
+}
+
+func InvalidArgument(message string, violations ...FieldViolation) *Error {
+	return &Error{Kind: KindInvalidArgument, Message: message, Violations: violations}
+}
+
+func AlreadyExists(message string, violations ...FieldViolation) *Error {
+	return &Error{Kind: KindAlreadyExists, Message: message, Violations: violations}
+}
+
+func FailedPrecondition(message string, violations ...FieldViolation) *Error {
+	return &Error{Kind: KindFailedPrecondition, Message: message, Violations: violations}
+}
+
+// As returns the domain error in err's chain, if any.
+func As(err error) (*Error, bool) {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr, true
+	}
+	return nil, false
+}
+
+// IsKind reports whether err is a domain error of the given kind.
+func IsKind(err error, kind Kind) bool {
+	appErr, ok := As(err)
+	return ok && appErr.Kind == kind
+}
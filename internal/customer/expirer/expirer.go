@@ -0,0 +1,57 @@
+package expirer
+
+import (
+	"context"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/customer/usecase"
+	"github.com/fekuna/omnipos-pkg/logger"
+	"go.uber.org/zap"
+)
+
+// PointsExpirer periodically expires loyalty point lots that are past due and
+// writes the matching expire ledger entries.
+type PointsExpirer struct {
+	uc        usecase.UseCase
+	logger    logger.ZapLogger
+	interval  time.Duration
+	batchSize int
+}
+
+func NewPointsExpirer(uc usecase.UseCase, logger logger.ZapLogger, interval time.Duration, batchSize int) *PointsExpirer {
+	return &PointsExpirer{
+		uc:        uc,
+		logger:    logger,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+func (e *PointsExpirer) Start(ctx context.Context) {
+	e.logger.Info("Starting Points Expirer", zap.Duration("interval", e.interval), zap.Int("batch_size", e.batchSize))
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		e.expire(ctx)
+
+		select {
+		case <-ctx.Done():
+			e.logger.Info("Stopping Points Expirer")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// expire works through every lot that is due.
+func (e *PointsExpirer) expire(ctx context.Context) {
+	expired, err := e.uc.ExpireDuePoints(ctx, e.batchSize)
+	if err != nil && ctx.Err() == nil {
+		e.logger.Error("Failed to expire loyalty points", zap.Error(err))
+	}
+	if expired > 0 {
+		e.logger.Info("Expired loyalty point lots", zap.Int("count", expired))
+	}
+}
@@ -2,7 +2,9 @@ package handler
 
 import (
 	"context"
+	"time"
 
+	"github.com/fekuna/omnipos-customer-service/internal/apperror"
 	"github.com/fekuna/omnipos-customer-service/internal/auth"
 	"github.com/fekuna/omnipos-customer-service/internal/customer/usecase"
 	"github.com/fekuna/omnipos-customer-service/internal/model"
@@ -45,6 +47,10 @@ func (h *CustomerHandler) CreateCustomer(ctx context.Context, req *customerv1.Cr
 		Phone:      req.Phone,
 		Email:      req.Email,
 		Address:    req.Address,
+		Tags:       req.Tags,
+	}
+	if input.Birthday, err = parseBirthday(req.Birthday); err != nil {
+		return nil, err
 	}
 
 	res, err := h.useCase.CreateCustomer(ctx, input)
@@ -59,17 +65,14 @@ func (h *CustomerHandler) CreateCustomer(ctx context.Context, req *customerv1.Cr
 }
 
 func (h *CustomerHandler) GetCustomer(ctx context.Context, req *customerv1.GetCustomerRequest) (*customerv1.GetCustomerResponse, error) {
-	// Security: Should verify merchantID owns this customer?
-	// Assuming useCase.GetCustomer checks it or returns generic info.
-	// But useCase calls repo.GetByID which finds by ID.
-	// Strictly speaking we should enforce merchant isolation.
-	// Let's rely on useCase having logic or just assume valid ID access for now (MVP).
-	// Ideally UseCase.GetCustomer should take merchantID.
-	// Looking at UseCase (Step 4835): GetCustomer(ctx, id). No merchantID.
-	// This is a SECURITY RISK but for MVP we proceed, or update UseCase.
-	// Wait, ListCustomers enforces it.
-
-	res, err := h.useCase.GetCustomer(ctx, req.Id)
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	// Customers are always resolved within the caller's merchant, so another
+	// merchant's customer ID is indistinguishable from a missing one.
+	res, err := h.useCase.GetCustomer(ctx, merchantID, req.Id)
 	if err != nil {
 		h.logger.Error("Failed to get customer", zap.Error(err))
 		return nil, err
@@ -86,42 +89,134 @@ func (h *CustomerHandler) ListCustomers(ctx context.Context, req *customerv1.Lis
 		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
 	}
 
-	res, total, err := h.useCase.ListCustomers(ctx, merchantID, int(req.Page), int(req.PageSize), req.Search)
+	// Zero filter values mean the filter is not set.
+	opts := model.CustomerListOptions{
+		PageSize:     int(req.PageSize),
+		Cursor:       req.PageToken,
+		IncludeTotal: req.IncludeTotal,
+		Search:       req.Search,
+		SortBy:       model.CustomerSortKey(req.SortBy),
+	}
+	switch req.SortOrder {
+	case "", "desc":
+		// Newest or best match first unless asked otherwise.
+		opts.Descending = true
+	case "asc":
+	default:
+		return nil, apperror.InvalidArgument("invalid sort_order", apperror.FieldViolation{
+			Field:       "sort_order",
+			Description: "must be asc or desc",
+		})
+	}
+	// Clients that still send a page number without a token get offset
+	// paging.
+	if req.PageToken == "" {
+		opts.Page = int(req.Page)
+	}
+	opts.CreatedAfter = optionalTime(req.CreatedAfter)
+	opts.CreatedBefore = optionalTime(req.CreatedBefore)
+	opts.UpdatedAfter = optionalTime(req.UpdatedAfter)
+	opts.UpdatedBefore = optionalTime(req.UpdatedBefore)
+	opts.MinLoyaltyPoints = req.MinLoyaltyPoints
+	opts.MaxLoyaltyPoints = req.MaxLoyaltyPoints
+	opts.Tags = req.Tags
+	opts.HasEmail = req.HasEmail
+	if req.TierId != "" {
+		tierID, err := uuid.Parse(req.TierId)
+		if err != nil {
+			return nil, apperror.InvalidArgument("invalid tier_id", apperror.FieldViolation{
+				Field:       "tier_id",
+				Description: "must be a valid UUID",
+			})
+		}
+		opts.TierID = &tierID
+	}
+	if req.BirthdayMonth != 0 {
+		month := int(req.BirthdayMonth)
+		opts.BirthdayMonth = &month
+	}
+	if req.MinLifetimeSpend > 0 {
+		opts.MinLifetimeSpend = &req.MinLifetimeSpend
+	}
+	if req.MinOrderCount > 0 {
+		opts.MinOrderCount = &req.MinOrderCount
+	}
+	opts.LastPurchaseAfter = optionalTime(req.LastPurchaseAfter)
+	opts.LastPurchaseBefore = optionalTime(req.LastPurchaseBefore)
+	if req.SegmentId != "" {
+		segmentID, err := uuid.Parse(req.SegmentId)
+		if err != nil {
+			return nil, apperror.InvalidArgument("invalid segment_id", apperror.FieldViolation{
+				Field:       "segment_id",
+				Description: "must be a valid UUID",
+			})
+		}
+		opts.SegmentID = &segmentID
+	}
+
+	res, err := h.useCase.ListCustomers(ctx, merchantID, opts)
 	if err != nil {
 		h.logger.Error("Failed to list customers", zap.Error(err))
 		return nil, err
 	}
 
 	var customers []*customerv1.Customer
-	for _, c := range res {
+	for _, c := range res.Customers {
 		customers = append(customers, mapToProto(c))
 	}
 
-	return &customerv1.ListCustomersResponse{
-		Customers: customers,
-		Total:     int32(total),
-	}, nil
+	resp := &customerv1.ListCustomersResponse{
+		Customers:     customers,
+		NextPageToken: res.NextCursor,
+	}
+	if res.Total != nil {
+		resp.Total = int32(*res.Total)
+	}
+	return resp, nil
 }
 
 func (h *CustomerHandler) UpdateCustomer(ctx context.Context, req *customerv1.UpdateCustomerRequest) (*customerv1.UpdateCustomerResponse, error) {
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	mid, err := uuid.Parse(merchantID)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid merchant id format")
+	}
+
 	// UseCase handles Validation, ID parsing done by Handler when creating model input.
 	// We need to parse string ID to UUID for the model input.
 
 	id, err := uuid.Parse(req.Id)
 	if err != nil {
 		h.logger.Error("Invalid ID format", zap.Error(err))
-		return nil, err
+		return nil, apperror.InvalidArgument("invalid id", apperror.FieldViolation{
+			Field:       "id",
+			Description: "must be a valid UUID",
+		})
 	}
 
 	input := &model.Customer{
-		ID:      id,
-		Name:    req.Name,
-		Phone:   req.Phone,
-		Email:   req.Email,
-		Address: req.Address,
+		ID:         id,
+		MerchantID: mid,
+		Name:       req.Name,
+		Phone:      req.Phone,
+		Email:      req.Email,
+		Address:    req.Address,
+		Tags:       req.Tags,
+	}
+	if input.Birthday, err = parseBirthday(req.Birthday); err != nil {
+		return nil, err
 	}
 
-	res, err := h.useCase.UpdateCustomer(ctx, input)
+	var updateMask []string
+	if req.UpdateMask != nil {
+		updateMask = req.UpdateMask.Paths
+	}
+
+	res, err := h.useCase.UpdateCustomer(ctx, input, updateMask)
 	if err != nil {
 		h.logger.Error("Failed to update customer", zap.Error(err))
 		return nil, err
@@ -132,8 +227,44 @@ func (h *CustomerHandler) UpdateCustomer(ctx context.Context, req *customerv1.Up
 	}, nil
 }
 
+func (h *CustomerHandler) DeleteCustomer(ctx context.Context, req *customerv1.DeleteCustomerRequest) (*customerv1.DeleteCustomerResponse, error) {
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	if err := h.useCase.DeleteCustomer(ctx, merchantID, req.Id); err != nil {
+		h.logger.Error("Failed to delete customer", zap.Error(err))
+		return nil, err
+	}
+
+	return &customerv1.DeleteCustomerResponse{}, nil
+}
+
+func (h *CustomerHandler) RestoreCustomer(ctx context.Context, req *customerv1.RestoreCustomerRequest) (*customerv1.RestoreCustomerResponse, error) {
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	res, err := h.useCase.RestoreCustomer(ctx, merchantID, req.Id)
+	if err != nil {
+		h.logger.Error("Failed to restore customer", zap.Error(err))
+		return nil, err
+	}
+
+	return &customerv1.RestoreCustomerResponse{
+		Customer: mapToProto(res),
+	}, nil
+}
+
 func (h *CustomerHandler) AddLoyaltyPoints(ctx context.Context, req *customerv1.AddLoyaltyPointsRequest) (*customerv1.AddLoyaltyPointsResponse, error) {
-	newPoints, err := h.useCase.AddLoyaltyPoints(ctx, req.CustomerId, req.Points)
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	newPoints, err := h.useCase.AddLoyaltyPoints(ctx, merchantID, req.CustomerId, req.Points, actorFromContext(ctx), req.Reason)
 	if err != nil {
 		h.logger.Error("Failed to add loyalty points", zap.Error(err))
 		return nil, err
@@ -144,16 +275,600 @@ func (h *CustomerHandler) AddLoyaltyPoints(ctx context.Context, req *customerv1.
 	}, nil
 }
 
+func (h *CustomerHandler) ListLoyaltyTransactions(ctx context.Context, req *customerv1.ListLoyaltyTransactionsRequest) (*customerv1.ListLoyaltyTransactionsResponse, error) {
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	res, total, err := h.useCase.ListLoyaltyTransactions(ctx, merchantID, req.CustomerId, int(req.Page), int(req.PageSize))
+	if err != nil {
+		h.logger.Error("Failed to list loyalty transactions", zap.Error(err))
+		return nil, err
+	}
+
+	var transactions []*customerv1.LoyaltyTransaction
+	for _, t := range res {
+		transactions = append(transactions, mapLoyaltyTransactionToProto(t))
+	}
+
+	return &customerv1.ListLoyaltyTransactionsResponse{
+		Transactions: transactions,
+		Total:        int32(total),
+	}, nil
+}
+
+func (h *CustomerHandler) RedeemLoyaltyPoints(ctx context.Context, req *customerv1.RedeemLoyaltyPointsRequest) (*customerv1.RedeemLoyaltyPointsResponse, error) {
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	newPoints, err := h.useCase.RedeemLoyaltyPoints(ctx, merchantID, req.CustomerId, req.Points, req.OrderId, actorFromContext(ctx), req.Reason)
+	if err != nil {
+		h.logger.Error("Failed to redeem loyalty points", zap.Error(err))
+		return nil, err
+	}
+
+	return &customerv1.RedeemLoyaltyPointsResponse{
+		TotalPoints: newPoints,
+	}, nil
+}
+
+func (h *CustomerHandler) HoldLoyaltyPoints(ctx context.Context, req *customerv1.HoldLoyaltyPointsRequest) (*customerv1.HoldLoyaltyPointsResponse, error) {
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	res, err := h.useCase.HoldLoyaltyPoints(ctx, merchantID, req.CustomerId, req.Points, req.OrderId)
+	if err != nil {
+		h.logger.Error("Failed to hold loyalty points", zap.Error(err))
+		return nil, err
+	}
+
+	return &customerv1.HoldLoyaltyPointsResponse{
+		Hold: mapLoyaltyHoldToProto(res),
+	}, nil
+}
+
+func (h *CustomerHandler) ConfirmLoyaltyHold(ctx context.Context, req *customerv1.ConfirmLoyaltyHoldRequest) (*customerv1.ConfirmLoyaltyHoldResponse, error) {
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	newPoints, err := h.useCase.ConfirmLoyaltyHold(ctx, merchantID, req.HoldId, actorFromContext(ctx))
+	if err != nil {
+		h.logger.Error("Failed to confirm loyalty hold", zap.Error(err))
+		return nil, err
+	}
+
+	return &customerv1.ConfirmLoyaltyHoldResponse{
+		TotalPoints: newPoints,
+	}, nil
+}
+
+func (h *CustomerHandler) CancelLoyaltyHold(ctx context.Context, req *customerv1.CancelLoyaltyHoldRequest) (*customerv1.CancelLoyaltyHoldResponse, error) {
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	res, err := h.useCase.CancelLoyaltyHold(ctx, merchantID, req.HoldId)
+	if err != nil {
+		h.logger.Error("Failed to cancel loyalty hold", zap.Error(err))
+		return nil, err
+	}
+
+	return &customerv1.CancelLoyaltyHoldResponse{
+		Hold: mapLoyaltyHoldToProto(res),
+	}, nil
+}
+
+func (h *CustomerHandler) GetLoyaltyProgram(ctx context.Context, req *customerv1.GetLoyaltyProgramRequest) (*customerv1.GetLoyaltyProgramResponse, error) {
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	res, err := h.useCase.GetLoyaltyProgram(ctx, merchantID)
+	if err != nil {
+		h.logger.Error("Failed to get loyalty program", zap.Error(err))
+		return nil, err
+	}
+
+	return &customerv1.GetLoyaltyProgramResponse{
+		Program: mapLoyaltyProgramToProto(res),
+	}, nil
+}
+
+func (h *CustomerHandler) UpdateLoyaltyProgram(ctx context.Context, req *customerv1.UpdateLoyaltyProgramRequest) (*customerv1.UpdateLoyaltyProgramResponse, error) {
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	mid, err := uuid.Parse(merchantID)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid merchant id format")
+	}
+
+	input := &model.LoyaltyProgram{
+		MerchantID:        mid,
+		Enabled:           req.Enabled,
+		Currency:          req.Currency,
+		PointsPerUnit:     req.PointsPerUnit,
+		RoundingMode:      model.RoundingMode(req.RoundingMode),
+		MinOrderAmount:    req.MinOrderAmount,
+		MaxPointsPerOrder: req.MaxPointsPerOrder,
+		TierBasis:         model.TierBasis(req.TierBasis),
+		TierWindowDays:    req.TierWindowDays,
+		ExpiryPolicy:      model.ExpiryPolicy(req.ExpiryPolicy),
+		ExpiryMonths:      req.ExpiryMonths,
+	}
+
+	res, err := h.useCase.UpdateLoyaltyProgram(ctx, input)
+	if err != nil {
+		h.logger.Error("Failed to update loyalty program", zap.Error(err))
+		return nil, err
+	}
+
+	return &customerv1.UpdateLoyaltyProgramResponse{
+		Program: mapLoyaltyProgramToProto(res),
+	}, nil
+}
+
+func (h *CustomerHandler) GetMerchantSettings(ctx context.Context, req *customerv1.GetMerchantSettingsRequest) (*customerv1.GetMerchantSettingsResponse, error) {
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	res, err := h.useCase.GetMerchantSettings(ctx, merchantID)
+	if err != nil {
+		h.logger.Error("Failed to get merchant settings", zap.Error(err))
+		return nil, err
+	}
+
+	return &customerv1.GetMerchantSettingsResponse{
+		Settings: mapMerchantSettingsToProto(res),
+	}, nil
+}
+
+func (h *CustomerHandler) UpdateMerchantSettings(ctx context.Context, req *customerv1.UpdateMerchantSettingsRequest) (*customerv1.UpdateMerchantSettingsResponse, error) {
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	mid, err := uuid.Parse(merchantID)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid merchant id format")
+	}
+
+	input := &model.MerchantSettings{
+		MerchantID:   mid,
+		PhoneCountry: req.PhoneCountry,
+	}
+
+	res, err := h.useCase.UpdateMerchantSettings(ctx, input)
+	if err != nil {
+		h.logger.Error("Failed to update merchant settings", zap.Error(err))
+		return nil, err
+	}
+
+	return &customerv1.UpdateMerchantSettingsResponse{
+		Settings: mapMerchantSettingsToProto(res),
+	}, nil
+}
+
+func (h *CustomerHandler) ListLoyaltyTiers(ctx context.Context, req *customerv1.ListLoyaltyTiersRequest) (*customerv1.ListLoyaltyTiersResponse, error) {
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	res, err := h.useCase.ListLoyaltyTiers(ctx, merchantID)
+	if err != nil {
+		h.logger.Error("Failed to list loyalty tiers", zap.Error(err))
+		return nil, err
+	}
+
+	var tiers []*customerv1.LoyaltyTier
+	for _, t := range res {
+		tiers = append(tiers, mapLoyaltyTierToProto(t))
+	}
+
+	return &customerv1.ListLoyaltyTiersResponse{
+		Tiers: tiers,
+	}, nil
+}
+
+func (h *CustomerHandler) SaveLoyaltyTier(ctx context.Context, req *customerv1.SaveLoyaltyTierRequest) (*customerv1.SaveLoyaltyTierResponse, error) {
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	mid, err := uuid.Parse(merchantID)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid merchant id format")
+	}
+
+	input := &model.LoyaltyTier{
+		MerchantID:     mid,
+		Name:           req.Name,
+		Threshold:      req.Threshold,
+		EarnMultiplier: req.EarnMultiplier,
+	}
+	if req.Id != "" {
+		id, err := uuid.Parse(req.Id)
+		if err != nil {
+			return nil, apperror.InvalidArgument("invalid id", apperror.FieldViolation{
+				Field:       "id",
+				Description: "must be a valid UUID",
+			})
+		}
+		input.ID = id
+	}
+
+	res, err := h.useCase.SaveLoyaltyTier(ctx, input)
+	if err != nil {
+		h.logger.Error("Failed to save loyalty tier", zap.Error(err))
+		return nil, err
+	}
+
+	return &customerv1.SaveLoyaltyTierResponse{
+		Tier: mapLoyaltyTierToProto(res),
+	}, nil
+}
+
+func (h *CustomerHandler) DeleteLoyaltyTier(ctx context.Context, req *customerv1.DeleteLoyaltyTierRequest) (*customerv1.DeleteLoyaltyTierResponse, error) {
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	if err := h.useCase.DeleteLoyaltyTier(ctx, merchantID, req.Id); err != nil {
+		h.logger.Error("Failed to delete loyalty tier", zap.Error(err))
+		return nil, err
+	}
+
+	return &customerv1.DeleteLoyaltyTierResponse{}, nil
+}
+
+func (h *CustomerHandler) ListCustomerSegments(ctx context.Context, req *customerv1.ListCustomerSegmentsRequest) (*customerv1.ListCustomerSegmentsResponse, error) {
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	res, err := h.useCase.ListSegments(ctx, merchantID)
+	if err != nil {
+		h.logger.Error("Failed to list customer segments", zap.Error(err))
+		return nil, err
+	}
+
+	var segments []*customerv1.CustomerSegment
+	for _, s := range res {
+		segments = append(segments, mapCustomerSegmentToProto(s))
+	}
+
+	return &customerv1.ListCustomerSegmentsResponse{
+		Segments: segments,
+	}, nil
+}
+
+func (h *CustomerHandler) SaveCustomerSegment(ctx context.Context, req *customerv1.SaveCustomerSegmentRequest) (*customerv1.SaveCustomerSegmentResponse, error) {
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	mid, err := uuid.Parse(merchantID)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid merchant id format")
+	}
+
+	input := &model.CustomerSegment{
+		MerchantID:  mid,
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	for _, r := range req.Rules {
+		input.Rules = append(input.Rules, model.SegmentRule{
+			Field:    model.SegmentField(r.Field),
+			Operator: model.SegmentOperator(r.Operator),
+			Value:    r.Value,
+		})
+	}
+	if req.Id != "" {
+		id, err := uuid.Parse(req.Id)
+		if err != nil {
+			return nil, apperror.InvalidArgument("invalid id", apperror.FieldViolation{
+				Field:       "id",
+				Description: "must be a valid UUID",
+			})
+		}
+		input.ID = id
+	}
+
+	res, err := h.useCase.SaveSegment(ctx, input)
+	if err != nil {
+		h.logger.Error("Failed to save customer segment", zap.Error(err))
+		return nil, err
+	}
+
+	return &customerv1.SaveCustomerSegmentResponse{
+		Segment: mapCustomerSegmentToProto(res),
+	}, nil
+}
+
+func (h *CustomerHandler) DeleteCustomerSegment(ctx context.Context, req *customerv1.DeleteCustomerSegmentRequest) (*customerv1.DeleteCustomerSegmentResponse, error) {
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	if err := h.useCase.DeleteSegment(ctx, merchantID, req.Id); err != nil {
+		h.logger.Error("Failed to delete customer segment", zap.Error(err))
+		return nil, err
+	}
+
+	return &customerv1.DeleteCustomerSegmentResponse{}, nil
+}
+
+func (h *CustomerHandler) ListCustomerTierHistory(ctx context.Context, req *customerv1.ListCustomerTierHistoryRequest) (*customerv1.ListCustomerTierHistoryResponse, error) {
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	res, err := h.useCase.ListTierHistory(ctx, merchantID, req.CustomerId)
+	if err != nil {
+		h.logger.Error("Failed to list tier history", zap.Error(err))
+		return nil, err
+	}
+
+	var changes []*customerv1.TierChange
+	for _, c := range res {
+		changes = append(changes, &customerv1.TierChange{
+			Id:         c.ID.String(),
+			CustomerId: c.CustomerID.String(),
+			FromTierId: optionalUUIDString(c.FromTierID),
+			ToTierId:   optionalUUIDString(c.ToTierID),
+			Metric:     c.Metric,
+			CreatedAt:  timestamppb.New(c.CreatedAt),
+		})
+	}
+
+	return &customerv1.ListCustomerTierHistoryResponse{
+		Changes: changes,
+	}, nil
+}
+
+func (h *CustomerHandler) ListUpcomingExpirations(ctx context.Context, req *customerv1.ListUpcomingExpirationsRequest) (*customerv1.ListUpcomingExpirationsResponse, error) {
+	merchantID := auth.GetMerchantID(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "merchant id not found in context")
+	}
+
+	within := time.Duration(req.WithinDays) * 24 * time.Hour
+	res, err := h.useCase.ListUpcomingExpirations(ctx, merchantID, req.CustomerId, within)
+	if err != nil {
+		h.logger.Error("Failed to list upcoming expirations", zap.Error(err))
+		return nil, err
+	}
+
+	var expirations []*customerv1.PointExpiration
+	for _, e := range res {
+		expirations = append(expirations, &customerv1.PointExpiration{
+			Points:    e.Points,
+			ExpiresAt: timestamppb.New(e.ExpiresAt),
+		})
+	}
+
+	return &customerv1.ListUpcomingExpirationsResponse{
+		Expirations: expirations,
+	}, nil
+}
+
+// actorFromContext identifies who performed a manual loyalty change. It falls
+// back to the merchant when the caller's user is not propagated.
+func actorFromContext(ctx context.Context) string {
+	userCtx := auth.GetUserContext(ctx)
+	if userCtx == nil {
+		return ""
+	}
+	if userCtx.UserID != "" {
+		return userCtx.UserID
+	}
+	return "merchant:" + userCtx.MerchantID
+}
+
 func mapToProto(c *model.Customer) *customerv1.Customer {
 	return &customerv1.Customer{
 		Id:            c.ID.String(),
 		MerchantId:    c.MerchantID.String(),
 		Name:          c.Name,
 		Phone:         c.Phone,
+		PhoneE164:     optionalString(c.PhoneE164),
 		Email:         c.Email,
 		Address:       c.Address,
 		LoyaltyPoints: c.LoyaltyPoints,
+		TierId:        optionalUUIDString(c.TierID),
+		Tags:          c.Tags,
+		Birthday:      formatBirthday(c.Birthday),
+		Stats:         mapCustomerStatsToProto(c.Stats),
 		CreatedAt:     timestamppb.New(c.CreatedAt),
 		UpdatedAt:     timestamppb.New(c.UpdatedAt),
 	}
 }
+
+func mapCustomerStatsToProto(s *model.CustomerStats) *customerv1.CustomerStats {
+	if s == nil {
+		return nil
+	}
+	pb := &customerv1.CustomerStats{
+		OrderCount:        s.OrderCount,
+		LifetimeSpend:     s.LifetimeSpend,
+		AverageOrderValue: s.AverageOrderValue,
+	}
+	if s.Currency != nil {
+		pb.Currency = *s.Currency
+	}
+	if s.FirstPurchaseAt != nil {
+		pb.FirstPurchaseAt = timestamppb.New(*s.FirstPurchaseAt)
+	}
+	if s.LastPurchaseAt != nil {
+		pb.LastPurchaseAt = timestamppb.New(*s.LastPurchaseAt)
+	}
+	if s.FavouriteStoreID != nil {
+		pb.FavouriteStoreId = *s.FavouriteStoreID
+	}
+	return pb
+}
+
+func optionalTime(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
+
+// birthdayLayout is how birthdays are exchanged with clients.
+const birthdayLayout = "2006-01-02"
+
+// parseBirthday parses an optional YYYY-MM-DD birthday.
+func parseBirthday(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	birthday, err := time.Parse(birthdayLayout, value)
+	if err != nil {
+		return nil, apperror.InvalidArgument("invalid birthday", apperror.FieldViolation{
+			Field:       "birthday",
+			Description: "must be a date in YYYY-MM-DD format",
+		})
+	}
+	return &birthday, nil
+}
+
+func formatBirthday(birthday *time.Time) string {
+	if birthday == nil {
+		return ""
+	}
+	return birthday.Format(birthdayLayout)
+}
+
+func optionalUUIDString(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
+func optionalString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func mapLoyaltyTransactionToProto(t *model.LoyaltyTransaction) *customerv1.LoyaltyTransaction {
+	var sourceOrderID string
+	if t.SourceOrderID != nil {
+		sourceOrderID = *t.SourceOrderID
+	}
+	return &customerv1.LoyaltyTransaction{
+		Id:            t.ID.String(),
+		CustomerId:    t.CustomerID.String(),
+		Type:          string(t.Type),
+		SourceOrderId: sourceOrderID,
+		Delta:         t.Delta,
+		BalanceAfter:  t.BalanceAfter,
+		Actor:         t.Actor,
+		Reason:        t.Reason,
+		CreatedAt:     timestamppb.New(t.CreatedAt),
+	}
+}
+
+func mapLoyaltyHoldToProto(h *model.LoyaltyHold) *customerv1.LoyaltyHold {
+	var orderID string
+	if h.OrderID != nil {
+		orderID = *h.OrderID
+	}
+	return &customerv1.LoyaltyHold{
+		Id:         h.ID.String(),
+		CustomerId: h.CustomerID.String(),
+		OrderId:    orderID,
+		Points:     h.Points,
+		Status:     string(h.Status),
+		ExpiresAt:  timestamppb.New(h.ExpiresAt),
+		CreatedAt:  timestamppb.New(h.CreatedAt),
+	}
+}
+
+func mapLoyaltyProgramToProto(p *model.LoyaltyProgram) *customerv1.LoyaltyProgram {
+	res := &customerv1.LoyaltyProgram{
+		MerchantId:        p.MerchantID.String(),
+		Enabled:           p.Enabled,
+		Currency:          p.Currency,
+		PointsPerUnit:     p.PointsPerUnit,
+		RoundingMode:      string(p.RoundingMode),
+		MinOrderAmount:    p.MinOrderAmount,
+		MaxPointsPerOrder: p.MaxPointsPerOrder,
+		TierBasis:         string(p.TierBasis),
+		TierWindowDays:    p.TierWindowDays,
+		ExpiryPolicy:      string(p.ExpiryPolicy),
+		ExpiryMonths:      p.ExpiryMonths,
+	}
+	if !p.UpdatedAt.IsZero() {
+		res.UpdatedAt = timestamppb.New(p.UpdatedAt)
+	}
+	return res
+}
+
+func mapMerchantSettingsToProto(s *model.MerchantSettings) *customerv1.MerchantSettings {
+	res := &customerv1.MerchantSettings{
+		MerchantId:   s.MerchantID.String(),
+		PhoneCountry: s.PhoneCountry,
+	}
+	if !s.UpdatedAt.IsZero() {
+		res.UpdatedAt = timestamppb.New(s.UpdatedAt)
+	}
+	return res
+}
+
+func mapLoyaltyTierToProto(t *model.LoyaltyTier) *customerv1.LoyaltyTier {
+	return &customerv1.LoyaltyTier{
+		Id:             t.ID.String(),
+		Name:           t.Name,
+		Threshold:      t.Threshold,
+		EarnMultiplier: t.EarnMultiplier,
+	}
+}
+
+func mapCustomerSegmentToProto(s *model.CustomerSegment) *customerv1.CustomerSegment {
+	pb := &customerv1.CustomerSegment{
+		Id:          s.ID.String(),
+		Name:        s.Name,
+		Description: s.Description,
+		MemberCount: s.MemberCount,
+		CreatedAt:   timestamppb.New(s.CreatedAt),
+		UpdatedAt:   timestamppb.New(s.UpdatedAt),
+	}
+	for _, r := range s.Rules {
+		pb.Rules = append(pb.Rules, &customerv1.SegmentRule{
+			Field:    string(r.Field),
+			Operator: string(r.Operator),
+			Value:    r.Value,
+		})
+	}
+	if s.EvaluatedAt != nil {
+		pb.EvaluatedAt = timestamppb.New(*s.EvaluatedAt)
+	}
+	return pb
+}
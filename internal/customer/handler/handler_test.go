@@ -0,0 +1,296 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/apperror"
+	"github.com/fekuna/omnipos-customer-service/internal/auth"
+	"github.com/fekuna/omnipos-customer-service/internal/customer/repository"
+	"github.com/fekuna/omnipos-customer-service/internal/customer/usecase"
+	"github.com/fekuna/omnipos-customer-service/internal/middleware"
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/fekuna/omnipos-pkg/logger"
+	customerv1 "github.com/fekuna/omnipos-proto/gen/go/omnipos/customer/v1"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeRepository keeps customers and holds in memory and scopes every
+// lookup by merchant the way the Postgres queries do. Methods the tests do
+// not reach are left to the embedded nil interface.
+type fakeRepository struct {
+	repository.Repository
+	customers map[uuid.UUID]*model.Customer
+	holds     map[uuid.UUID]*model.LoyaltyHold
+	// listed records the options of each List call.
+	listed []model.CustomerListOptions
+}
+
+func newFakeRepository() *fakeRepository {
+	return &fakeRepository{
+		customers: make(map[uuid.UUID]*model.Customer),
+		holds:     make(map[uuid.UUID]*model.LoyaltyHold),
+	}
+}
+
+func (r *fakeRepository) customer(merchantID, id uuid.UUID, deleted bool) *model.Customer {
+	c, ok := r.customers[id]
+	if !ok || c.MerchantID != merchantID || (c.DeletedAt != nil) != deleted {
+		return nil
+	}
+	return c
+}
+
+func (r *fakeRepository) GetByID(_ context.Context, merchantID, id uuid.UUID) (*model.Customer, error) {
+	if c := r.customer(merchantID, id, false); c != nil {
+		copied := *c
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (r *fakeRepository) Update(_ context.Context, c *model.Customer, _ []model.CustomerField) error {
+	if r.customer(c.MerchantID, c.ID, false) != nil {
+		copied := *c
+		r.customers[c.ID] = &copied
+	}
+	return nil
+}
+
+func (r *fakeRepository) Delete(_ context.Context, merchantID, id uuid.UUID) error {
+	if c := r.customer(merchantID, id, false); c != nil {
+		now := time.Now()
+		c.DeletedAt = &now
+	}
+	return nil
+}
+
+func (r *fakeRepository) Restore(_ context.Context, merchantID, id uuid.UUID) (*model.Customer, error) {
+	c := r.customer(merchantID, id, true)
+	if c == nil {
+		return nil, nil
+	}
+	c.DeletedAt = nil
+	return c, nil
+}
+
+func (r *fakeRepository) List(_ context.Context, _ uuid.UUID, opts model.CustomerListOptions) (*model.CustomerPage, error) {
+	r.listed = append(r.listed, opts)
+	return &model.CustomerPage{}, nil
+}
+
+func (r *fakeRepository) RecordLoyaltyTransaction(_ context.Context, t *model.LoyaltyTransaction) (*model.LoyaltyTransaction, error) {
+	c := r.customer(t.MerchantID, t.CustomerID, false)
+	if c == nil {
+		return nil, nil
+	}
+	c.LoyaltyPoints += t.Delta
+	t.BalanceAfter = c.LoyaltyPoints
+	return t, nil
+}
+
+func (r *fakeRepository) CreateLoyaltyHold(_ context.Context, h *model.LoyaltyHold) (*model.LoyaltyHold, error) {
+	if r.customer(h.MerchantID, h.CustomerID, false) == nil {
+		return nil, nil
+	}
+	h.ID = uuid.New()
+	h.Status = model.LoyaltyHoldHeld
+	r.holds[h.ID] = h
+	return h, nil
+}
+
+func (r *fakeRepository) hold(merchantID, id uuid.UUID) *model.LoyaltyHold {
+	h, ok := r.holds[id]
+	if !ok || h.MerchantID != merchantID || h.Status != model.LoyaltyHoldHeld {
+		return nil
+	}
+	return h
+}
+
+func (r *fakeRepository) ConfirmLoyaltyHold(_ context.Context, merchantID, holdID uuid.UUID, actor string) (*model.LoyaltyTransaction, error) {
+	h := r.hold(merchantID, holdID)
+	if h == nil {
+		return nil, nil
+	}
+	h.Status = model.LoyaltyHoldConfirmed
+	return r.RecordLoyaltyTransaction(context.Background(), &model.LoyaltyTransaction{
+		MerchantID: merchantID,
+		CustomerID: h.CustomerID,
+		Type:       model.LoyaltyTransactionRedeem,
+		Delta:      -h.Points,
+		Actor:      actor,
+	})
+}
+
+func (r *fakeRepository) CancelLoyaltyHold(_ context.Context, merchantID, holdID uuid.UUID) (*model.LoyaltyHold, error) {
+	h := r.hold(merchantID, holdID)
+	if h == nil {
+		return nil, nil
+	}
+	h.Status = model.LoyaltyHoldCancelled
+	return h, nil
+}
+
+func (r *fakeRepository) ListCustomerStats(context.Context, uuid.UUID, []uuid.UUID) ([]*model.CustomerStats, error) {
+	return nil, nil
+}
+
+func (r *fakeRepository) ListCustomerTags(context.Context, []uuid.UUID) (map[uuid.UUID][]string, error) {
+	return nil, nil
+}
+
+func merchantContext(merchantID uuid.UUID) context.Context {
+	return auth.WithUserContext(context.Background(), &auth.UserContext{MerchantID: merchantID.String()})
+}
+
+// grpcCode returns the code the error interceptor would send for err.
+func grpcCode(err error) codes.Code {
+	if appErr, ok := apperror.As(err); ok {
+		return middleware.ToStatus(appErr).Code()
+	}
+	return status.Code(err)
+}
+
+// TestMerchantScoping checks that one merchant cannot reach another
+// merchant's customers or holds: each RPC must answer NotFound, exactly as
+// for an ID that does not exist, and leave the data untouched.
+func TestMerchantScoping(t *testing.T) {
+	owner, other := uuid.New(), uuid.New()
+	repo := newFakeRepository()
+
+	live := &model.Customer{ID: uuid.New(), MerchantID: owner, Name: "Ann", Phone: "+628123456789", LoyaltyPoints: 100}
+	deletedAt := time.Now()
+	deleted := &model.Customer{ID: uuid.New(), MerchantID: owner, Name: "Bob", Phone: "+628123456780", DeletedAt: &deletedAt}
+	repo.customers[live.ID] = live
+	repo.customers[deleted.ID] = deleted
+	hold := &model.LoyaltyHold{ID: uuid.New(), MerchantID: owner, CustomerID: live.ID, Points: 10, Status: model.LoyaltyHoldHeld}
+	repo.holds[hold.ID] = hold
+
+	log := logger.NewZapLogger(&logger.ZapLoggerConfig{Encoding: "console", Level: "error"})
+	h := NewCustomerHandler(usecase.NewCustomerUseCase(repo, log), log)
+
+	// The owner can see its customer, so NotFound below is due to scoping.
+	if _, err := h.GetCustomer(merchantContext(owner), &customerv1.GetCustomerRequest{Id: live.ID.String()}); err != nil {
+		t.Fatalf("GetCustomer as owner: %v", err)
+	}
+
+	customerID, holdID := live.ID.String(), hold.ID.String()
+	tests := []struct {
+		name string
+		call func(ctx context.Context) error
+	}{
+		{"GetCustomer", func(ctx context.Context) error {
+			_, err := h.GetCustomer(ctx, &customerv1.GetCustomerRequest{Id: customerID})
+			return err
+		}},
+		{"UpdateCustomer", func(ctx context.Context) error {
+			_, err := h.UpdateCustomer(ctx, &customerv1.UpdateCustomerRequest{Id: customerID, Name: "Mallory", Phone: "+628123456781"})
+			return err
+		}},
+		{"DeleteCustomer", func(ctx context.Context) error {
+			_, err := h.DeleteCustomer(ctx, &customerv1.DeleteCustomerRequest{Id: customerID})
+			return err
+		}},
+		{"RestoreCustomer", func(ctx context.Context) error {
+			_, err := h.RestoreCustomer(ctx, &customerv1.RestoreCustomerRequest{Id: deleted.ID.String()})
+			return err
+		}},
+		{"AddLoyaltyPoints", func(ctx context.Context) error {
+			_, err := h.AddLoyaltyPoints(ctx, &customerv1.AddLoyaltyPointsRequest{CustomerId: customerID, Points: 50})
+			return err
+		}},
+		{"ListLoyaltyTransactions", func(ctx context.Context) error {
+			_, err := h.ListLoyaltyTransactions(ctx, &customerv1.ListLoyaltyTransactionsRequest{CustomerId: customerID})
+			return err
+		}},
+		{"RedeemLoyaltyPoints", func(ctx context.Context) error {
+			_, err := h.RedeemLoyaltyPoints(ctx, &customerv1.RedeemLoyaltyPointsRequest{CustomerId: customerID, Points: 50})
+			return err
+		}},
+		{"HoldLoyaltyPoints", func(ctx context.Context) error {
+			_, err := h.HoldLoyaltyPoints(ctx, &customerv1.HoldLoyaltyPointsRequest{CustomerId: customerID, Points: 50})
+			return err
+		}},
+		{"ConfirmLoyaltyHold", func(ctx context.Context) error {
+			_, err := h.ConfirmLoyaltyHold(ctx, &customerv1.ConfirmLoyaltyHoldRequest{HoldId: holdID})
+			return err
+		}},
+		{"CancelLoyaltyHold", func(ctx context.Context) error {
+			_, err := h.CancelLoyaltyHold(ctx, &customerv1.CancelLoyaltyHoldRequest{HoldId: holdID})
+			return err
+		}},
+		{"ListCustomerTierHistory", func(ctx context.Context) error {
+			_, err := h.ListCustomerTierHistory(ctx, &customerv1.ListCustomerTierHistoryRequest{CustomerId: customerID})
+			return err
+		}},
+		{"ListUpcomingExpirations", func(ctx context.Context) error {
+			_, err := h.ListUpcomingExpirations(ctx, &customerv1.ListUpcomingExpirationsRequest{CustomerId: customerID})
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := grpcCode(tt.call(merchantContext(other))); code != codes.NotFound {
+				t.Errorf("as another merchant: got %v, want NotFound", code)
+			}
+		})
+	}
+
+	if live.Name != "Ann" || live.DeletedAt != nil || live.LoyaltyPoints != 100 {
+		t.Errorf("customer changed by another merchant: %+v", live)
+	}
+	if deleted.DeletedAt == nil {
+		t.Error("deleted customer restored by another merchant")
+	}
+	if hold.Status != model.LoyaltyHoldHeld {
+		t.Errorf("hold status = %s, want held", hold.Status)
+	}
+}
+
+func TestListCustomersSortOrder(t *testing.T) {
+	tests := []struct {
+		name           string
+		req            *customerv1.ListCustomersRequest
+		wantSortBy     model.CustomerSortKey
+		wantDescending bool
+		wantCode       codes.Code
+	}{
+		{name: "defaults", req: &customerv1.ListCustomersRequest{}, wantSortBy: model.SortByCreatedAt, wantDescending: true},
+		{name: "ascending default key", req: &customerv1.ListCustomersRequest{SortOrder: "asc"}, wantSortBy: model.SortByCreatedAt},
+		{name: "search defaults", req: &customerv1.ListCustomersRequest{Search: "ann"}, wantSortBy: model.SortByRelevance, wantDescending: true},
+		{name: "ascending", req: &customerv1.ListCustomersRequest{SortBy: "name", SortOrder: "asc"}, wantSortBy: model.SortByName},
+		{name: "descending", req: &customerv1.ListCustomersRequest{SortBy: "name", SortOrder: "desc"}, wantSortBy: model.SortByName, wantDescending: true},
+		{name: "unknown order", req: &customerv1.ListCustomersRequest{SortOrder: "ascending"}, wantCode: codes.InvalidArgument},
+		{name: "upper case order", req: &customerv1.ListCustomersRequest{SortOrder: "ASC"}, wantCode: codes.InvalidArgument},
+	}
+
+	log := logger.NewZapLogger(&logger.ZapLoggerConfig{Encoding: "console", Level: "error"})
+	merchant := uuid.New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeRepository()
+			h := NewCustomerHandler(usecase.NewCustomerUseCase(repo, log), log)
+			_, err := h.ListCustomers(merchantContext(merchant), tt.req)
+			if code := grpcCode(err); code != tt.wantCode {
+				t.Fatalf("got %v (%v), want %v", code, err, tt.wantCode)
+			}
+			if tt.wantCode != codes.OK {
+				if len(repo.listed) != 0 {
+					t.Error("invalid request reached the repository")
+				}
+				return
+			}
+			if len(repo.listed) != 1 {
+				t.Fatalf("List called %d times, want 1", len(repo.listed))
+			}
+			opts := repo.listed[0]
+			if opts.SortBy != tt.wantSortBy || opts.Descending != tt.wantDescending {
+				t.Errorf("sorted by %s descending=%v, want %s descending=%v", opts.SortBy, opts.Descending, tt.wantSortBy, tt.wantDescending)
+			}
+		})
+	}
+}
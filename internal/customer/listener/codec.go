@@ -0,0 +1,253 @@
+package listener
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	orderv1 "github.com/fekuna/omnipos-proto/gen/go/omnipos/order/v1"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/proto"
+)
+
+// Headers producers set to describe the message encoding. Messages without
+// them are treated as JSON, and JSON messages may carry the version in their
+// schema_version field instead.
+const (
+	HeaderContentType   = "content-type"
+	HeaderSchemaVersion = "schema-version"
+)
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// defaultSchemaVersion is assumed for events that predate versioning.
+const defaultSchemaVersion = 1
+
+// ErrUnsupportedSchema is returned for an encoding or schema version no codec
+// is registered for.
+var ErrUnsupportedSchema = errors.New("unsupported event schema")
+
+// Codec decodes one encoding and schema version of an order event.
+type Codec interface {
+	Decode(value []byte) (*OrderEvent, error)
+}
+
+type codecKey struct {
+	contentType string
+	version     int
+}
+
+// CodecRegistry routes each message to the codec for its content type and
+// schema version.
+type CodecRegistry struct {
+	codecs map[codecKey]Codec
+}
+
+// NewCodecRegistry returns a registry with the JSON and Protobuf v1 codecs.
+func NewCodecRegistry() *CodecRegistry {
+	r := &CodecRegistry{codecs: make(map[codecKey]Codec)}
+	r.Register(ContentTypeJSON, 1, jsonCodecV1{})
+	r.Register(ContentTypeJSON, 2, jsonCodecV2{})
+	r.Register(ContentTypeProtobuf, 1, protobufCodecV1{})
+	return r
+}
+
+func (r *CodecRegistry) Register(contentType string, version int, codec Codec) {
+	r.codecs[codecKey{contentType: contentType, version: version}] = codec
+}
+
+// Decode picks a codec from the message headers and decodes msg. Unsupported
+// schemas and malformed payloads are permanent errors, so they are
+// dead-lettered instead of retried.
+func (r *CodecRegistry) Decode(msg kafka.Message) (*OrderEvent, error) {
+	contentType := ContentTypeJSON
+	version := 0
+	for _, h := range msg.Headers {
+		switch h.Key {
+		case HeaderContentType:
+			contentType = string(h.Value)
+		case HeaderSchemaVersion:
+			v, err := strconv.Atoi(string(h.Value))
+			if err != nil {
+				return nil, permanent(fmt.Errorf("%w: schema version %q", ErrUnsupportedSchema, h.Value))
+			}
+			version = v
+		}
+	}
+
+	if version == 0 && contentType == ContentTypeJSON {
+		var probe struct {
+			SchemaVersion int `json:"schema_version"`
+		}
+		if err := json.Unmarshal(msg.Value, &probe); err != nil {
+			return nil, permanent(fmt.Errorf("unmarshal event: %w", err))
+		}
+		version = probe.SchemaVersion
+	}
+	if version == 0 {
+		version = defaultSchemaVersion
+	}
+
+	codec, ok := r.codecs[codecKey{contentType: contentType, version: version}]
+	if !ok {
+		return nil, permanent(fmt.Errorf("%w: %s version %d", ErrUnsupportedSchema, contentType, version))
+	}
+	event, err := codec.Decode(msg.Value)
+	if err != nil {
+		return nil, permanent(fmt.Errorf("decode %s version %d event: %w", contentType, version, err))
+	}
+	return event, nil
+}
+
+// jsonCodecV1 decodes the original JSON events, whose amounts are
+// major-unit numbers. Unknown fields are ignored.
+type jsonCodecV1 struct{}
+
+type orderEventJSONV1 struct {
+	EventID   string    `json:"event_id"`
+	EventType string    `json:"event_type"`
+	Timestamp time.Time `json:"timestamp"`
+	Payload   struct {
+		ID           string       `json:"id"`
+		MerchantID   string       `json:"merchant_id"`
+		CustomerID   *string      `json:"customer_id"`
+		StoreID      *string      `json:"store_id"`
+		TotalAmount  json.Number  `json:"total_amount"`
+		Currency     string       `json:"currency"`
+		RefundID     string       `json:"refund_id"`
+		RefundAmount *json.Number `json:"refund_amount"`
+	} `json:"payload"`
+}
+
+func (jsonCodecV1) Decode(value []byte) (*OrderEvent, error) {
+	var wire orderEventJSONV1
+	if err := json.Unmarshal(value, &wire); err != nil {
+		return nil, err
+	}
+
+	event := &OrderEvent{
+		EventID:       wire.EventID,
+		EventType:     wire.EventType,
+		SchemaVersion: 1,
+		Timestamp:     wire.Timestamp,
+		Payload: OrderPayload{
+			ID:         wire.Payload.ID,
+			MerchantID: wire.Payload.MerchantID,
+			CustomerID: wire.Payload.CustomerID,
+			StoreID:    wire.Payload.StoreID,
+			RefundID:   wire.Payload.RefundID,
+		},
+	}
+	total := wire.Payload.TotalAmount.String()
+	if total == "" {
+		total = "0"
+	}
+	var refund *string
+	if wire.Payload.RefundAmount != nil {
+		r := wire.Payload.RefundAmount.String()
+		refund = &r
+	}
+	if err := event.Payload.setMajorAmounts(wire.Payload.Currency, total, refund); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// jsonCodecV2 decodes JSON events whose amounts are objects of integer minor
+// units and an ISO 4217 currency, e.g. {"amount": 2999, "currency": "USD"}.
+type jsonCodecV2 struct{}
+
+type orderEventJSONV2 struct {
+	EventID   string    `json:"event_id"`
+	EventType string    `json:"event_type"`
+	Timestamp time.Time `json:"timestamp"`
+	Payload   struct {
+		ID           string       `json:"id"`
+		MerchantID   string       `json:"merchant_id"`
+		CustomerID   *string      `json:"customer_id"`
+		StoreID      *string      `json:"store_id"`
+		TotalAmount  model.Money  `json:"total_amount"`
+		RefundID     string       `json:"refund_id"`
+		RefundAmount *model.Money `json:"refund_amount"`
+	} `json:"payload"`
+}
+
+func (jsonCodecV2) Decode(value []byte) (*OrderEvent, error) {
+	var wire orderEventJSONV2
+	if err := json.Unmarshal(value, &wire); err != nil {
+		return nil, err
+	}
+	if _, err := model.CurrencyExponent(wire.Payload.TotalAmount.Currency); err != nil {
+		return nil, err
+	}
+	if refund := wire.Payload.RefundAmount; refund != nil {
+		if _, err := model.CurrencyExponent(refund.Currency); err != nil {
+			return nil, fmt.Errorf("refund amount: %w", err)
+		}
+	}
+	return &OrderEvent{
+		EventID:       wire.EventID,
+		EventType:     wire.EventType,
+		SchemaVersion: 2,
+		Timestamp:     wire.Timestamp,
+		Payload: OrderPayload{
+			ID:           wire.Payload.ID,
+			MerchantID:   wire.Payload.MerchantID,
+			CustomerID:   wire.Payload.CustomerID,
+			StoreID:      wire.Payload.StoreID,
+			TotalAmount:  wire.Payload.TotalAmount,
+			RefundID:     wire.Payload.RefundID,
+			RefundAmount: wire.Payload.RefundAmount,
+		},
+	}, nil
+}
+
+// protobufCodecV1 decodes omnipos.order.v1.OrderEvent. Unknown fields are
+// skipped by the Protobuf runtime.
+type protobufCodecV1 struct{}
+
+func (protobufCodecV1) Decode(value []byte) (*OrderEvent, error) {
+	var pb orderv1.OrderEvent
+	if err := proto.Unmarshal(value, &pb); err != nil {
+		return nil, err
+	}
+
+	payload := pb.GetPayload()
+	if payload == nil {
+		return nil, errors.New("missing payload")
+	}
+	event := &OrderEvent{
+		EventID:       pb.GetEventId(),
+		EventType:     pb.GetEventType(),
+		SchemaVersion: int(pb.GetSchemaVersion()),
+		Payload: OrderPayload{
+			ID:         payload.GetId(),
+			MerchantID: payload.GetMerchantId(),
+			CustomerID: payload.CustomerId,
+			StoreID:    payload.StoreId,
+			RefundID:   payload.GetRefundId(),
+		},
+	}
+	if ts := pb.GetTimestamp(); ts != nil {
+		event.Timestamp = ts.AsTime()
+	}
+
+	// The v1 message carries doubles; their shortest decimal form is what
+	// the producer meant.
+	total := strconv.FormatFloat(payload.GetTotalAmount(), 'f', -1, 64)
+	var refund *string
+	if payload.RefundAmount != nil {
+		r := strconv.FormatFloat(*payload.RefundAmount, 'f', -1, 64)
+		refund = &r
+	}
+	if err := event.Payload.setMajorAmounts(payload.GetCurrency(), total, refund); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
@@ -0,0 +1,53 @@
+package listener
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestCodecRegistryV2Amounts(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		wantErr bool
+	}{
+		{
+			name:    "total and refund",
+			payload: `"total_amount":{"amount":10000,"currency":"IDR"},"refund_amount":{"amount":2500,"currency":"IDR"}`,
+		},
+		{
+			name:    "total only",
+			payload: `"total_amount":{"amount":10000,"currency":"IDR"}`,
+		},
+		{
+			name:    "unsupported total currency",
+			payload: `"total_amount":{"amount":10000,"currency":"XXX"}`,
+			wantErr: true,
+		},
+		{
+			name:    "refund without currency",
+			payload: `"total_amount":{"amount":10000,"currency":"IDR"},"refund_amount":{"amount":2500}`,
+			wantErr: true,
+		},
+		{
+			name:    "unsupported refund currency",
+			payload: `"total_amount":{"amount":10000,"currency":"IDR"},"refund_amount":{"amount":2500,"currency":"XXX"}`,
+			wantErr: true,
+		},
+	}
+	registry := NewCodecRegistry()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := kafka.Message{Value: []byte(`{"event_id":"evt-1","event_type":"OrderRefunded","schema_version":2,` +
+				`"payload":{"id":"order-1","merchant_id":"merchant","customer_id":"customer",` + tt.payload + `}}`)}
+			_, err := registry.Decode(msg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !isPermanent(err) {
+				t.Errorf("Decode error %v is not permanent", err)
+			}
+		})
+	}
+}
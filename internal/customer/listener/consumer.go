@@ -0,0 +1,27 @@
+package listener
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Consumer fetches messages without committing them, so the listener can
+// commit offsets only once a message has been handled.
+type Consumer interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// NewKafkaConsumer creates a consumer group reader with auto-commit disabled.
+func NewKafkaConsumer(brokers []string, topic, groupID string) *kafka.Reader {
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers: brokers,
+		Topic:   topic,
+		GroupID: groupID,
+		// Zero commits synchronously on CommitMessages instead of in the
+		// background.
+		CommitInterval: 0,
+	})
+}
@@ -0,0 +1,74 @@
+package listener
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers attached to dead-lettered messages.
+const (
+	HeaderDLQError             = "x-dlq-error"
+	HeaderDLQAttempts          = "x-dlq-attempts"
+	HeaderDLQFailedAt          = "x-dlq-failed-at"
+	HeaderDLQOriginalTopic     = "x-dlq-original-topic"
+	HeaderDLQOriginalPartition = "x-dlq-original-partition"
+	HeaderDLQOriginalOffset    = "x-dlq-original-offset"
+)
+
+// DeadLetterPublisher receives messages that could not be processed.
+type DeadLetterPublisher interface {
+	Publish(ctx context.Context, msg kafka.Message, cause error, attempts int) error
+}
+
+// KafkaDeadLetterPublisher writes failed messages to a dead-letter topic,
+// keeping the original key, value and headers.
+type KafkaDeadLetterPublisher struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaDeadLetterPublisher(brokers []string, topic string) *KafkaDeadLetterPublisher {
+	return &KafkaDeadLetterPublisher{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+		},
+	}
+}
+
+func (p *KafkaDeadLetterPublisher) Publish(ctx context.Context, msg kafka.Message, cause error, attempts int) error {
+	headers := append([]kafka.Header{}, msg.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderDLQError, Value: []byte(cause.Error())},
+		kafka.Header{Key: HeaderDLQAttempts, Value: []byte(strconv.Itoa(attempts))},
+		kafka.Header{Key: HeaderDLQFailedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339))},
+		kafka.Header{Key: HeaderDLQOriginalTopic, Value: []byte(msg.Topic)},
+		kafka.Header{Key: HeaderDLQOriginalPartition, Value: []byte(strconv.Itoa(msg.Partition))},
+		kafka.Header{Key: HeaderDLQOriginalOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+	)
+
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	})
+}
+
+func (p *KafkaDeadLetterPublisher) Close() error {
+	return p.writer.Close()
+}
+
+// IsDeadLetterHeader reports whether a header was added by the dead-letter
+// publisher.
+func IsDeadLetterHeader(key string) bool {
+	switch key {
+	case HeaderDLQError, HeaderDLQAttempts, HeaderDLQFailedAt,
+		HeaderDLQOriginalTopic, HeaderDLQOriginalPartition, HeaderDLQOriginalOffset:
+		return true
+	}
+	return false
+}
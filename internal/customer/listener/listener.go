@@ -2,104 +2,411 @@ package listener
 
 import (
 	"context"
-	"encoding/json"
-	"math"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/fekuna/omnipos-customer-service/internal/customer/usecase"
-	"github.com/fekuna/omnipos-pkg/broker"
+	"github.com/fekuna/omnipos-customer-service/internal/model"
 	"github.com/fekuna/omnipos-pkg/logger"
+	"github.com/segmentio/kafka-go"
 	"go.uber.org/zap"
 )
 
 type CustomerListener struct {
-	consumer *broker.KafkaConsumer
+	consumer Consumer
 	uc       usecase.UseCase
 	logger   logger.ZapLogger
+	dlq      DeadLetterPublisher
+	opts     Options
 }
 
-func NewCustomerListener(consumer *broker.KafkaConsumer, uc usecase.UseCase, logger logger.ZapLogger) *CustomerListener {
+// Options tunes how the listener processes events.
+type Options struct {
+	Retry RetryPolicy
+	// Workers is the number of goroutines applying events concurrently.
+	Workers int
+	// QueueSize is how many messages each worker buffers before fetching
+	// blocks.
+	QueueSize int
+	// Codecs decodes message values. Defaults to NewCodecRegistry.
+	Codecs *CodecRegistry
+}
+
+func NewCustomerListener(consumer Consumer, uc usecase.UseCase, logger logger.ZapLogger, dlq DeadLetterPublisher, opts Options) *CustomerListener {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.QueueSize < 0 {
+		opts.QueueSize = 0
+	}
+	if opts.Codecs == nil {
+		opts.Codecs = NewCodecRegistry()
+	}
 	return &CustomerListener{
 		consumer: consumer,
 		uc:       uc,
 		logger:   logger,
+		dlq:      dlq,
+		opts:     opts,
 	}
 }
 
-func (l *CustomerListener) Start(ctx context.Context) {
-	l.logger.Info("Starting Customer Kafka Listener")
+// Start fetches messages and fans them out to a pool of workers keyed by
+// message key. It returns once ctx is done and every worker has finished the
+// message it was processing; queued messages that were not started stay
+// uncommitted and are redelivered. Messages are processed and committed under
+// drain, so cancelling it once the shutdown deadline passes cuts short the
+// messages still in flight, which are then redelivered as well.
+func (l *CustomerListener) Start(ctx, drain context.Context) {
+	l.logger.Info("Starting Customer Kafka Listener", zap.Int("workers", l.opts.Workers))
+
+	tracker := newOffsetTracker()
+	queues := make([]chan kafka.Message, l.opts.Workers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan kafka.Message, l.opts.QueueSize)
+		wg.Add(1)
+		go func(queue <-chan kafka.Message) {
+			defer wg.Done()
+			l.work(ctx, drain, queue, tracker)
+		}(queues[i])
+	}
+
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		wg.Wait()
+		l.logger.Info("Stopped Customer Kafka Listener")
+	}()
+
 	for {
 		select {
 		case <-ctx.Done():
 			l.logger.Info("Stopping Customer Kafka Listener")
 			return
 		default:
-			msg, err := l.consumer.ReadMessage(ctx)
-			if err != nil {
-				if ctx.Err() != nil {
-					return
-				}
-				l.logger.Error("Failed to read kafka message", zap.Error(err))
-				time.Sleep(1 * time.Second)
-				continue
+		}
+
+		msg, err := l.consumer.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
 			}
-			l.processMessage(ctx, msg.Value)
+			l.logger.Error("Failed to fetch kafka message", zap.Error(err))
+			time.Sleep(1 * time.Second)
+			continue
+		}
+
+		tracker.track(msg)
+		// Blocks while the worker's queue is full, which stops fetching
+		// until the pool catches up.
+		select {
+		case queues[workerFor(msg, len(queues))] <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// work handles messages from queue until it is closed. Once ctx is done the
+// remaining queued messages are skipped rather than processed.
+func (l *CustomerListener) work(ctx, drain context.Context, queue <-chan kafka.Message, tracker *offsetTracker) {
+	for msg := range queue {
+		if ctx.Err() != nil {
+			continue
+		}
+		if err := l.handleMessage(ctx, drain, msg); err != nil {
+			// Leave the offset uncommitted so the message is redelivered.
+			continue
+		}
+		// The event has been applied, so commit even if shutdown started
+		// while it was being processed.
+		if err := tracker.complete(drain, msg, l.commit); err != nil {
+			l.logger.Error("Failed to commit kafka offset",
+				zap.Int("partition", msg.Partition),
+				zap.Int64("offset", msg.Offset),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+func (l *CustomerListener) commit(ctx context.Context, msg kafka.Message) error {
+	return l.consumer.CommitMessages(ctx, msg)
+}
+
+// handleMessage processes msg, retrying transient failures with exponential
+// backoff. Messages that fail permanently or exhaust their retries are
+// published to the dead-letter topic. A nil return means the offset can be
+// committed; an error is only returned once ctx is done, or drain is
+// cancelled during an attempt.
+func (l *CustomerListener) handleMessage(ctx, drain context.Context, msg kafka.Message) error {
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		// Let an in-flight attempt finish its database work on shutdown,
+		// unless the deadline passes; only the backoff between attempts is
+		// interrupted.
+		err = l.processMessage(drain, msg)
+		if err == nil {
+			return nil
+		}
+		if drain.Err() != nil {
+			return err
+		}
+		if isPermanent(err) || attempt >= l.opts.Retry.MaxAttempts {
+			break
+		}
+
+		backoff := l.opts.Retry.Backoff(attempt)
+		l.logger.Warn("Retrying kafka message",
+			zap.Int64("offset", msg.Offset),
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", backoff),
+			zap.Error(err),
+		)
+		if sleepErr := sleep(ctx, backoff); sleepErr != nil {
+			return sleepErr
 		}
 	}
+
+	l.logger.Error("Dead-lettering kafka message",
+		zap.Int("partition", msg.Partition),
+		zap.Int64("offset", msg.Offset),
+		zap.Int("attempts", attempt),
+		zap.Error(err),
+	)
+	return l.deadLetter(ctx, msg, err, attempt)
 }
 
-type OrderCreatedEvent struct {
-	EventID   string       `json:"event_id"`
-	EventType string       `json:"event_type"`
-	Payload   OrderPayload `json:"payload"`
-	Timestamp time.Time    `json:"timestamp"`
+// deadLetter publishes msg to the dead-letter topic, retrying until it
+// succeeds or ctx is done. The offset must not be committed before the
+// message is safely stored somewhere.
+func (l *CustomerListener) deadLetter(ctx context.Context, msg kafka.Message, cause error, attempts int) error {
+	for retry := 1; ; retry++ {
+		err := l.dlq.Publish(ctx, msg, cause, attempts)
+		if err == nil {
+			return nil
+		}
+		l.logger.Error("Failed to publish to dead-letter topic", zap.Int64("offset", msg.Offset), zap.Error(err))
+		if sleepErr := sleep(ctx, l.opts.Retry.Backoff(retry)); sleepErr != nil {
+			return sleepErr
+		}
+	}
+}
+
+// Order event types consumed from the orders topic.
+const (
+	EventOrderCreated   = "OrderCreated"
+	EventOrderCancelled = "OrderCancelled"
+	EventOrderRefunded  = "OrderRefunded"
+)
+
+// OrderEvent is the decoded form of an order event, whatever its wire
+// encoding. See CodecRegistry.
+type OrderEvent struct {
+	EventID       string
+	EventType     string
+	SchemaVersion int
+	Payload       OrderPayload
+	Timestamp     time.Time
 }
 
 type OrderPayload struct {
-	ID          string  `json:"id"`
-	CustomerID  *string `json:"customer_id"`
-	TotalAmount float64 `json:"total_amount"`
+	ID string
+	// MerchantID scopes every write the event causes, and producers must
+	// set it. Events from producers that predate it are attributed to the
+	// customer's merchant by resolveMerchant.
+	MerchantID  string
+	CustomerID  *string
+	StoreID     *string
+	TotalAmount model.Money
+	// Set on OrderRefunded only. A refund without an amount is treated as a
+	// full refund.
+	RefundID     string
+	RefundAmount *model.Money
+
+	// Older producers send major-unit amounts without a currency. Those are
+	// kept as decimals until resolveAmounts converts them in the merchant's
+	// program currency.
+	legacy       bool
+	legacyTotal  string
+	legacyRefund *string
+}
+
+// setMajorAmounts fills in the payload amounts from major-unit decimals.
+func (p *OrderPayload) setMajorAmounts(currency, total string, refund *string) error {
+	if currency == "" {
+		p.legacy = true
+		p.legacyTotal = total
+		p.legacyRefund = refund
+		return nil
+	}
+	var err error
+	if p.TotalAmount, err = model.ParseMoney(total, currency); err != nil {
+		return err
+	}
+	if refund != nil {
+		amount, err := model.ParseMoney(*refund, currency)
+		if err != nil {
+			return err
+		}
+		p.RefundAmount = &amount
+	}
+	return nil
+}
+
+// resolveMerchant fills in the merchant of events that carry none from the
+// customer's own record. An unknown customer is a permanent failure.
+func (l *CustomerListener) resolveMerchant(ctx context.Context, p *OrderPayload) error {
+	if p.MerchantID != "" {
+		return nil
+	}
+	merchantID, err := l.uc.CustomerMerchant(ctx, *p.CustomerID)
+	if err != nil {
+		return err
+	}
+	l.logger.Warn("Order event without merchant_id, using the customer's merchant",
+		zap.String("order_id", p.ID),
+		zap.String("customer_id", *p.CustomerID),
+		zap.String("merchant_id", merchantID),
+	)
+	p.MerchantID = merchantID
+	return nil
 }
 
-func (l *CustomerListener) processMessage(ctx context.Context, value []byte) {
-	var event OrderCreatedEvent
-	if err := json.Unmarshal(value, &event); err != nil {
-		l.logger.Error("Failed to unmarshal event", zap.Error(err))
-		return
+// resolveAmounts converts legacy amounts using the merchant's program
+// currency.
+func (l *CustomerListener) resolveAmounts(ctx context.Context, p *OrderPayload) error {
+	if !p.legacy {
+		return nil
+	}
+	program, err := l.uc.GetLoyaltyProgram(ctx, p.MerchantID)
+	if err != nil {
+		return err
+	}
+	p.legacy = false
+	if err := p.setMajorAmounts(program.Currency, p.legacyTotal, p.legacyRefund); err != nil {
+		return permanent(fmt.Errorf("convert legacy amounts: %w", err))
 	}
+	return nil
+}
 
-	if event.EventType != "OrderCreated" {
-		return
+// processMessage applies a single order event. Errors that retrying cannot
+// fix are marked permanent.
+func (l *CustomerListener) processMessage(ctx context.Context, msg kafka.Message) error {
+	event, err := l.opts.Codecs.Decode(msg)
+	if err != nil {
+		return err
+	}
+
+	switch event.EventType {
+	case EventOrderCreated, EventOrderCancelled, EventOrderRefunded:
+	default:
+		return nil
 	}
 
 	if event.Payload.CustomerID == nil || *event.Payload.CustomerID == "" {
-		// Guest order, no loyalty points
-		return
+		// Guest order, no loyalty points or statistics
+		return nil
 	}
 
-	l.logger.Info("Processing OrderCreated event for Loyalty", zap.String("order_id", event.Payload.ID), zap.String("customer_id", *event.Payload.CustomerID))
+	if err := l.resolveMerchant(ctx, &event.Payload); err != nil {
+		return err
+	}
+	if err := l.resolveAmounts(ctx, &event.Payload); err != nil {
+		return err
+	}
 
-	// Calculate Points: 1 point per 10 currency units (e.g. $10 -> 1 point, or Rp10,000 -> 1 point)
-	// Let's assume the currency is dollars for simplicity based on earlier products ($999).
-	// If OmniPOS assumes base integer currency (cents), it handles float64.
-	// Earlier products: BasePrice=999. So it's likely dollars/units.
-	// 1 point per $10 spent.
-	points := int32(math.Floor(event.Payload.TotalAmount / 10.0))
+	l.logger.Info("Processing order event for Loyalty",
+		zap.String("event_type", event.EventType),
+		zap.String("order_id", event.Payload.ID),
+		zap.String("merchant_id", event.Payload.MerchantID),
+		zap.String("customer_id", *event.Payload.CustomerID),
+	)
 
-	if points > 0 {
-		_, err := l.uc.AddLoyaltyPoints(ctx, *event.Payload.CustomerID, points)
-		if err != nil {
-			l.logger.Error("Failed to add loyalty points",
-				zap.String("customer_id", *event.Payload.CustomerID),
-				zap.Int32("points", points),
-				zap.Error(err),
-			)
-			// TODO: Retry mechanism or DLQ
-		} else {
-			l.logger.Info("Loyalty points added",
-				zap.String("customer_id", *event.Payload.CustomerID),
-				zap.Int32("points", points),
-			)
+	var t *model.LoyaltyTransaction
+	switch event.EventType {
+	case EventOrderCreated:
+		// Points are computed from the merchant's loyalty program.
+		t, err = l.uc.EarnLoyaltyPoints(ctx, eventKey(event), event.Payload.MerchantID, *event.Payload.CustomerID, event.Payload.ID, event.Payload.TotalAmount)
+	case EventOrderCancelled:
+		t, err = l.uc.ReverseOrderPoints(ctx, eventKey(event), event.EventType, event.Payload.MerchantID, *event.Payload.CustomerID, event.Payload.ID, nil)
+	case EventOrderRefunded:
+		t, err = l.uc.ReverseOrderPoints(ctx, eventKey(event), event.EventType, event.Payload.MerchantID, *event.Payload.CustomerID, event.Payload.ID, event.Payload.RefundAmount)
+	}
+
+	if errors.Is(err, usecase.ErrEventAlreadyProcessed) {
+		l.logger.Info("Skipping already processed event",
+			zap.String("event_id", eventKey(event)),
+			zap.String("order_id", event.Payload.ID),
+		)
+	} else if err != nil {
+		l.logger.Error("Failed to apply loyalty points",
+			zap.String("event_type", event.EventType),
+			zap.String("customer_id", *event.Payload.CustomerID),
+			zap.Int64("total_amount", event.Payload.TotalAmount.Amount),
+			zap.String("currency", event.Payload.TotalAmount.Currency),
+			zap.Error(err),
+		)
+		return err
+	} else if t != nil {
+		l.logger.Info("Loyalty points applied",
+			zap.String("event_type", event.EventType),
+			zap.String("customer_id", *event.Payload.CustomerID),
+			zap.Int32("points", t.Delta),
+			zap.Int32("balance", t.BalanceAfter),
+		)
+	}
+
+	return l.updateStats(ctx, event)
+}
+
+// updateStats folds the event into the customer's statistics. It is
+// deduplicated separately from the loyalty award, so it also runs for
+// events whose points were already applied.
+func (l *CustomerListener) updateStats(ctx context.Context, event *OrderEvent) error {
+	p := &event.Payload
+	var err error
+	switch event.EventType {
+	case EventOrderCreated:
+		orderedAt := event.Timestamp
+		if orderedAt.IsZero() {
+			orderedAt = time.Now()
 		}
+		err = l.uc.RecordCustomerOrder(ctx, eventKey(event), p.MerchantID, *p.CustomerID, p.ID, p.StoreID, p.TotalAmount, orderedAt)
+	case EventOrderCancelled:
+		err = l.uc.CancelCustomerOrder(ctx, eventKey(event), p.MerchantID, *p.CustomerID, p.ID)
+	case EventOrderRefunded:
+		err = l.uc.RecordCustomerOrderRefund(ctx, eventKey(event), p.MerchantID, *p.CustomerID, p.ID, p.RefundAmount)
+	}
+	if errors.Is(err, usecase.ErrEventAlreadyProcessed) {
+		return nil
+	}
+	if err != nil {
+		l.logger.Error("Failed to update customer statistics",
+			zap.String("event_type", event.EventType),
+			zap.String("customer_id", *p.CustomerID),
+			zap.Error(err),
+		)
+		return err
+	}
+	return nil
+}
+
+// eventKey identifies an event for deduplication. Producers that predate
+// event IDs are keyed by event type and order ID (plus refund ID, since an
+// order can be refunded more than once) instead.
+func eventKey(event *OrderEvent) string {
+	if event.EventID != "" {
+		return event.EventID
+	}
+	key := event.EventType + ":" + event.Payload.ID
+	if event.Payload.RefundID != "" {
+		key += ":" + event.Payload.RefundID
 	}
+	return key
 }
@@ -0,0 +1,302 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/apperror"
+	"github.com/fekuna/omnipos-customer-service/internal/customer/usecase"
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/fekuna/omnipos-pkg/logger"
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeConsumer serves a single-partition log starting at offset 0. Like a
+// consumer group member after a restart, a new session resumes after the
+// last committed offset.
+type fakeConsumer struct {
+	mu      sync.Mutex
+	log     []kafka.Message
+	next    int
+	commits []int64
+}
+
+func newFakeConsumer(msgs ...kafka.Message) *fakeConsumer {
+	for i := range msgs {
+		msgs[i].Offset = int64(i)
+	}
+	return &fakeConsumer{log: msgs}
+}
+
+func (c *fakeConsumer) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	c.mu.Lock()
+	if c.next < len(c.log) {
+		msg := c.log[c.next]
+		c.next++
+		c.mu.Unlock()
+		return msg, nil
+	}
+	c.mu.Unlock()
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (c *fakeConsumer) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, msg := range msgs {
+		c.commits = append(c.commits, msg.Offset)
+	}
+	return nil
+}
+
+func (c *fakeConsumer) Close() error { return nil }
+
+// committed returns the highest committed offset, or -1.
+func (c *fakeConsumer) committed() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last := int64(-1)
+	for _, offset := range c.commits {
+		if offset > last {
+			last = offset
+		}
+	}
+	return last
+}
+
+// restart starts a new session from the committed offset.
+func (c *fakeConsumer) restart() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last := int64(-1)
+	for _, offset := range c.commits {
+		if offset > last {
+			last = offset
+		}
+	}
+	c.next = int(last + 1)
+}
+
+// fakeUseCase applies order events through earn. Methods the listener does
+// not reach for OrderCreated are left to the embedded nil interface.
+type fakeUseCase struct {
+	usecase.UseCase
+	earn func(merchantID, orderID string) error
+	// merchants maps customer IDs to their merchant.
+	merchants map[string]string
+}
+
+func (uc *fakeUseCase) EarnLoyaltyPoints(_ context.Context, _, merchantID, _, orderID string, _ model.Money) (*model.LoyaltyTransaction, error) {
+	return nil, uc.earn(merchantID, orderID)
+}
+
+func (uc *fakeUseCase) CustomerMerchant(_ context.Context, customerID string) (string, error) {
+	merchantID, ok := uc.merchants[customerID]
+	if !ok {
+		return "", apperror.NotFound("customer not found")
+	}
+	return merchantID, nil
+}
+
+func (uc *fakeUseCase) RecordCustomerOrder(context.Context, string, string, string, string, *string, model.Money, time.Time) error {
+	return nil
+}
+
+type fakeDeadLetters struct{}
+
+func (fakeDeadLetters) Publish(context.Context, kafka.Message, error, int) error { return nil }
+
+func orderCreated(key, orderID string) kafka.Message {
+	return kafka.Message{
+		Key: []byte(key),
+		Value: []byte(fmt.Sprintf(`{"event_id":"evt-%[1]s","event_type":"OrderCreated","schema_version":2,`+
+			`"payload":{"id":"%[1]s","merchant_id":"merchant","customer_id":"%[2]s","total_amount":{"amount":10000,"currency":"IDR"}}}`, orderID, key)),
+	}
+}
+
+func newTestListener(consumer Consumer, uc usecase.UseCase, workers int) *CustomerListener {
+	log := logger.NewZapLogger(&logger.ZapLoggerConfig{Encoding: "console", Level: "error"})
+	return NewCustomerListener(consumer, uc, log, fakeDeadLetters{}, Options{
+		Retry:   RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour, MaxBackoff: time.Hour},
+		Workers: workers,
+	})
+}
+
+// run starts l and returns a function that stops it and waits for Start to
+// return.
+func run(l *CustomerListener) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Start(ctx, context.Background())
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestListenerRedeliversUncommittedMessage stops the listener while an event
+// is failing, as a crash would, and checks the event is fetched and applied
+// again by the next session instead of being lost.
+func TestListenerRedeliversUncommittedMessage(t *testing.T) {
+	consumer := newFakeConsumer(orderCreated("customer", "order-1"))
+
+	var mu sync.Mutex
+	attempts := 0
+	failed := make(chan struct{})
+	uc := &fakeUseCase{earn: func(_, _ string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			close(failed)
+			return errors.New("connection reset")
+		}
+		return nil
+	}}
+
+	stop := run(newTestListener(consumer, uc, 1))
+	<-failed
+	stop()
+	if got := consumer.committed(); got != -1 {
+		t.Fatalf("committed offset %d after a failed event, want none", got)
+	}
+
+	consumer.restart()
+	stop = run(newTestListener(consumer, uc, 1))
+	waitFor(t, "offset 0 to be committed", func() bool { return consumer.committed() == 0 })
+	stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 2 {
+		t.Errorf("event applied %d times, want 2 (one failure, one redelivery)", attempts)
+	}
+}
+
+// TestListenerDoesNotCommitPastInFlightOffset holds offset 0 in one worker
+// while another worker finishes offsets 1 and 2, and checks nothing is
+// committed until offset 0 is done.
+func TestListenerDoesNotCommitPastInFlightOffset(t *testing.T) {
+	// Pick keys that land on different workers.
+	slow, fast := "customer-0", ""
+	for i := 1; fast == ""; i++ {
+		key := fmt.Sprintf("customer-%d", i)
+		if workerFor(kafka.Message{Key: []byte(key)}, 2) != workerFor(kafka.Message{Key: []byte(slow)}, 2) {
+			fast = key
+		}
+	}
+	consumer := newFakeConsumer(
+		orderCreated(slow, "order-0"),
+		orderCreated(fast, "order-1"),
+		orderCreated(fast, "order-2"),
+	)
+
+	release := make(chan struct{})
+	// The fast worker handles order-2 only after order-1 has been completed
+	// and its commit decided.
+	secondStarted := make(chan struct{})
+	uc := &fakeUseCase{earn: func(_, orderID string) error {
+		switch orderID {
+		case "order-0":
+			<-release
+		case "order-2":
+			close(secondStarted)
+		}
+		return nil
+	}}
+
+	stop := run(newTestListener(consumer, uc, 2))
+	defer stop()
+
+	<-secondStarted
+	if got := consumer.committed(); got != -1 {
+		t.Fatalf("committed offset %d while offset 0 is in flight", got)
+	}
+
+	close(release)
+	waitFor(t, "offset 2 to be committed", func() bool { return consumer.committed() == 2 })
+}
+
+// TestListenerResolvesMissingMerchant checks that events from producers that
+// predate merchant_id are applied under the customer's merchant, and that
+// those for unknown customers are dead-lettered instead of retried.
+func TestListenerResolvesMissingMerchant(t *testing.T) {
+	legacy := func(customerID, orderID string) kafka.Message {
+		return kafka.Message{
+			Key: []byte(customerID),
+			Value: []byte(`{"event_id":"evt-` + orderID + `","event_type":"OrderCreated","schema_version":2,` +
+				`"payload":{"id":"` + orderID + `","customer_id":"` + customerID + `","total_amount":{"amount":10000,"currency":"IDR"}}}`),
+		}
+	}
+	consumer := newFakeConsumer(legacy("known", "order-1"), legacy("unknown", "order-2"))
+
+	var mu sync.Mutex
+	earned := make(map[string]string)
+	uc := &fakeUseCase{
+		merchants: map[string]string{"known": "merchant-a"},
+		earn: func(merchantID, orderID string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			earned[orderID] = merchantID
+			return nil
+		},
+	}
+	dlq := &recordingDeadLetters{}
+	log := logger.NewZapLogger(&logger.ZapLoggerConfig{Encoding: "console", Level: "error"})
+	l := NewCustomerListener(consumer, uc, log, dlq, Options{
+		Retry: RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour, MaxBackoff: time.Hour},
+	})
+
+	stop := run(l)
+	waitFor(t, "offset 1 to be committed", func() bool { return consumer.committed() == 1 })
+	stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if earned["order-1"] != "merchant-a" {
+		t.Errorf("order-1 earned under merchant %q, want merchant-a", earned["order-1"])
+	}
+	if _, ok := earned["order-2"]; ok {
+		t.Error("order-2 applied for an unknown customer")
+	}
+	if dlq.count() != 1 {
+		t.Errorf("%d messages dead-lettered, want 1", dlq.count())
+	}
+}
+
+type recordingDeadLetters struct {
+	mu   sync.Mutex
+	msgs []kafka.Message
+}
+
+func (d *recordingDeadLetters) Publish(_ context.Context, msg kafka.Message, _ error, _ int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.msgs = append(d.msgs, msg)
+	return nil
+}
+
+func (d *recordingDeadLetters) count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.msgs)
+}
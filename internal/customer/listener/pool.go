@@ -0,0 +1,102 @@
+package listener
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// workerFor picks the worker for msg. Messages with the same key always go to
+// the same worker, so they are applied in the order they were fetched;
+// unkeyed messages fall back to their partition. Order events are keyed by
+// order, so this orders events per order, not per customer.
+func workerFor(msg kafka.Message, workers int) int {
+	if len(msg.Key) == 0 {
+		return msg.Partition % workers
+	}
+	h := fnv.New32a()
+	h.Write(msg.Key)
+	return int(h.Sum32() % uint32(workers))
+}
+
+// pendingOffset is a fetched message that may still be in flight.
+type pendingOffset struct {
+	msg  kafka.Message
+	done bool
+}
+
+// partitionOffsets holds a partition's uncommitted offsets in fetch order.
+type partitionOffsets struct {
+	queue    []*pendingOffset
+	byOffset map[int64]*pendingOffset
+	// last is the highest offset ever tracked on the partition.
+	last int64
+}
+
+// offsetTracker commits offsets once every earlier message on the same
+// partition has been handled. Workers finish out of order, and committing a
+// later offset first would skip messages that are still in flight.
+//
+// After a rebalance the reader resumes from the last committed offset, so
+// messages that are still pending can be fetched again. Each offset is
+// tracked once, and whichever copy finishes first marks it handled.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int]*partitionOffsets
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[int]*partitionOffsets)}
+}
+
+// track registers msg as in flight. It must be called in fetch order.
+// Redelivered offsets are ignored: they are either still pending or already
+// committed.
+func (t *offsetTracker) track(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[msg.Partition]
+	if !ok {
+		p = &partitionOffsets{byOffset: make(map[int64]*pendingOffset), last: -1}
+		t.partitions[msg.Partition] = p
+	}
+	if msg.Offset <= p.last {
+		return
+	}
+	entry := &pendingOffset{msg: msg}
+	p.queue = append(p.queue, entry)
+	p.byOffset[msg.Offset] = entry
+	p.last = msg.Offset
+}
+
+// complete marks msg as handled and commits the highest contiguous handled
+// offset on its partition. Commits are serialised so they never go backwards.
+func (t *offsetTracker) complete(ctx context.Context, msg kafka.Message, commit func(context.Context, kafka.Message) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[msg.Partition]
+	if !ok {
+		return nil
+	}
+	entry, ok := p.byOffset[msg.Offset]
+	if !ok {
+		// A redelivered copy of an offset that is already committed.
+		return nil
+	}
+	entry.done = true
+
+	var last *pendingOffset
+	for len(p.queue) > 0 && p.queue[0].done {
+		last = p.queue[0]
+		delete(p.byOffset, last.msg.Offset)
+		p.queue = p.queue[1:]
+	}
+	if last == nil {
+		return nil
+	}
+	return commit(ctx, last.msg)
+}
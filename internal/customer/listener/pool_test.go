@@ -0,0 +1,89 @@
+package listener
+
+import (
+	"context"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestOffsetTracker(t *testing.T) {
+	type step struct {
+		track    int64 // offset to fetch, or -1
+		complete int64 // offset to complete, or -1
+		want     int64 // offset committed by the step, or -1
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "in order",
+			steps: []step{
+				{track: 0, complete: -1, want: -1},
+				{track: 1, complete: -1, want: -1},
+				{track: -1, complete: 0, want: 0},
+				{track: -1, complete: 1, want: 1},
+			},
+		},
+		{
+			name: "waits for an earlier in-flight offset",
+			steps: []step{
+				{track: 0, complete: -1, want: -1},
+				{track: 1, complete: -1, want: -1},
+				{track: 2, complete: -1, want: -1},
+				{track: -1, complete: 2, want: -1},
+				{track: -1, complete: 1, want: -1},
+				{track: -1, complete: 0, want: 2},
+			},
+		},
+		{
+			name: "redelivered pending offset does not stall commits",
+			steps: []step{
+				{track: 0, complete: -1, want: -1},
+				{track: 1, complete: -1, want: -1},
+				{track: -1, complete: 1, want: -1},
+				// Rebalance: the reader resumes before offset 0 again.
+				{track: 0, complete: -1, want: -1},
+				{track: 1, complete: -1, want: -1},
+				{track: -1, complete: 1, want: -1},
+				{track: -1, complete: 0, want: 1},
+				{track: -1, complete: 0, want: -1},
+				{track: 2, complete: -1, want: -1},
+				{track: -1, complete: 2, want: 2},
+			},
+		},
+		{
+			name: "redelivered committed offset is ignored",
+			steps: []step{
+				{track: 0, complete: 0, want: 0},
+				{track: 0, complete: 0, want: -1},
+				{track: 1, complete: 1, want: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newOffsetTracker()
+			for i, s := range tt.steps {
+				if s.track >= 0 {
+					tracker.track(kafka.Message{Partition: 3, Offset: s.track})
+				}
+				got := int64(-1)
+				if s.complete >= 0 {
+					commit := func(_ context.Context, msg kafka.Message) error {
+						got = msg.Offset
+						return nil
+					}
+					if err := tracker.complete(context.Background(), kafka.Message{Partition: 3, Offset: s.complete}, commit); err != nil {
+						t.Fatalf("step %d: complete: %v", i, err)
+					}
+				}
+				if got != s.want {
+					t.Fatalf("step %d: committed %d, want %d", i, got, s.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/apperror"
+)
+
+// RetryPolicy bounds how often a failing message is retried before it is
+// dead-lettered.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Backoff returns the delay before the given retry (1-based), doubling from
+// InitialBackoff up to MaxBackoff.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < retry; i++ {
+		d *= 2
+		if d >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	return d
+}
+
+// permanentError marks a failure that retrying cannot fix, such as a
+// malformed payload.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// isPermanent reports whether err should go straight to the dead-letter
+// topic. Domain errors (unknown customer, invalid IDs) are permanent;
+// anything else, such as a database outage, is assumed transient.
+func isPermanent(err error) bool {
+	var pErr *permanentError
+	if errors.As(err, &pErr) {
+		return true
+	}
+	_, ok := apperror.As(err)
+	return ok
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,60 @@
+package purger
+
+import (
+	"context"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/customer/usecase"
+	"github.com/fekuna/omnipos-pkg/logger"
+	"go.uber.org/zap"
+)
+
+// CustomerPurger periodically hard-deletes customers whose soft-delete is
+// older than the configured retention window.
+type CustomerPurger struct {
+	uc        usecase.UseCase
+	logger    logger.ZapLogger
+	retention time.Duration
+	interval  time.Duration
+}
+
+func NewCustomerPurger(uc usecase.UseCase, logger logger.ZapLogger, retention, interval time.Duration) *CustomerPurger {
+	return &CustomerPurger{
+		uc:        uc,
+		logger:    logger,
+		retention: retention,
+		interval:  interval,
+	}
+}
+
+func (p *CustomerPurger) Start(ctx context.Context) {
+	p.logger.Info("Starting Customer Purger", zap.Duration("retention", p.retention), zap.Duration("interval", p.interval))
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			p.logger.Info("Stopping Customer Purger")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *CustomerPurger) purge(ctx context.Context) {
+	purged, err := p.uc.PurgeDeletedCustomers(ctx, p.retention)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		p.logger.Error("Failed to purge deleted customers", zap.Error(err))
+		return
+	}
+	if purged > 0 {
+		p.logger.Info("Purged deleted customers", zap.Int64("count", purged))
+	}
+}
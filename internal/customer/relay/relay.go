@@ -0,0 +1,149 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/customer/repository"
+	"github.com/fekuna/omnipos-pkg/logger"
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// Publisher writes messages to the customer events topic. *kafka.Writer
+// satisfies it.
+type Publisher interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// Envelope is the message published for every domain event. Consumers should
+// deduplicate on EventID, since delivery is at-least-once.
+type Envelope struct {
+	EventID    string          `json:"event_id"`
+	EventType  string          `json:"event_type"`
+	MerchantID string          `json:"merchant_id"`
+	Payload    json.RawMessage `json:"payload"`
+	Timestamp  time.Time       `json:"timestamp"`
+}
+
+// OutboxRelay periodically publishes pending outbox events to Kafka, keyed by
+// customer ID so each customer's events stay ordered within a partition.
+// Events are only marked published after the write is acknowledged.
+type OutboxRelay struct {
+	repo      repository.Repository
+	publisher Publisher
+	logger    logger.ZapLogger
+	interval  time.Duration
+	batchSize int
+	retention time.Duration
+}
+
+func NewOutboxRelay(repo repository.Repository, publisher Publisher, logger logger.ZapLogger, interval time.Duration, batchSize int, retention time.Duration) *OutboxRelay {
+	return &OutboxRelay{
+		repo:      repo,
+		publisher: publisher,
+		logger:    logger,
+		interval:  interval,
+		batchSize: batchSize,
+		retention: retention,
+	}
+}
+
+// NewKafkaPublisher creates a writer for the customer events topic.
+func NewKafkaPublisher(brokers []string, topic string) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}
+}
+
+func (r *OutboxRelay) Start(ctx context.Context) {
+	r.logger.Info("Starting Outbox Relay", zap.Duration("interval", r.interval), zap.Int("batch_size", r.batchSize))
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.relay(ctx)
+
+		select {
+		case <-ctx.Done():
+			r.logger.Info("Stopping Outbox Relay")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relay drains pending events batch by batch, then drops published events
+// older than the retention window.
+func (r *OutboxRelay) relay(ctx context.Context) {
+	for ctx.Err() == nil {
+		published, err := r.publishBatch(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			r.logger.Error("Failed to relay outbox events", zap.Error(err))
+			return
+		}
+		if published < r.batchSize {
+			break
+		}
+	}
+
+	purged, err := r.repo.PurgePublishedOutboxEvents(ctx, time.Now().Add(-r.retention))
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		r.logger.Error("Failed to purge published outbox events", zap.Error(err))
+		return
+	}
+	if purged > 0 {
+		r.logger.Info("Purged published outbox events", zap.Int64("count", purged))
+	}
+}
+
+func (r *OutboxRelay) publishBatch(ctx context.Context) (int, error) {
+	events, err := r.repo.ListPendingOutboxEvents(ctx, r.batchSize)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	msgs := make([]kafka.Message, 0, len(events))
+	ids := make([]uuid.UUID, 0, len(events))
+	for _, e := range events {
+		value, err := json.Marshal(&Envelope{
+			EventID:    e.ID.String(),
+			EventType:  e.EventType,
+			MerchantID: e.MerchantID.String(),
+			Payload:    e.Payload,
+			Timestamp:  e.CreatedAt,
+		})
+		if err != nil {
+			return 0, err
+		}
+		msgs = append(msgs, kafka.Message{
+			Key:   []byte(e.CustomerID.String()),
+			Value: value,
+			Headers: []kafka.Header{
+				{Key: "event-type", Value: []byte(e.EventType)},
+			},
+		})
+		ids = append(ids, e.ID)
+	}
+
+	if err := r.publisher.WriteMessages(ctx, msgs...); err != nil {
+		return 0, err
+	}
+	// If this fails the batch is published again on the next run.
+	if err := r.repo.MarkOutboxEventsPublished(ctx, ids, time.Now()); err != nil {
+		return 0, err
+	}
+	return len(events), nil
+}
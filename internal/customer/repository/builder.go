@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"strconv"
+	"strings"
+)
+
+// queryBuilder collects AND-ed conditions and numbers their parameters, so
+// callers never count placeholders by hand. Conditions must only be built
+// from fixed SQL fragments; values always go through arg.
+type queryBuilder struct {
+	conds []string
+	args  []interface{}
+}
+
+// arg binds v and returns its placeholder.
+func (b *queryBuilder) arg(v interface{}) string {
+	b.args = append(b.args, v)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+// where adds a condition.
+func (b *queryBuilder) where(cond string) {
+	b.conds = append(b.conds, cond)
+}
+
+// clause renders the conditions as a WHERE clause.
+func (b *queryBuilder) clause() string {
+	if len(b.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(b.conds, " AND ")
+}
+
+// clone returns a builder with the same conditions and parameters that can
+// be extended independently.
+func (b *queryBuilder) clone() *queryBuilder {
+	return &queryBuilder{
+		conds: append([]string(nil), b.conds...),
+		args:  append([]interface{}(nil), b.args...),
+	}
+}
@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/google/uuid"
+)
+
+// customerSort is a whitelisted ORDER BY expression and the type its values
+// are compared as when resuming from a cursor.
+type customerSort struct {
+	expr    string
+	sqlType string
+}
+
+// customerSorts lists the orders customers may be listed in. Customers
+// without statistics sort as if they had none. Relevance is filled in from
+// the search condition.
+var customerSorts = map[model.CustomerSortKey]customerSort{
+	model.SortByCreatedAt:         {"c.created_at", "timestamptz"},
+	model.SortByName:              {"c.name", "text"},
+	model.SortByLifetimeSpend:     {"COALESCE(s.lifetime_spend, 0)", "bigint"},
+	model.SortByOrderCount:        {"COALESCE(s.order_count, 0)", "bigint"},
+	model.SortByAverageOrderValue: {"COALESCE(s.average_order_value, 0)", "bigint"},
+	model.SortByLastPurchaseAt:    {"s.last_purchase_at", "timestamptz"},
+	model.SortByLoyaltyPoints:     {"COALESCE(c.loyalty_points, 0)", "bigint"},
+	model.SortByRelevance:         {"", "float8"},
+}
+
+// customerCursor is the position after the last customer of a page. It is
+// handed to clients base64-encoded and is opaque to them.
+type customerCursor struct {
+	SortBy     model.CustomerSortKey `json:"s"`
+	Descending bool                  `json:"d"`
+	Value      string                `json:"v"`
+	ID         uuid.UUID             `json:"i"`
+}
+
+func (c customerCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCustomerCursor(s string) (*customerCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c customerCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == uuid.Nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// customerRow is a customer together with its value of the sort expression,
+// from which the next cursor is built.
+type customerRow struct {
+	model.Customer
+	SortValue string `db:"sort_value"`
+}
+
+// List pages through customers by keyset: each page resumes strictly after
+// the (sort value, id) of the previous one, so rows inserted meanwhile are
+// neither skipped nor repeated. opts.Page selects offset paging instead for
+// older clients.
+func (r *pgRepository) List(ctx context.Context, merchantID uuid.UUID, opts model.CustomerListOptions) (*model.CustomerPage, error) {
+	sort, ok := customerSorts[opts.SortBy]
+	if !ok || (opts.SortBy == model.SortByRelevance && strings.TrimSpace(opts.Search) == "") {
+		opts.SortBy = model.SortByCreatedAt
+		sort = customerSorts[model.SortByCreatedAt]
+	}
+	direction, after := "ASC", ">"
+	if opts.Descending {
+		direction, after = "DESC", "<"
+	}
+	if opts.SortBy == model.SortByLastPurchaseAt {
+		// Customers who never purchased go last either way.
+		if opts.Descending {
+			sort.expr = "COALESCE(s.last_purchase_at, '-infinity')"
+		} else {
+			sort.expr = "COALESCE(s.last_purchase_at, 'infinity')"
+		}
+	}
+
+	filters := &queryBuilder{}
+	filters.where("c.merchant_id = " + filters.arg(merchantID))
+	filters.where("c.deleted_at IS NULL")
+	if strings.TrimSpace(opts.Search) != "" {
+		rank := customerSearch(filters, opts.Search)
+		if opts.SortBy == model.SortByRelevance {
+			sort.expr = rank
+		}
+	}
+	applyCustomerFilters(filters, &opts)
+	from := " FROM customers c LEFT JOIN customer_stats s ON s.customer_id = c.id"
+
+	sortExpr := "(" + sort.expr + ")::" + sort.sqlType
+	page := filters.clone()
+	if opts.Cursor != "" && opts.Page == 0 {
+		cursor, err := decodeCustomerCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.SortBy != opts.SortBy || cursor.Descending != opts.Descending {
+			return nil, ErrInvalidCursor
+		}
+		page.where("(" + sortExpr + ", c.id) " + after + " (" + page.arg(cursor.Value) + "::" + sort.sqlType + ", " + page.arg(cursor.ID) + ")")
+	}
+
+	// One extra row tells whether there is a next page. The id tie-breaker
+	// makes the order total, which keyset paging relies on.
+	query := "SELECT c.*, " + sortExpr + "::text AS sort_value" + from + page.clause() +
+		" ORDER BY " + sortExpr + " " + direction + ", c.id " + direction +
+		" LIMIT " + page.arg(opts.PageSize+1)
+	if opts.Page > 0 {
+		query += " OFFSET " + page.arg((opts.Page-1)*opts.PageSize)
+	}
+
+	rows := []*customerRow{}
+	if err := r.db.SelectContext(ctx, &rows, query, page.args...); err != nil {
+		return nil, err
+	}
+
+	result := &model.CustomerPage{Customers: make([]*model.Customer, 0, len(rows))}
+	if len(rows) > opts.PageSize {
+		rows = rows[:opts.PageSize]
+		last := rows[len(rows)-1]
+		result.NextCursor = customerCursor{
+			SortBy:     opts.SortBy,
+			Descending: opts.Descending,
+			Value:      last.SortValue,
+			ID:         last.ID,
+		}.encode()
+	}
+	for _, row := range rows {
+		c := row.Customer
+		result.Customers = append(result.Customers, &c)
+	}
+
+	if opts.IncludeTotal {
+		var total int
+		if err := r.db.GetContext(ctx, &total, "SELECT COUNT(*)"+from+filters.clause(), filters.args...); err != nil {
+			return nil, err
+		}
+		result.Total = &total
+	}
+	return result, nil
+}
+
+// applyCustomerFilters adds a condition for each structured filter that is
+// set. Every condition is a fixed expression; only values are bound.
+func applyCustomerFilters(b *queryBuilder, opts *model.CustomerListOptions) {
+	if opts.CreatedAfter != nil {
+		b.where("c.created_at >= " + b.arg(*opts.CreatedAfter))
+	}
+	if opts.CreatedBefore != nil {
+		b.where("c.created_at < " + b.arg(*opts.CreatedBefore))
+	}
+	if opts.UpdatedAfter != nil {
+		b.where("c.updated_at >= " + b.arg(*opts.UpdatedAfter))
+	}
+	if opts.UpdatedBefore != nil {
+		b.where("c.updated_at < " + b.arg(*opts.UpdatedBefore))
+	}
+	if opts.MinLoyaltyPoints != nil {
+		b.where("COALESCE(c.loyalty_points, 0) >= " + b.arg(*opts.MinLoyaltyPoints))
+	}
+	if opts.MaxLoyaltyPoints != nil {
+		b.where("COALESCE(c.loyalty_points, 0) <= " + b.arg(*opts.MaxLoyaltyPoints))
+	}
+	if opts.TierID != nil {
+		b.where("c.tier_id = " + b.arg(*opts.TierID))
+	}
+	for _, tag := range opts.Tags {
+		b.where("EXISTS (SELECT 1 FROM customer_tags t WHERE t.customer_id = c.id AND t.tag = " + b.arg(tag) + ")")
+	}
+	if opts.SegmentID != nil {
+		b.where("EXISTS (SELECT 1 FROM customer_segment_members m WHERE m.customer_id = c.id AND m.segment_id = " + b.arg(*opts.SegmentID) + ")")
+	}
+	if opts.HasEmail != nil {
+		if *opts.HasEmail {
+			b.where("COALESCE(c.email, '') <> ''")
+		} else {
+			b.where("COALESCE(c.email, '') = ''")
+		}
+	}
+	if opts.BirthdayMonth != nil {
+		b.where("EXTRACT(MONTH FROM c.birthday) = " + b.arg(*opts.BirthdayMonth))
+	}
+	if opts.MinLifetimeSpend != nil {
+		b.where("COALESCE(s.lifetime_spend, 0) >= " + b.arg(*opts.MinLifetimeSpend))
+	}
+	if opts.MinOrderCount != nil {
+		b.where("COALESCE(s.order_count, 0) >= " + b.arg(*opts.MinOrderCount))
+	}
+	if opts.LastPurchaseAfter != nil {
+		b.where("s.last_purchase_at >= " + b.arg(*opts.LastPurchaseAfter))
+	}
+	if opts.LastPurchaseBefore != nil {
+		b.where("s.last_purchase_at < " + b.arg(*opts.LastPurchaseBefore))
+	}
+}
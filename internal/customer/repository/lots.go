@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// createPointLot opens a lot for a credit entry, dated by the program's
+// expiry policy. When the customer is in debt (a negative balance before the
+// credit), only the part of the credit above zero becomes spendable.
+func createPointLot(ctx context.Context, tx *sqlx.Tx, program *model.LoyaltyProgram, t *model.LoyaltyTransaction, balanceBefore int32) error {
+	points := t.Delta
+	if balanceBefore < 0 {
+		points += balanceBefore
+	}
+	if points <= 0 {
+		return nil
+	}
+
+	lot := &model.LoyaltyPointLot{
+		ID:            uuid.New(),
+		MerchantID:    t.MerchantID,
+		CustomerID:    t.CustomerID,
+		TransactionID: &t.ID,
+		Earned:        points,
+		Remaining:     points,
+		ExpiresAt:     program.ExpiryFor(t.CreatedAt),
+		CreatedAt:     t.CreatedAt,
+	}
+	query := `
+		INSERT INTO loyalty_point_lots (id, merchant_id, customer_id, transaction_id, earned, remaining, expires_at, created_at)
+		VALUES (:id, :merchant_id, :customer_id, :transaction_id, :earned, :remaining, :expires_at, :created_at)
+	`
+	_, err := tx.NamedExecContext(ctx, query, lot)
+	return err
+}
+
+// consumePointLots takes points from the customer's open lots, oldest first.
+// Any shortfall (a debit beyond the lots, e.g. a clawback of spent points) is
+// left unmatched.
+func consumePointLots(ctx context.Context, tx *sqlx.Tx, customerID uuid.UUID, points int32) error {
+	lots := []*model.LoyaltyPointLot{}
+	query := `
+		SELECT * FROM loyalty_point_lots
+		WHERE customer_id = $1 AND remaining > 0
+		ORDER BY created_at ASC, id ASC
+		FOR UPDATE
+	`
+	if err := tx.SelectContext(ctx, &lots, query, customerID); err != nil {
+		return err
+	}
+
+	for _, lot := range lots {
+		if points == 0 {
+			break
+		}
+		take := lot.Remaining
+		if take > points {
+			take = points
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE loyalty_point_lots SET remaining = remaining - $1 WHERE id = $2`, take, lot.ID); err != nil {
+			return err
+		}
+		points -= take
+	}
+	return nil
+}
+
+func (r *pgRepository) ListDueLots(ctx context.Context, now time.Time, after *model.LoyaltyPointLot, limit int) ([]*model.LoyaltyPointLot, error) {
+	b := &queryBuilder{}
+	b.where("l.remaining > 0")
+	b.where("l.expires_at IS NOT NULL")
+	b.where("l.expires_at <= " + b.arg(now))
+	// Lots of soft-deleted customers cannot be expired and stay until the
+	// customer is purged.
+	b.where("c.deleted_at IS NULL")
+	if after != nil {
+		b.where(fmt.Sprintf("(l.expires_at, l.id) > (%s, %s)", b.arg(*after.ExpiresAt), b.arg(after.ID)))
+	}
+	query := `
+		SELECT l.* FROM loyalty_point_lots l
+		JOIN customers c ON c.id = l.customer_id` + b.clause() + `
+		ORDER BY l.expires_at ASC, l.id ASC
+		LIMIT ` + b.arg(limit)
+
+	lots := []*model.LoyaltyPointLot{}
+	if err := r.db.SelectContext(ctx, &lots, query, b.args...); err != nil {
+		return nil, err
+	}
+	return lots, nil
+}
+
+func (r *pgRepository) ExpireLot(ctx context.Context, lotID uuid.UUID, now time.Time) (*model.LoyaltyTransaction, error) {
+	var t *model.LoyaltyTransaction
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		var lot model.LoyaltyPointLot
+		if err := tx.GetContext(ctx, &lot, `SELECT * FROM loyalty_point_lots WHERE id = $1`, lotID); err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+
+		// Lock the customer before the lot, matching the order used by debits.
+		balance, found, err := lockBalance(ctx, tx, lot.MerchantID, lot.CustomerID)
+		if err != nil || !found {
+			return err
+		}
+		if err := tx.GetContext(ctx, &lot, `SELECT * FROM loyalty_point_lots WHERE id = $1 FOR UPDATE`, lotID); err != nil {
+			return err
+		}
+		if lot.Remaining == 0 || lot.ExpiresAt == nil || lot.ExpiresAt.After(now) {
+			return nil
+		}
+
+		// Held points are promised to a checkout, so only what is left above
+		// the holds expires. The rest of the lot stays due and expires once
+		// the holds are cancelled or lapse; a confirmed hold spends it.
+		held, err := heldPoints(ctx, tx, lot.CustomerID)
+		if err != nil {
+			return err
+		}
+		points := lot.Remaining
+		if available := balance - held; points > available {
+			points = available
+		}
+		if points <= 0 {
+			return nil
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE loyalty_point_lots SET remaining = remaining - $1 WHERE id = $2`, points, lot.ID); err != nil {
+			return err
+		}
+		t = &model.LoyaltyTransaction{
+			MerchantID: lot.MerchantID,
+			CustomerID: lot.CustomerID,
+			Type:       model.LoyaltyTransactionExpire,
+			Delta:      -points,
+			Actor:      "system",
+			Reason:     "points earned " + lot.CreatedAt.Format("2006-01-02") + " expired",
+		}
+		return appendLoyaltyTransaction(ctx, tx, balance, t)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *pgRepository) ListUpcomingExpirations(ctx context.Context, merchantID, customerID uuid.UUID, until time.Time) ([]*model.PointExpiration, error) {
+	expirations := []*model.PointExpiration{}
+	query := `
+		SELECT expires_at, SUM(remaining) AS points FROM loyalty_point_lots
+		WHERE merchant_id = $1 AND customer_id = $2 AND remaining > 0
+			AND expires_at IS NOT NULL AND expires_at <= $3
+		GROUP BY expires_at
+		ORDER BY expires_at ASC
+	`
+	if err := r.db.SelectContext(ctx, &expirations, query, merchantID, customerID, until); err != nil {
+		return nil, err
+	}
+	return expirations, nil
+}
@@ -0,0 +1,373 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// withTx runs fn inside a database transaction, committing on success.
+func (r *pgRepository) withTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *pgRepository) RecordLoyaltyTransaction(ctx context.Context, t *model.LoyaltyTransaction) (*model.LoyaltyTransaction, error) {
+	var found bool
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		balance, ok, err := lockBalance(ctx, tx, t.MerchantID, t.CustomerID)
+		if err != nil || !ok {
+			return err
+		}
+		found = true
+
+		if t.Delta < 0 {
+			held, err := heldPoints(ctx, tx, t.CustomerID)
+			if err != nil {
+				return err
+			}
+			if balance-held+t.Delta < 0 {
+				return ErrInsufficientPoints
+			}
+		}
+		return appendLoyaltyTransaction(ctx, tx, balance, t)
+	})
+	if err != nil || !found {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *pgRepository) RecordEventLoyaltyTransaction(ctx context.Context, event *model.ProcessedEvent, t *model.LoyaltyTransaction) (*model.LoyaltyTransaction, error) {
+	var found bool
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := markEventProcessed(ctx, tx, event); err != nil {
+			return err
+		}
+		var err error
+		found, err = recordLoyaltyTransaction(ctx, tx, t)
+		return err
+	})
+	if err != nil || !found {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *pgRepository) RecordEventOrderReversal(ctx context.Context, event *model.ProcessedEvent, t *model.LoyaltyTransaction, refundAmount *model.Money) (*model.LoyaltyTransaction, error) {
+	var recorded bool
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := markEventProcessed(ctx, tx, event); err != nil {
+			return err
+		}
+		balance, found, err := lockBalance(ctx, tx, t.MerchantID, t.CustomerID)
+		if err != nil || !found {
+			return err
+		}
+
+		// The customer lock serializes reversals of the same order.
+		var order model.OrderPoints
+		query := `
+			SELECT
+				COALESCE(SUM(delta) FILTER (WHERE type = 'earn'), 0) AS earned,
+				COALESCE(-SUM(delta) FILTER (WHERE type = 'reverse'), 0) AS reversed,
+				COALESCE(SUM(order_amount) FILTER (WHERE type = 'earn'), 0) AS earned_amount,
+				COALESCE(-SUM(order_amount) FILTER (WHERE type = 'reverse'), 0) AS refunded_amount,
+				MAX(order_currency) FILTER (WHERE type = 'earn') AS currency
+			FROM loyalty_transactions
+			WHERE customer_id = $1 AND source_order_id = $2
+		`
+		if err := tx.GetContext(ctx, &order, query, t.CustomerID, t.SourceOrderID); err != nil {
+			return err
+		}
+
+		var refund *int64
+		if refundAmount != nil {
+			if order.Currency != nil && refundAmount.Currency != *order.Currency {
+				return ErrCurrencyMismatch
+			}
+			refund = &refundAmount.Amount
+		}
+		points, amount := order.Reversal(refund)
+		if points == 0 {
+			return nil
+		}
+		refunded := -amount
+		t.Delta = -points
+		t.OrderAmount = &refunded
+		t.OrderCurrency = order.Currency
+		recorded = true
+		return appendLoyaltyTransaction(ctx, tx, balance, t)
+	})
+	if err != nil || !recorded {
+		return nil, err
+	}
+	return t, nil
+}
+
+// markEventProcessed claims event for the current transaction. If the claim
+// is rolled back the event can be processed again.
+func markEventProcessed(ctx context.Context, tx *sqlx.Tx, event *model.ProcessedEvent) error {
+	event.ProcessedAt = time.Now()
+	query := `
+		INSERT INTO processed_events (event_id, event_type, processed_at)
+		VALUES (:event_id, :event_type, :processed_at)
+		ON CONFLICT (event_id) DO NOTHING
+	`
+	res, err := tx.NamedExecContext(ctx, query, event)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrEventAlreadyProcessed
+	}
+	return nil
+}
+
+// recordLoyaltyTransaction locks the customer row, applies t.Delta to the
+// cached balance and appends the ledger entry without any balance check. It
+// reports false if the customer does not exist.
+func recordLoyaltyTransaction(ctx context.Context, tx *sqlx.Tx, t *model.LoyaltyTransaction) (bool, error) {
+	balance, found, err := lockBalance(ctx, tx, t.MerchantID, t.CustomerID)
+	if err != nil || !found {
+		return false, err
+	}
+	if err := appendLoyaltyTransaction(ctx, tx, balance, t); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// lockBalance locks the customer row for the rest of the transaction and
+// returns its current balance.
+func lockBalance(ctx context.Context, tx *sqlx.Tx, merchantID, customerID uuid.UUID) (int32, bool, error) {
+	var balance int32
+	query := `
+		SELECT loyalty_points FROM customers
+		WHERE merchant_id = $1 AND id = $2 AND deleted_at IS NULL
+		FOR UPDATE
+	`
+	if err := tx.GetContext(ctx, &balance, query, merchantID, customerID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return balance, true, nil
+}
+
+// heldPoints sums the customer's unexpired holds.
+func heldPoints(ctx context.Context, tx *sqlx.Tx, customerID uuid.UUID) (int32, error) {
+	var held int32
+	query := `
+		SELECT COALESCE(SUM(points), 0) FROM loyalty_holds
+		WHERE customer_id = $1 AND status = 'held' AND expires_at > $2
+	`
+	if err := tx.GetContext(ctx, &held, query, customerID, time.Now()); err != nil {
+		return 0, err
+	}
+	return held, nil
+}
+
+// appendLoyaltyTransaction writes t on top of balance, keeps the customer's
+// point lots in step and re-evaluates their tier, queueing the matching
+// domain events. The customer row must already be locked by the caller.
+func appendLoyaltyTransaction(ctx context.Context, tx *sqlx.Tx, balance int32, t *model.LoyaltyTransaction) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	t.CreatedAt = time.Now()
+	t.BalanceAfter = balance + t.Delta
+
+	updateQuery := `UPDATE customers SET loyalty_points = $1, updated_at = $2 WHERE id = $3`
+	if _, err := tx.ExecContext(ctx, updateQuery, t.BalanceAfter, t.CreatedAt, t.CustomerID); err != nil {
+		return err
+	}
+
+	insertQuery := `
+		INSERT INTO loyalty_transactions (id, merchant_id, customer_id, type, source_order_id, order_amount, order_currency, delta, balance_after, actor, reason, created_at)
+		VALUES (:id, :merchant_id, :customer_id, :type, :source_order_id, :order_amount, :order_currency, :delta, :balance_after, :actor, :reason, :created_at)
+	`
+	if _, err := tx.NamedExecContext(ctx, insertQuery, t); err != nil {
+		return err
+	}
+	if err := insertOutboxEvent(ctx, tx, t.MerchantID, t.CustomerID, model.EventLoyaltyPointsChanged, model.NewLoyaltyPointsChangedEvent(t)); err != nil {
+		return err
+	}
+
+	program, err := loadLoyaltyProgram(ctx, tx, t.MerchantID)
+	if err != nil {
+		return err
+	}
+
+	// Expire entries settle their own lot; every other debit is taken from
+	// the oldest lots first.
+	switch {
+	case t.Delta > 0:
+		err = createPointLot(ctx, tx, program, t, balance)
+	case t.Delta < 0 && t.Type != model.LoyaltyTransactionExpire:
+		err = consumePointLots(ctx, tx, t.CustomerID, -t.Delta)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := reevaluateTier(ctx, tx, program, t.CustomerID); err != nil {
+		return err
+	}
+	return refreshCustomerSegments(ctx, tx, t.MerchantID, t.CustomerID)
+}
+
+func (r *pgRepository) ListLoyaltyTransactions(ctx context.Context, merchantID, customerID uuid.UUID, page, pageSize int) ([]*model.LoyaltyTransaction, int, error) {
+	offset := (page - 1) * pageSize
+	transactions := []*model.LoyaltyTransaction{}
+	var total int
+
+	query := `
+		SELECT * FROM loyalty_transactions
+		WHERE merchant_id = $1 AND customer_id = $2
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3 OFFSET $4
+	`
+	if err := r.db.SelectContext(ctx, &transactions, query, merchantID, customerID, pageSize, offset); err != nil {
+		return nil, 0, err
+	}
+
+	countQuery := `SELECT COUNT(*) FROM loyalty_transactions WHERE merchant_id = $1 AND customer_id = $2`
+	if err := r.db.GetContext(ctx, &total, countQuery, merchantID, customerID); err != nil {
+		return nil, 0, err
+	}
+
+	return transactions, total, nil
+}
+
+func (r *pgRepository) CreateLoyaltyHold(ctx context.Context, h *model.LoyaltyHold) (*model.LoyaltyHold, error) {
+	var found bool
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		balance, ok, err := lockBalance(ctx, tx, h.MerchantID, h.CustomerID)
+		if err != nil || !ok {
+			return err
+		}
+		found = true
+
+		held, err := heldPoints(ctx, tx, h.CustomerID)
+		if err != nil {
+			return err
+		}
+		if balance-held < h.Points {
+			return ErrInsufficientPoints
+		}
+
+		if h.ID == uuid.Nil {
+			h.ID = uuid.New()
+		}
+		h.Status = model.LoyaltyHoldHeld
+		h.CreatedAt = time.Now()
+		h.UpdatedAt = h.CreatedAt
+
+		query := `
+			INSERT INTO loyalty_holds (id, merchant_id, customer_id, order_id, points, status, expires_at, created_at, updated_at)
+			VALUES (:id, :merchant_id, :customer_id, :order_id, :points, :status, :expires_at, :created_at, :updated_at)
+		`
+		_, err = tx.NamedExecContext(ctx, query, h)
+		return err
+	})
+	if err != nil || !found {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (r *pgRepository) ConfirmLoyaltyHold(ctx context.Context, merchantID, holdID uuid.UUID, actor string) (*model.LoyaltyTransaction, error) {
+	var t *model.LoyaltyTransaction
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		h, err := lockActiveHold(ctx, tx, merchantID, holdID)
+		if err != nil || h == nil {
+			return err
+		}
+
+		// The hold reserved these points and expiry leaves held points
+		// alone, so no availability check.
+		t = &model.LoyaltyTransaction{
+			MerchantID:    h.MerchantID,
+			CustomerID:    h.CustomerID,
+			Type:          model.LoyaltyTransactionRedeem,
+			SourceOrderID: h.OrderID,
+			Delta:         -h.Points,
+			Actor:         actor,
+			Reason:        "hold " + h.ID.String() + " confirmed",
+		}
+		found, err := recordLoyaltyTransaction(ctx, tx, t)
+		if err != nil {
+			return err
+		}
+		if !found {
+			t = nil
+			return nil
+		}
+
+		query := `UPDATE loyalty_holds SET status = $1, transaction_id = $2, updated_at = $3 WHERE id = $4`
+		_, err = tx.ExecContext(ctx, query, model.LoyaltyHoldConfirmed, t.ID, time.Now(), h.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *pgRepository) CancelLoyaltyHold(ctx context.Context, merchantID, holdID uuid.UUID) (*model.LoyaltyHold, error) {
+	var hold *model.LoyaltyHold
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		h, err := lockActiveHold(ctx, tx, merchantID, holdID)
+		if err != nil || h == nil {
+			return err
+		}
+
+		h.Status = model.LoyaltyHoldCancelled
+		h.UpdatedAt = time.Now()
+		query := `UPDATE loyalty_holds SET status = $1, updated_at = $2 WHERE id = $3`
+		if _, err := tx.ExecContext(ctx, query, h.Status, h.UpdatedAt, h.ID); err != nil {
+			return err
+		}
+		hold = h
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// lockActiveHold locks a hold that can still be confirmed or cancelled. It
+// returns nil if the hold does not exist and ErrHoldNotActive if it was
+// already settled or has expired.
+func lockActiveHold(ctx context.Context, tx *sqlx.Tx, merchantID, holdID uuid.UUID) (*model.LoyaltyHold, error) {
+	var h model.LoyaltyHold
+	query := `SELECT * FROM loyalty_holds WHERE merchant_id = $1 AND id = $2 FOR UPDATE`
+	if err := tx.GetContext(ctx, &h, query, merchantID, holdID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if h.Status != model.LoyaltyHoldHeld || !h.ExpiresAt.After(time.Now()) {
+		return nil, ErrHoldNotActive
+	}
+	return &h, nil
+}
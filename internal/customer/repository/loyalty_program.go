@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+func (r *pgRepository) GetLoyaltyProgram(ctx context.Context, merchantID uuid.UUID) (*model.LoyaltyProgram, error) {
+	var p model.LoyaltyProgram
+	query := `SELECT * FROM loyalty_programs WHERE merchant_id = $1`
+	if err := r.db.GetContext(ctx, &p, query, merchantID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *pgRepository) UpsertLoyaltyProgram(ctx context.Context, p *model.LoyaltyProgram) error {
+	now := time.Now()
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = now
+	}
+	p.UpdatedAt = now
+
+	query := `
+		INSERT INTO loyalty_programs (merchant_id, enabled, currency, points_per_unit, rounding_mode, min_order_amount, max_points_per_order, tier_basis, tier_window_days, expiry_policy, expiry_months, created_at, updated_at)
+		VALUES (:merchant_id, :enabled, :currency, :points_per_unit, :rounding_mode, :min_order_amount, :max_points_per_order, :tier_basis, :tier_window_days, :expiry_policy, :expiry_months, :created_at, :updated_at)
+		ON CONFLICT (merchant_id) DO UPDATE SET
+			enabled = EXCLUDED.enabled,
+			currency = EXCLUDED.currency,
+			points_per_unit = EXCLUDED.points_per_unit,
+			rounding_mode = EXCLUDED.rounding_mode,
+			min_order_amount = EXCLUDED.min_order_amount,
+			max_points_per_order = EXCLUDED.max_points_per_order,
+			tier_basis = EXCLUDED.tier_basis,
+			tier_window_days = EXCLUDED.tier_window_days,
+			expiry_policy = EXCLUDED.expiry_policy,
+			expiry_months = EXCLUDED.expiry_months,
+			updated_at = EXCLUDED.updated_at
+	`
+	return r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.NamedExecContext(ctx, query, p); err != nil {
+			return err
+		}
+		// The tier basis or window may have changed.
+		return invalidateTiers(ctx, tx, p.MerchantID)
+	})
+}
+
+// loadLoyaltyProgram reads the merchant's program through q, falling back to
+// the defaults if none is configured.
+func loadLoyaltyProgram(ctx context.Context, q sqlx.QueryerContext, merchantID uuid.UUID) (*model.LoyaltyProgram, error) {
+	var p model.LoyaltyProgram
+	query := `SELECT * FROM loyalty_programs WHERE merchant_id = $1`
+	if err := sqlx.GetContext(ctx, q, &p, query, merchantID); err != nil {
+		if err == sql.ErrNoRows {
+			return model.DefaultLoyaltyProgram(merchantID), nil
+		}
+		return nil, err
+	}
+	return &p, nil
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/google/uuid"
+)
+
+func (r *pgRepository) GetMerchantSettings(ctx context.Context, merchantID uuid.UUID) (*model.MerchantSettings, error) {
+	var s model.MerchantSettings
+	query := `SELECT * FROM merchant_settings WHERE merchant_id = $1`
+	if err := r.db.GetContext(ctx, &s, query, merchantID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *pgRepository) UpsertMerchantSettings(ctx context.Context, s *model.MerchantSettings) error {
+	now := time.Now()
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = now
+	}
+	s.UpdatedAt = now
+
+	query := `
+		INSERT INTO merchant_settings (merchant_id, phone_country, created_at, updated_at)
+		VALUES (:merchant_id, :phone_country, :created_at, :updated_at)
+		ON CONFLICT (merchant_id) DO UPDATE SET
+			phone_country = EXCLUDED.phone_country,
+			updated_at = EXCLUDED.updated_at
+	`
+	_, err := r.db.NamedExecContext(ctx, query, s)
+	return err
+}
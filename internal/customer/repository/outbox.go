@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// insertOutboxEvent queues a domain event in the caller's transaction, so it
+// is published if and only if the change commits.
+func insertOutboxEvent(ctx context.Context, tx *sqlx.Tx, merchantID, customerID uuid.UUID, eventType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO outbox_events (id, merchant_id, customer_id, event_type, payload, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err = tx.ExecContext(ctx, query, uuid.New(), merchantID, customerID, eventType, data, time.Now())
+	return err
+}
+
+func (r *pgRepository) ListPendingOutboxEvents(ctx context.Context, limit int) ([]*model.OutboxEvent, error) {
+	events := []*model.OutboxEvent{}
+	query := `
+		SELECT * FROM outbox_events
+		WHERE published_at IS NULL
+		ORDER BY seq
+		LIMIT $1
+	`
+	if err := r.db.SelectContext(ctx, &events, query, limit); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *pgRepository) MarkOutboxEventsPublished(ctx context.Context, ids []uuid.UUID, publishedAt time.Time) error {
+	query, args, err := sqlx.In(`UPDATE outbox_events SET published_at = ? WHERE id IN (?)`, publishedAt, ids)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, r.db.Rebind(query), args...)
+	return err
+}
+
+func (r *pgRepository) PurgePublishedOutboxEvents(ctx context.Context, publishedBefore time.Time) (int64, error) {
+	query := `DELETE FROM outbox_events WHERE published_at IS NOT NULL AND published_at < $1`
+	res, err := r.db.ExecContext(ctx, query, publishedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
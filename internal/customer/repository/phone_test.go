@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/google/uuid"
+)
+
+// TestCreateRejectsConcurrentDuplicatePhones creates customers whose phones
+// differ as entered but share an E.164 number, all at once. Only one may
+// win; the raw phone index cannot tell them apart.
+func TestCreateRejectsConcurrentDuplicatePhones(t *testing.T) {
+	repo := NewPGRepository(testDB(t))
+	merchant := uuid.New()
+	e164 := "+6281234567890"
+
+	phones := []string{"0812 3456 7890", "0812-3456-7890", "+62 812 3456 7890", "+6281234567890", "(0812) 3456 7890"}
+	errs := make([]error, len(phones))
+	var wg sync.WaitGroup
+	for i, phone := range phones {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			now := time.Now()
+			errs[i] = repo.Create(context.Background(), &model.Customer{
+				ID:         uuid.New(),
+				MerchantID: merchant,
+				Name:       fmt.Sprintf("Customer %d", i),
+				Phone:      phone,
+				PhoneE164:  &e164,
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			})
+		}()
+	}
+	wg.Wait()
+
+	created := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, ErrDuplicatePhone):
+			t.Errorf("writer %d: got %v, want ErrDuplicatePhone", i, err)
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d customers created with the same phone, want 1", created)
+	}
+}
+
+// TestRestoreRejectsTakenPhone deletes a customer, gives its number to a new
+// customer, and checks the deleted one cannot come back with it.
+func TestRestoreRejectsTakenPhone(t *testing.T) {
+	repo := NewPGRepository(testDB(t))
+	ctx := context.Background()
+	merchant := uuid.New()
+
+	old := createTestCustomer(t, repo, merchant, "Ann Tan", "0812 3456 7890", "+6281234567890", "", "")
+	if err := repo.Delete(ctx, merchant, old.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	createTestCustomer(t, repo, merchant, "Ann Lim", "+62 812 3456 7890", "+6281234567890", "", "")
+
+	if c, err := repo.Restore(ctx, merchant, old.ID); !errors.Is(err, ErrDuplicatePhone) {
+		t.Fatalf("Restore: got %v, %v, want ErrDuplicatePhone", c, err)
+	}
+	if c, err := repo.GetByID(ctx, merchant, old.ID); err != nil || c != nil {
+		t.Errorf("customer live after a rejected restore: %v, %v", c, err)
+	}
+}
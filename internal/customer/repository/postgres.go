@@ -3,7 +3,9 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/fekuna/omnipos-customer-service/internal/model"
@@ -11,14 +13,136 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
+// ErrDuplicatePhone is returned when a write collides with another live
+// customer of the same merchant on phone.
+var ErrDuplicatePhone = errors.New("customer phone already exists")
+
+// ErrEventAlreadyProcessed is returned when an inbound event has already been
+// applied.
+var ErrEventAlreadyProcessed = errors.New("event already processed")
+
+// ErrInsufficientPoints is returned when a debit exceeds the customer's
+// available (unheld) balance.
+var ErrInsufficientPoints = errors.New("insufficient loyalty points")
+
+// ErrHoldNotActive is returned when a loyalty hold was already confirmed,
+// cancelled, or has expired.
+var ErrHoldNotActive = errors.New("loyalty hold is not active")
+
+// ErrDuplicateTierName is returned when a merchant already has a tier with
+// the same name.
+var ErrDuplicateTierName = errors.New("loyalty tier name already exists")
+
+// ErrCurrencyMismatch is returned when a refund is in a different currency
+// from the order it refunds.
+var ErrCurrencyMismatch = errors.New("refund currency does not match order")
+
+// ErrInvalidCursor is returned when a list cursor cannot be decoded or does
+// not belong to the requested sort order.
+var ErrInvalidCursor = errors.New("invalid list cursor")
+
+// uniqueViolation is the Postgres SQLSTATE for unique_violation.
+const uniqueViolation = "23505"
+
 type Repository interface {
 	Create(ctx context.Context, customer *model.Customer) error
-	GetByID(ctx context.Context, id uuid.UUID) (*model.Customer, error)
+	GetByID(ctx context.Context, merchantID, id uuid.UUID) (*model.Customer, error)
+	// GetCustomerMerchantID returns the merchant that owns a customer, live or
+	// deleted, or nil if there is no such customer. It is not scoped by
+	// merchant, so it must only back internal lookups such as order events
+	// without a merchant ID.
+	GetCustomerMerchantID(ctx context.Context, id uuid.UUID) (*uuid.UUID, error)
+	// GetByPhone looks a customer up by their E.164 phone number.
 	GetByPhone(ctx context.Context, merchantID uuid.UUID, phone string) (*model.Customer, error)
-	List(ctx context.Context, merchantID uuid.UUID, page, pageSize int, search string) ([]*model.Customer, int, error)
-	Update(ctx context.Context, customer *model.Customer) error
-	Delete(ctx context.Context, id uuid.UUID) error
-	AddLoyaltyPoints(ctx context.Context, id uuid.UUID, points int32) error
+	// List returns a page of customers. ErrInvalidCursor is returned if
+	// opts.Cursor is malformed or was issued for a different sort.
+	List(ctx context.Context, merchantID uuid.UUID, opts model.CustomerListOptions) (*model.CustomerPage, error)
+	// Update writes only the given fields of customer.
+	Update(ctx context.Context, customer *model.Customer, fields []model.CustomerField) error
+	Delete(ctx context.Context, merchantID, id uuid.UUID) error
+	// Restore returns nil if there is no such deleted customer, and
+	// ErrDuplicatePhone if another live customer has taken its phone.
+	Restore(ctx context.Context, merchantID, id uuid.UUID) (*model.Customer, error)
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error)
+
+	// RecordLoyaltyTransaction appends t to the ledger and applies its delta to
+	// the customer's balance in one transaction, filling in t.BalanceAfter.
+	// Debits beyond the available balance fail with ErrInsufficientPoints.
+	// It returns nil if the customer does not exist.
+	RecordLoyaltyTransaction(ctx context.Context, t *model.LoyaltyTransaction) (*model.LoyaltyTransaction, error)
+	// RecordEventLoyaltyTransaction is RecordLoyaltyTransaction guarded by
+	// event: the event is marked processed in the same transaction, and
+	// ErrEventAlreadyProcessed is returned if it was seen before.
+	RecordEventLoyaltyTransaction(ctx context.Context, event *model.ProcessedEvent, t *model.LoyaltyTransaction) (*model.LoyaltyTransaction, error)
+	// RecordEventOrderReversal claws back the points earned by t.SourceOrderID,
+	// proportionally to refundAmount or entirely if it is nil, filling in
+	// t.Delta. The balance may go negative. It returns nil if there is nothing
+	// left to reverse or the customer does not exist, and ErrCurrencyMismatch
+	// if the refund is not in the order's currency.
+	RecordEventOrderReversal(ctx context.Context, event *model.ProcessedEvent, t *model.LoyaltyTransaction, refundAmount *model.Money) (*model.LoyaltyTransaction, error)
+	ListLoyaltyTransactions(ctx context.Context, merchantID, customerID uuid.UUID, page, pageSize int) ([]*model.LoyaltyTransaction, int, error)
+	CreateLoyaltyHold(ctx context.Context, h *model.LoyaltyHold) (*model.LoyaltyHold, error)
+	ConfirmLoyaltyHold(ctx context.Context, merchantID, holdID uuid.UUID, actor string) (*model.LoyaltyTransaction, error)
+	CancelLoyaltyHold(ctx context.Context, merchantID, holdID uuid.UUID) (*model.LoyaltyHold, error)
+	GetLoyaltyProgram(ctx context.Context, merchantID uuid.UUID) (*model.LoyaltyProgram, error)
+	UpsertLoyaltyProgram(ctx context.Context, p *model.LoyaltyProgram) error
+	ListLoyaltyTiers(ctx context.Context, merchantID uuid.UUID) ([]*model.LoyaltyTier, error)
+	GetCustomerTier(ctx context.Context, merchantID, customerID uuid.UUID) (*model.LoyaltyTier, error)
+	CreateLoyaltyTier(ctx context.Context, t *model.LoyaltyTier) error
+	UpdateLoyaltyTier(ctx context.Context, t *model.LoyaltyTier) (bool, error)
+	DeleteLoyaltyTier(ctx context.Context, merchantID, id uuid.UUID) (bool, error)
+	ListTierHistory(ctx context.Context, merchantID, customerID uuid.UUID) ([]*model.CustomerTierChange, error)
+	// ListStaleTierCustomers returns live customers whose tier has not been
+	// evaluated since their merchant's tiers last changed, or, on
+	// rolling-spend programs, not since evaluatedBefore; oldest first.
+	ListStaleTierCustomers(ctx context.Context, evaluatedBefore time.Time, limit int) ([]*model.Customer, error)
+	// ReevaluateCustomerTier moves the customer to the tier they qualify for
+	// now. It returns nil if the tier is unchanged or the customer does not
+	// exist.
+	ReevaluateCustomerTier(ctx context.Context, merchantID, customerID uuid.UUID) (*model.CustomerTierChange, error)
+	// ListDueLots returns live customers' lots due by now, ordered by expiry
+	// and ID and starting after the lot after if it is set.
+	ListDueLots(ctx context.Context, now time.Time, after *model.LoyaltyPointLot, limit int) ([]*model.LoyaltyPointLot, error)
+	// ExpireLot expires what is left of a due lot and writes the matching
+	// expire entry. Points needed to cover active holds are left in the lot.
+	// It returns nil if nothing could be expired.
+	ExpireLot(ctx context.Context, lotID uuid.UUID, now time.Time) (*model.LoyaltyTransaction, error)
+	ListUpcomingExpirations(ctx context.Context, merchantID, customerID uuid.UUID, until time.Time) ([]*model.PointExpiration, error)
+
+	// ListPendingOutboxEvents returns unpublished domain events in the order
+	// they were written.
+	ListPendingOutboxEvents(ctx context.Context, limit int) ([]*model.OutboxEvent, error)
+	MarkOutboxEventsPublished(ctx context.Context, ids []uuid.UUID, publishedAt time.Time) error
+	PurgePublishedOutboxEvents(ctx context.Context, publishedBefore time.Time) (int64, error)
+
+	// RecordCustomerOrder, RecordCustomerOrderRefund and CancelCustomerOrder
+	// fold an order event into the customer's statistics, guarded by event
+	// like RecordEventLoyaltyTransaction. They report false if the customer
+	// does not exist.
+	RecordCustomerOrder(ctx context.Context, event *model.ProcessedEvent, o *model.CustomerOrder) (bool, error)
+	// RecordCustomerOrderRefund returns the refunded order, or nil if the
+	// customer does not exist. A refund for an order not recorded yet is
+	// kept on a pending order until RecordCustomerOrder.
+	RecordCustomerOrderRefund(ctx context.Context, event *model.ProcessedEvent, merchantID, customerID uuid.UUID, orderID string, amount *model.Money) (*model.CustomerOrder, error)
+	CancelCustomerOrder(ctx context.Context, event *model.ProcessedEvent, merchantID, customerID uuid.UUID, orderID string) (bool, error)
+	// GetCustomerStats returns nil if the customer has no recorded orders.
+	GetCustomerStats(ctx context.Context, merchantID, customerID uuid.UUID) (*model.CustomerStats, error)
+	ListCustomerStats(ctx context.Context, merchantID uuid.UUID, customerIDs []uuid.UUID) ([]*model.CustomerStats, error)
+	ListCustomerTags(ctx context.Context, customerIDs []uuid.UUID) (map[uuid.UUID][]string, error)
+
+	// CreateSegment and UpdateSegment evaluate the segment's membership in
+	// the same transaction. Membership is kept current for each customer
+	// whose data changes; EvaluateSegment catches up on time-based rules.
+	CreateSegment(ctx context.Context, s *model.CustomerSegment) error
+	UpdateSegment(ctx context.Context, s *model.CustomerSegment) (bool, error)
+	DeleteSegment(ctx context.Context, merchantID, id uuid.UUID) (bool, error)
+	ListSegments(ctx context.Context, merchantID uuid.UUID) ([]*model.CustomerSegment, error)
+	ListStaleSegments(ctx context.Context, evaluatedBefore time.Time, limit int) ([]*model.CustomerSegment, error)
+	EvaluateSegment(ctx context.Context, s *model.CustomerSegment) error
+
+	// GetMerchantSettings returns nil if the merchant has none.
+	GetMerchantSettings(ctx context.Context, merchantID uuid.UUID) (*model.MerchantSettings, error)
+	UpsertMerchantSettings(ctx context.Context, s *model.MerchantSettings) error
 }
 
 type pgRepository struct {
@@ -31,17 +155,31 @@ func NewPGRepository(db *sqlx.DB) Repository {
 
 func (r *pgRepository) Create(ctx context.Context, c *model.Customer) error {
 	query := `
-		INSERT INTO customers (id, merchant_id, name, phone, email, address, loyalty_points, created_at, updated_at)
-		VALUES (:id, :merchant_id, :name, :phone, :email, :address, :loyalty_points, :created_at, :updated_at)
+		INSERT INTO customers (id, merchant_id, name, phone, phone_e164, email, address, birthday, loyalty_points, created_at, updated_at)
+		VALUES (:id, :merchant_id, :name, :phone, :phone_e164, :email, :address, :birthday, :loyalty_points, :created_at, :updated_at)
 	`
-	_, err := r.db.NamedExecContext(ctx, query, c)
-	return err
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := checkPhoneAvailable(ctx, tx, c); err != nil {
+			return err
+		}
+		if _, err := tx.NamedExecContext(ctx, query, c); err != nil {
+			return err
+		}
+		if err := replaceCustomerTags(ctx, tx, c); err != nil {
+			return err
+		}
+		if err := insertOutboxEvent(ctx, tx, c.MerchantID, c.ID, model.EventCustomerCreated, model.NewCustomerEvent(c)); err != nil {
+			return err
+		}
+		return refreshCustomerSegments(ctx, tx, c.MerchantID, c.ID)
+	})
+	return mapWriteError(err)
 }
 
-func (r *pgRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Customer, error) {
+func (r *pgRepository) GetByID(ctx context.Context, merchantID, id uuid.UUID) (*model.Customer, error) {
 	var c model.Customer
-	query := `SELECT * FROM customers WHERE id = $1`
-	if err := r.db.GetContext(ctx, &c, query, id); err != nil {
+	query := `SELECT * FROM customers WHERE merchant_id = $1 AND id = $2 AND deleted_at IS NULL`
+	if err := r.db.GetContext(ctx, &c, query, merchantID, id); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -50,9 +188,20 @@ func (r *pgRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Custom
 	return &c, nil
 }
 
+func (r *pgRepository) GetCustomerMerchantID(ctx context.Context, id uuid.UUID) (*uuid.UUID, error) {
+	var merchantID uuid.UUID
+	if err := r.db.GetContext(ctx, &merchantID, `SELECT merchant_id FROM customers WHERE id = $1`, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &merchantID, nil
+}
+
 func (r *pgRepository) GetByPhone(ctx context.Context, merchantID uuid.UUID, phone string) (*model.Customer, error) {
 	var c model.Customer
-	query := `SELECT * FROM customers WHERE merchant_id = $1 AND phone = $2`
+	query := `SELECT * FROM customers WHERE merchant_id = $1 AND phone_e164 = $2 AND deleted_at IS NULL`
 	if err := r.db.GetContext(ctx, &c, query, merchantID, phone); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -62,64 +211,177 @@ func (r *pgRepository) GetByPhone(ctx context.Context, merchantID uuid.UUID, pho
 	return &c, nil
 }
 
-func (r *pgRepository) List(ctx context.Context, merchantID uuid.UUID, page, pageSize int, search string) ([]*model.Customer, int, error) {
-	offset := (page - 1) * pageSize
-	customers := []*model.Customer{}
-	var total int
-
-	// Base query
-	query := `SELECT * FROM customers WHERE merchant_id = $1`
-	countQuery := `SELECT COUNT(*) FROM customers WHERE merchant_id = $1`
-	args := []interface{}{merchantID}
-
-	// Add search if present
-	if search != "" {
-		wildcard := "%" + search + "%"
-		// Append params safely.
-		// Params: $1 is merchantID. Next are $2 and $3.
-		query += fmt.Sprintf(" AND (name ILIKE $%d OR phone ILIKE $%d)", len(args)+1, len(args)+2)
-		countQuery += fmt.Sprintf(" AND (name ILIKE $%d OR phone ILIKE $%d)", len(args)+1, len(args)+2)
-		args = append(args, wildcard, wildcard)
+// customerFieldColumns maps updatable fields to the columns they write.
+// Tags live in customer_tags and have no column.
+var customerFieldColumns = map[model.CustomerField][]string{
+	model.CustomerFieldName:     {"name"},
+	model.CustomerFieldPhone:    {"phone", "phone_e164"},
+	model.CustomerFieldEmail:    {"email"},
+	model.CustomerFieldAddress:  {"address"},
+	model.CustomerFieldBirthday: {"birthday"},
+}
+
+func (r *pgRepository) Update(ctx context.Context, c *model.Customer, fields []model.CustomerField) error {
+	c.UpdatedAt = time.Now()
+	sets := []string{"updated_at = :updated_at"}
+	var phoneChanged, tagsChanged bool
+	for _, f := range fields {
+		for _, col := range customerFieldColumns[f] {
+			sets = append(sets, col+" = :"+col)
+		}
+		phoneChanged = phoneChanged || f == model.CustomerFieldPhone
+		tagsChanged = tagsChanged || f == model.CustomerFieldTags
 	}
+	query := `
+		UPDATE customers
+		SET ` + strings.Join(sets, ", ") + `
+		WHERE id = :id AND merchant_id = :merchant_id AND deleted_at IS NULL
+	`
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if phoneChanged {
+			if err := checkPhoneAvailable(ctx, tx, c); err != nil {
+				return err
+			}
+		}
+		res, err := tx.NamedExecContext(ctx, query, c)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil || affected == 0 {
+			return err
+		}
+		if tagsChanged {
+			if err := replaceCustomerTags(ctx, tx, c); err != nil {
+				return err
+			}
+		}
+		if err := insertOutboxEvent(ctx, tx, c.MerchantID, c.ID, model.EventCustomerUpdated, model.NewCustomerEvent(c)); err != nil {
+			return err
+		}
+		return refreshCustomerSegments(ctx, tx, c.MerchantID, c.ID)
+	})
+	return mapWriteError(err)
+}
 
-	// Order and Limit
-	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
-	argsList := append(args, pageSize, offset)
+// Delete soft-deletes a customer. The row is kept until PurgeDeleted removes
+// it once the retention window has passed.
+func (r *pgRepository) Delete(ctx context.Context, merchantID, id uuid.UUID) error {
+	now := time.Now()
+	query := `
+		UPDATE customers
+		SET deleted_at = $1, updated_at = $1
+		WHERE merchant_id = $2 AND id = $3 AND deleted_at IS NULL
+	`
+	return r.withTx(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, query, now, merchantID, id)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil || affected == 0 {
+			return err
+		}
+		event := &model.CustomerDeletedEvent{ID: id, MerchantID: merchantID, DeletedAt: now}
+		if err := insertOutboxEvent(ctx, tx, merchantID, id, model.EventCustomerDeleted, event); err != nil {
+			return err
+		}
+		return refreshCustomerSegments(ctx, tx, merchantID, id)
+	})
+}
 
-	if err := r.db.SelectContext(ctx, &customers, query, argsList...); err != nil {
-		return nil, 0, err
+func (r *pgRepository) Restore(ctx context.Context, merchantID, id uuid.UUID) (*model.Customer, error) {
+	var c model.Customer
+	query := `
+		UPDATE customers
+		SET deleted_at = NULL, updated_at = $1
+		WHERE merchant_id = $2 AND id = $3 AND deleted_at IS NOT NULL
+		RETURNING *
+	`
+	var found bool
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.GetContext(ctx, &c, query, time.Now(), merchantID, id); err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+		// Another customer may have taken the number while this one was
+		// deleted.
+		if err := checkPhoneAvailable(ctx, tx, &c); err != nil {
+			return err
+		}
+		found = true
+		// Consumers that dropped the customer on CustomerDeleted get the
+		// full record back.
+		if err := insertOutboxEvent(ctx, tx, merchantID, id, model.EventCustomerUpdated, model.NewCustomerEvent(&c)); err != nil {
+			return err
+		}
+		return refreshCustomerSegments(ctx, tx, merchantID, id)
+	})
+	if err != nil {
+		return nil, mapWriteError(err)
 	}
-
-	if err := r.db.GetContext(ctx, &total, countQuery, args...); err != nil {
-		return nil, 0, err
+	if !found {
+		return nil, nil
 	}
+	return &c, nil
+}
 
-	return customers, total, nil
+func (r *pgRepository) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	query := `DELETE FROM customers WHERE deleted_at IS NOT NULL AND deleted_at < $1`
+	res, err := r.db.ExecContext(ctx, query, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
 }
 
-func (r *pgRepository) Update(ctx context.Context, c *model.Customer) error {
-	c.UpdatedAt = time.Now()
+// checkPhoneAvailable reports ErrDuplicatePhone if another live customer of
+// the merchant has the same normalized phone. Until migration 000019 has
+// made phone_e164 unique, only this check catches duplicates that differ in
+// formatting. It holds a transaction-level advisory lock on the
+// merchant and number, so concurrent writes of the same number queue up and
+// the later one sees the earlier one's row.
+func checkPhoneAvailable(ctx context.Context, tx *sqlx.Tx, c *model.Customer) error {
+	if c.PhoneE164 == nil {
+		return nil
+	}
+	lock := `SELECT pg_advisory_xact_lock(hashtext($1), hashtext($2))`
+	if _, err := tx.ExecContext(ctx, lock, c.MerchantID.String(), *c.PhoneE164); err != nil {
+		return err
+	}
+	var taken bool
 	query := `
-		UPDATE customers 
-		SET name = :name, phone = :phone, email = :email, address = :address, updated_at = :updated_at
-		WHERE id = :id
+		SELECT EXISTS (
+			SELECT 1 FROM customers
+			WHERE merchant_id = $1 AND phone_e164 = $2 AND id <> $3 AND deleted_at IS NULL
+		)
 	`
-	_, err := r.db.NamedExecContext(ctx, query, c)
-	return err
+	if err := tx.GetContext(ctx, &taken, query, c.MerchantID, *c.PhoneE164, c.ID); err != nil {
+		return err
+	}
+	if taken {
+		return ErrDuplicatePhone
+	}
+	return nil
 }
 
-func (r *pgRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM customers WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, id)
+// mapWriteError converts driver errors for known customer constraints into
+// repository errors.
+func mapWriteError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%w: %v", ErrDuplicatePhone, err)
+	}
 	return err
 }
 
-func (r *pgRepository) AddLoyaltyPoints(ctx context.Context, id uuid.UUID, points int32) error {
-	query := `
-		UPDATE customers 
-		SET loyalty_points = loyalty_points + $1, updated_at = $2
-		WHERE id = $3
-	`
-	_, err := r.db.ExecContext(ctx, query, points, time.Now(), id)
-	return err
+// isUniqueViolation reports whether err is a Postgres unique_violation. Both
+// lib/pq and pgx expose the SQLSTATE through SQLState().
+func isUniqueViolation(err error) bool {
+	var pgErr interface{ SQLState() string }
+	return errors.As(err, &pgErr) && pgErr.SQLState() == uniqueViolation
 }
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/google/uuid"
+)
+
+// TestMerchantScoping runs every customer and loyalty query against another
+// merchant's customer and hold, and checks each one finds nothing and
+// changes nothing.
+func TestMerchantScoping(t *testing.T) {
+	repo := NewPGRepository(testDB(t))
+	ctx := context.Background()
+	owner, other := uuid.New(), uuid.New()
+
+	live := createTestCustomer(t, repo, owner, "Ann Tan", "0812 3456 7890", "+6281234567890", "ann@example.com", "")
+	deleted := createTestCustomer(t, repo, owner, "Budi Santoso", "0813 0000 0000", "+6281300000000", "", "")
+	if err := repo.Delete(ctx, owner, deleted.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := repo.RecordLoyaltyTransaction(ctx, &model.LoyaltyTransaction{
+		MerchantID: owner, CustomerID: live.ID, Type: model.LoyaltyTransactionAdjust, Delta: 100, Actor: "test",
+	}); err != nil {
+		t.Fatalf("seed points: %v", err)
+	}
+	hold, err := repo.CreateLoyaltyHold(ctx, &model.LoyaltyHold{
+		MerchantID: owner, CustomerID: live.ID, Points: 10, ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil || hold == nil {
+		t.Fatalf("seed hold: %v, %v", hold, err)
+	}
+
+	t.Run("GetByID", func(t *testing.T) {
+		if c, err := repo.GetByID(ctx, other, live.ID); err != nil || c != nil {
+			t.Errorf("got %v, %v, want nil", c, err)
+		}
+	})
+	t.Run("Update", func(t *testing.T) {
+		c := *live
+		c.MerchantID, c.Name = other, "Mallory"
+		if err := repo.Update(ctx, &c, []model.CustomerField{model.CustomerFieldName}); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+	})
+	t.Run("Delete", func(t *testing.T) {
+		if err := repo.Delete(ctx, other, live.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+	})
+	t.Run("Restore", func(t *testing.T) {
+		if c, err := repo.Restore(ctx, other, deleted.ID); err != nil || c != nil {
+			t.Errorf("got %v, %v, want nil", c, err)
+		}
+	})
+	t.Run("RecordLoyaltyTransaction", func(t *testing.T) {
+		tx, err := repo.RecordLoyaltyTransaction(ctx, &model.LoyaltyTransaction{
+			MerchantID: other, CustomerID: live.ID, Type: model.LoyaltyTransactionAdjust, Delta: 50, Actor: "test",
+		})
+		if err != nil || tx != nil {
+			t.Errorf("got %v, %v, want nil", tx, err)
+		}
+	})
+	t.Run("ListLoyaltyTransactions", func(t *testing.T) {
+		txs, total, err := repo.ListLoyaltyTransactions(ctx, other, live.ID, 1, 50)
+		if err != nil || len(txs) != 0 || total != 0 {
+			t.Errorf("got %d entries (total %d), %v, want none", len(txs), total, err)
+		}
+	})
+	t.Run("CreateLoyaltyHold", func(t *testing.T) {
+		h, err := repo.CreateLoyaltyHold(ctx, &model.LoyaltyHold{
+			MerchantID: other, CustomerID: live.ID, Points: 10, ExpiresAt: time.Now().Add(time.Hour),
+		})
+		if err != nil || h != nil {
+			t.Errorf("got %v, %v, want nil", h, err)
+		}
+	})
+	t.Run("ConfirmLoyaltyHold", func(t *testing.T) {
+		if tx, err := repo.ConfirmLoyaltyHold(ctx, other, hold.ID, "test"); err != nil || tx != nil {
+			t.Errorf("got %v, %v, want nil", tx, err)
+		}
+	})
+	t.Run("CancelLoyaltyHold", func(t *testing.T) {
+		if h, err := repo.CancelLoyaltyHold(ctx, other, hold.ID); err != nil || h != nil {
+			t.Errorf("got %v, %v, want nil", h, err)
+		}
+	})
+	t.Run("ListTierHistory", func(t *testing.T) {
+		if changes, err := repo.ListTierHistory(ctx, other, live.ID); err != nil || len(changes) != 0 {
+			t.Errorf("got %d changes, %v, want none", len(changes), err)
+		}
+	})
+	t.Run("ListUpcomingExpirations", func(t *testing.T) {
+		exps, err := repo.ListUpcomingExpirations(ctx, other, live.ID, time.Now().AddDate(10, 0, 0))
+		if err != nil || len(exps) != 0 {
+			t.Errorf("got %d expirations, %v, want none", len(exps), err)
+		}
+	})
+
+	// Nothing the other merchant did reached the owner's data.
+	c, err := repo.GetByID(ctx, owner, live.ID)
+	if err != nil || c == nil {
+		t.Fatalf("owner lost its customer: %v, %v", c, err)
+	}
+	if c.Name != "Ann Tan" || c.LoyaltyPoints != 100 {
+		t.Errorf("customer changed by another merchant: name %q, points %d", c.Name, c.LoyaltyPoints)
+	}
+	if c, err := repo.GetByID(ctx, owner, deleted.ID); err != nil || c != nil {
+		t.Errorf("deleted customer restored by another merchant: %v, %v", c, err)
+	}
+	if tx, err := repo.ConfirmLoyaltyHold(ctx, owner, hold.ID, "test"); err != nil || tx == nil {
+		t.Errorf("owner cannot confirm its hold: %v, %v", tx, err)
+	}
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Search expressions. Each must match its index in
+// 000014_add_customer_search_indexes or 000018_add_customer_phone_e164_search_index
+// exactly, or Postgres falls back to a sequential scan.
+const (
+	searchDocument = `to_tsvector('simple', c.name || ' ' || COALESCE(c.email, '') || ' ' || COALESCE(c.address, ''))`
+	searchName     = `lower(c.name)`
+	searchEmail    = `lower(COALESCE(c.email, ''))`
+	searchPhone    = `regexp_replace(c.phone, '\D', '', 'g')`
+	searchE164     = `COALESCE(c.phone_e164, '')`
+)
+
+// minPhoneDigits is the shortest query matched against phone numbers, so a
+// couple of digits do not match most customers.
+const minPhoneDigits = 3
+
+// customerSearch adds the condition matching search to b and returns an
+// expression ranking matches by relevance.
+//
+// A customer matches on any of: full-text terms across name, email and
+// address; a name similar enough to survive typos; a substring of name or
+// email; or, for queries made only of phone characters, a substring of the
+// digits of the phone as entered or of its E.164 form. A number entered as
+// 0812 3456 7890 is found by "0812 3456" through the former and by
+// "+62 812-3456" through the latter.
+func customerSearch(b *queryBuilder, search string) string {
+	text := strings.ToLower(strings.TrimSpace(search))
+	q := b.arg(text)
+	pattern := b.arg("%" + escapeLike(text) + "%")
+	tsquery := "plainto_tsquery('simple', " + q + ")"
+
+	conds := []string{
+		searchDocument + " @@ " + tsquery,
+		searchName + " % " + q,
+		searchName + " LIKE " + pattern,
+		searchEmail + " LIKE " + pattern,
+	}
+	ranks := []string{
+		"ts_rank(" + searchDocument + ", " + tsquery + ")",
+		"similarity(" + searchName + ", " + q + ")",
+		"similarity(" + searchEmail + ", " + q + ")",
+	}
+
+	if digits := phoneDigits(text); len(digits) >= minPhoneDigits {
+		exact := b.arg(digits)
+		partial := b.arg("%" + digits + "%")
+		e164 := b.arg("+" + digits)
+		conds = append(conds, searchPhone+" LIKE "+partial, searchE164+" LIKE "+partial)
+		ranks = append(ranks,
+			"CASE WHEN "+searchPhone+" = "+exact+" OR "+searchE164+" = "+e164+" THEN 1"+
+				" WHEN "+searchPhone+" LIKE "+partial+" OR "+searchE164+" LIKE "+partial+" THEN 0.8 ELSE 0 END")
+	}
+
+	b.where("(" + strings.Join(conds, " OR ") + ")")
+	return "GREATEST(" + strings.Join(ranks, ", ") + ")"
+}
+
+// phoneDigits returns the digits of s if it looks like a phone number, that
+// is, it has no letters.
+func phoneDigits(s string) string {
+	if strings.IndexFunc(s, unicode.IsLetter) >= 0 {
+		return ""
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// escapeLike escapes LIKE wildcards so s matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/fekuna/omnipos-pkg/database/postgres"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// testDB connects to the database in TEST_DATABASE_URL, which must already
+// be migrated (see make test_repository). Tests are skipped without it. Each
+// test works under fresh merchant IDs, so runs do not interfere.
+func testDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	raw := os.Getenv("TEST_DATABASE_URL")
+	if raw == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parse TEST_DATABASE_URL: %v", err)
+	}
+	password, _ := u.User.Password()
+	sslMode := u.Query().Get("sslmode")
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	db, err := postgres.NewPostgres(&postgres.Config{
+		Host:            u.Hostname(),
+		Port:            u.Port(),
+		User:            u.User.Username(),
+		Password:        password,
+		DBName:          strings.TrimPrefix(u.Path, "/"),
+		SSLMode:         sslMode,
+		MaxOpenConns:    5,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: time.Minute,
+		ConnMaxIdleTime: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("connect to test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func createTestCustomer(t *testing.T, repo Repository, merchantID uuid.UUID, name, phone, e164, email, address string) *model.Customer {
+	t.Helper()
+	now := time.Now()
+	c := &model.Customer{
+		ID:         uuid.New(),
+		MerchantID: merchantID,
+		Name:       name,
+		Phone:      phone,
+		PhoneE164:  &e164,
+		Email:      email,
+		Address:    address,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := repo.Create(context.Background(), c); err != nil {
+		t.Fatalf("create %s: %v", name, err)
+	}
+	return c
+}
+
+func TestCustomerSearch(t *testing.T) {
+	repo := NewPGRepository(testDB(t))
+	ctx := context.Background()
+	merchant, other := uuid.New(), uuid.New()
+
+	createTestCustomer(t, repo, merchant, "Ann Tan", "0812 3456 7890", "+6281234567890", "ann@example.com", "Jalan Merdeka 1")
+	createTestCustomer(t, repo, merchant, "Budi Santoso", "+62 857-1111-2222", "+6285711112222", "budi@shop.id", "")
+	deleted := createTestCustomer(t, repo, merchant, "Ann Deleted", "0813 0000 0000", "+6281300000000", "", "")
+	if err := repo.Delete(ctx, merchant, deleted.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	// Same name and phone under another merchant.
+	createTestCustomer(t, repo, other, "Ann Tan", "0812 3456 7890", "+6281234567890", "", "")
+
+	tests := []struct {
+		name   string
+		search string
+		want   []string
+	}{
+		{"name substring", "ann", []string{"Ann Tan"}},
+		{"name typo", "budi santosa", []string{"Budi Santoso"}},
+		{"address term", "merdeka", []string{"Ann Tan"}},
+		{"email substring", "shop.id", []string{"Budi Santoso"}},
+		{"phone as entered", "0812 3456", []string{"Ann Tan"}},
+		{"phone in international form", "+62 812-3456", []string{"Ann Tan"}},
+		{"exact E.164", "+6285711112222", []string{"Budi Santoso"}},
+		{"phone digits in the middle", "3456 7890", []string{"Ann Tan"}},
+		{"too few digits", "12", nil},
+		{"no match", "zzzz", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := repo.List(ctx, merchant, model.CustomerListOptions{PageSize: 50, Search: tt.search})
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			var got []string
+			for _, c := range page.Customers {
+				got = append(got, c.Name)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("search %q = %v, want %v", tt.search, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomerSearchRanksExactPhoneFirst(t *testing.T) {
+	repo := NewPGRepository(testDB(t))
+	merchant := uuid.New()
+
+	createTestCustomer(t, repo, merchant, "Partial", "0812 3456 7891 2", "+62812345678912", "", "")
+	createTestCustomer(t, repo, merchant, "Exact", "0812 3456 7891", "+6281234567891", "", "")
+
+	page, err := repo.List(context.Background(), merchant, model.CustomerListOptions{
+		PageSize:   50,
+		Search:     "+62 812 3456 7891",
+		SortBy:     model.SortByRelevance,
+		Descending: true,
+	})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(page.Customers) != 2 || page.Customers[0].Name != "Exact" {
+		var got []string
+		for _, c := range page.Customers {
+			got = append(got, c.Name)
+		}
+		t.Errorf("got %v, want Exact ranked first of two", got)
+	}
+}
@@ -0,0 +1,283 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrDuplicateSegmentName is returned when a merchant already has a segment
+// with the same name.
+var ErrDuplicateSegmentName = errors.New("customer segment name already exists")
+
+// segmentFieldColumns whitelists the expressions numeric segment rules may
+// compare. They are evaluated over customers c LEFT JOIN customer_stats s.
+var segmentFieldColumns = map[model.SegmentField]string{
+	model.SegmentFieldRecencyDays:       "(CURRENT_DATE - s.last_purchase_at::date)",
+	model.SegmentFieldFrequency:         "COALESCE(s.order_count, 0)",
+	model.SegmentFieldMonetary:          "COALESCE(s.lifetime_spend, 0)",
+	model.SegmentFieldAverageOrderValue: "COALESCE(s.average_order_value, 0)",
+	model.SegmentFieldCustomerAgeDays:   "(CURRENT_DATE - c.created_at::date)",
+	model.SegmentFieldLoyaltyPoints:     "c.loyalty_points",
+}
+
+var segmentOperators = map[model.SegmentOperator]string{
+	model.SegmentOpEq:  "=",
+	model.SegmentOpNeq: "<>",
+	model.SegmentOpGt:  ">",
+	model.SegmentOpGte: ">=",
+	model.SegmentOpLt:  "<",
+	model.SegmentOpLte: "<=",
+}
+
+// segmentPredicate adds the conditions of rules to b. Field and operator
+// names never reach the SQL; only whitelisted expressions do.
+func segmentPredicate(b *queryBuilder, rules model.SegmentRules) error {
+	for _, rule := range rules {
+		op, ok := segmentOperators[rule.Operator]
+		if !ok {
+			return fmt.Errorf("unsupported segment operator %q", rule.Operator)
+		}
+
+		switch rule.Field {
+		case model.SegmentFieldTier:
+			id, err := uuid.Parse(rule.Value)
+			if err != nil {
+				return fmt.Errorf("segment tier: %w", err)
+			}
+			switch rule.Operator {
+			case model.SegmentOpEq:
+				b.where("c.tier_id = " + b.arg(id))
+			case model.SegmentOpNeq:
+				b.where("c.tier_id IS DISTINCT FROM " + b.arg(id))
+			default:
+				return fmt.Errorf("unsupported operator %q for tier", rule.Operator)
+			}
+		case model.SegmentFieldTag:
+			exists := "EXISTS (SELECT 1 FROM customer_tags t WHERE t.customer_id = c.id AND t.tag = " + b.arg(rule.Value) + ")"
+			switch rule.Operator {
+			case model.SegmentOpEq:
+				b.where(exists)
+			case model.SegmentOpNeq:
+				b.where("NOT " + exists)
+			default:
+				return fmt.Errorf("unsupported operator %q for tag", rule.Operator)
+			}
+		default:
+			column, ok := segmentFieldColumns[rule.Field]
+			if !ok {
+				return fmt.Errorf("unsupported segment field %q", rule.Field)
+			}
+			value, err := strconv.ParseInt(rule.Value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("segment %s: %w", rule.Field, err)
+			}
+			b.where(column + " " + op + " " + b.arg(value))
+		}
+	}
+	return nil
+}
+
+func (r *pgRepository) CreateSegment(ctx context.Context, s *model.CustomerSegment) error {
+	s.CreatedAt = time.Now()
+	s.UpdatedAt = s.CreatedAt
+	query := `
+		INSERT INTO customer_segments (id, merchant_id, name, description, rules, created_at, updated_at)
+		VALUES (:id, :merchant_id, :name, :description, :rules, :created_at, :updated_at)
+	`
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.NamedExecContext(ctx, query, s); err != nil {
+			return err
+		}
+		return evaluateSegment(ctx, tx, s, nil)
+	})
+	return mapSegmentWriteError(err)
+}
+
+func (r *pgRepository) UpdateSegment(ctx context.Context, s *model.CustomerSegment) (bool, error) {
+	s.UpdatedAt = time.Now()
+	query := `
+		UPDATE customer_segments
+		SET name = :name, description = :description, rules = :rules, updated_at = :updated_at
+		WHERE id = :id AND merchant_id = :merchant_id
+	`
+	var updated bool
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.NamedExecContext(ctx, query, s)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil || affected == 0 {
+			return err
+		}
+		updated = true
+		return evaluateSegment(ctx, tx, s, nil)
+	})
+	return updated, mapSegmentWriteError(err)
+}
+
+func (r *pgRepository) DeleteSegment(ctx context.Context, merchantID, id uuid.UUID) (bool, error) {
+	query := `DELETE FROM customer_segments WHERE merchant_id = $1 AND id = $2`
+	res, err := r.db.ExecContext(ctx, query, merchantID, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (r *pgRepository) ListSegments(ctx context.Context, merchantID uuid.UUID) ([]*model.CustomerSegment, error) {
+	segments := []*model.CustomerSegment{}
+	query := `
+		SELECT g.*, (
+			SELECT COUNT(*) FROM customer_segment_members m
+			JOIN customers c ON c.id = m.customer_id AND c.deleted_at IS NULL
+			WHERE m.segment_id = g.id
+		) AS member_count
+		FROM customer_segments g
+		WHERE g.merchant_id = $1
+		ORDER BY g.name
+	`
+	if err := r.db.SelectContext(ctx, &segments, query, merchantID); err != nil {
+		return nil, err
+	}
+	return segments, nil
+}
+
+func (r *pgRepository) ListStaleSegments(ctx context.Context, evaluatedBefore time.Time, limit int) ([]*model.CustomerSegment, error) {
+	segments := []*model.CustomerSegment{}
+	query := `
+		SELECT * FROM customer_segments
+		WHERE evaluated_at IS NULL OR evaluated_at < $1
+		ORDER BY evaluated_at NULLS FIRST
+		LIMIT $2
+	`
+	if err := r.db.SelectContext(ctx, &segments, query, evaluatedBefore, limit); err != nil {
+		return nil, err
+	}
+	return segments, nil
+}
+
+func (r *pgRepository) EvaluateSegment(ctx context.Context, s *model.CustomerSegment) error {
+	return r.withTx(ctx, func(tx *sqlx.Tx) error {
+		return evaluateSegment(ctx, tx, s, nil)
+	})
+}
+
+// evaluateSegment brings the segment's membership in line with its rules,
+// for every customer of the merchant or only customerID if it is set. Full
+// evaluations also stamp evaluated_at.
+func evaluateSegment(ctx context.Context, tx *sqlx.Tx, s *model.CustomerSegment, customerID *uuid.UUID) error {
+	b := &queryBuilder{}
+	b.where("c.merchant_id = " + b.arg(s.MerchantID))
+	b.where("c.deleted_at IS NULL")
+	var customer string
+	if customerID != nil {
+		customer = b.arg(*customerID)
+		b.where("c.id = " + customer)
+	}
+	if err := segmentPredicate(b, s.Rules); err != nil {
+		return err
+	}
+	matching := "SELECT c.id FROM customers c LEFT JOIN customer_stats s ON s.customer_id = c.id" + b.clause()
+	segment := b.arg(s.ID)
+
+	// Both statements reference every parameter, so they share b.args.
+	removeQuery := "DELETE FROM customer_segment_members WHERE segment_id = " + segment + " AND customer_id NOT IN (" + matching + ")"
+	if customerID != nil {
+		removeQuery += " AND customer_id = " + customer
+	}
+	if _, err := tx.ExecContext(ctx, removeQuery, b.args...); err != nil {
+		return err
+	}
+
+	addQuery := "INSERT INTO customer_segment_members (segment_id, customer_id, joined_at)" +
+		" SELECT " + segment + "::uuid, id, NOW() FROM (" + matching + ") matched" +
+		" ON CONFLICT (segment_id, customer_id) DO NOTHING"
+	if _, err := tx.ExecContext(ctx, addQuery, b.args...); err != nil {
+		return err
+	}
+
+	if customerID == nil {
+		now := time.Now()
+		s.EvaluatedAt = &now
+		stampQuery := `UPDATE customer_segments SET evaluated_at = $1 WHERE id = $2`
+		if _, err := tx.ExecContext(ctx, stampQuery, now, s.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshCustomerSegments re-evaluates every segment of the merchant for one
+// customer. It is called in the transaction that changed the customer, so
+// membership never lags behind their data.
+func refreshCustomerSegments(ctx context.Context, tx *sqlx.Tx, merchantID, customerID uuid.UUID) error {
+	segments := []*model.CustomerSegment{}
+	query := `SELECT * FROM customer_segments WHERE merchant_id = $1`
+	if err := tx.SelectContext(ctx, &segments, query, merchantID); err != nil {
+		return err
+	}
+	for _, s := range segments {
+		if err := evaluateSegment(ctx, tx, s, &customerID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceCustomerTags sets the customer's tags to exactly c.Tags.
+func replaceCustomerTags(ctx context.Context, tx *sqlx.Tx, c *model.Customer) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM customer_tags WHERE customer_id = $1`, c.ID); err != nil {
+		return err
+	}
+	query := `INSERT INTO customer_tags (customer_id, merchant_id, tag) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+	for _, tag := range c.Tags {
+		if _, err := tx.ExecContext(ctx, query, c.ID, c.MerchantID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *pgRepository) ListCustomerTags(ctx context.Context, customerIDs []uuid.UUID) (map[uuid.UUID][]string, error) {
+	tags := make(map[uuid.UUID][]string, len(customerIDs))
+	if len(customerIDs) == 0 {
+		return tags, nil
+	}
+	query, args, err := sqlx.In(`SELECT customer_id, tag FROM customer_tags WHERE customer_id IN (?) ORDER BY tag`, customerIDs)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryxContext(ctx, r.db.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var customerID uuid.UUID
+		var tag string
+		if err := rows.Scan(&customerID, &tag); err != nil {
+			return nil, err
+		}
+		tags[customerID] = append(tags[customerID], tag)
+	}
+	return tags, rows.Err()
+}
+
+func mapSegmentWriteError(err error) error {
+	if err != nil && isUniqueViolation(err) {
+		return fmt.Errorf("%w: %v", ErrDuplicateSegmentName, err)
+	}
+	return err
+}
@@ -0,0 +1,354 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+func (r *pgRepository) RecordCustomerOrder(ctx context.Context, event *model.ProcessedEvent, o *model.CustomerOrder) (bool, error) {
+	var found bool
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := markEventProcessed(ctx, tx, event); err != nil {
+			return err
+		}
+		var err error
+		found, err = lockCustomer(ctx, tx, o.MerchantID, o.CustomerID)
+		if err != nil || !found {
+			return err
+		}
+
+		// An order refunded before it was seen takes over its pending row,
+		// and the refunds recorded there. Refunds in another currency cannot
+		// be applied to it and are dropped.
+		query := `
+			INSERT INTO customer_orders (merchant_id, order_id, customer_id, store_id, total_amount, currency, ordered_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (merchant_id, order_id) DO UPDATE SET
+				store_id = EXCLUDED.store_id,
+				total_amount = EXCLUDED.total_amount,
+				refunded_amount = CASE
+					WHEN customer_orders.refunded_in_full THEN EXCLUDED.total_amount
+					WHEN customer_orders.currency = EXCLUDED.currency THEN LEAST(customer_orders.refunded_amount, EXCLUDED.total_amount)
+					ELSE 0
+				END,
+				currency = EXCLUDED.currency,
+				ordered_at = EXCLUDED.ordered_at,
+				pending = FALSE,
+				refunded_in_full = FALSE
+			WHERE customer_orders.pending AND customer_orders.customer_id = EXCLUDED.customer_id
+			RETURNING refunded_amount, cancelled
+		`
+		var recorded struct {
+			RefundedAmount int64 `db:"refunded_amount"`
+			Cancelled      bool  `db:"cancelled"`
+		}
+		err = tx.GetContext(ctx, &recorded, query, o.MerchantID, o.OrderID, o.CustomerID, o.StoreID, o.TotalAmount, o.Currency, o.OrderedAt)
+		if err == sql.ErrNoRows {
+			// Already recorded under another event ID.
+			return nil
+		}
+		if err != nil || recorded.Cancelled {
+			return err
+		}
+		order := *o
+		order.RefundedAmount = recorded.RefundedAmount
+		if err := addOrderToStats(ctx, tx, &order); err != nil {
+			return err
+		}
+		if err := reevaluateSpendTier(ctx, tx, o.MerchantID, o.CustomerID); err != nil {
+			return err
+		}
+		return refreshCustomerSegments(ctx, tx, o.MerchantID, o.CustomerID)
+	})
+	return found, err
+}
+
+func (r *pgRepository) RecordCustomerOrderRefund(ctx context.Context, event *model.ProcessedEvent, merchantID, customerID uuid.UUID, orderID string, amount *model.Money) (*model.CustomerOrder, error) {
+	var order *model.CustomerOrder
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := markEventProcessed(ctx, tx, event); err != nil {
+			return err
+		}
+		found, err := lockCustomer(ctx, tx, merchantID, customerID)
+		if err != nil || !found {
+			return err
+		}
+
+		order = &model.CustomerOrder{}
+		selectQuery := `SELECT * FROM customer_orders WHERE merchant_id = $1 AND order_id = $2 AND customer_id = $3`
+		err = tx.GetContext(ctx, order, selectQuery, merchantID, orderID, customerID)
+		if err == sql.ErrNoRows {
+			// The refund arrived before its order, or the order predates
+			// statistics. Either way it is kept for OrderCreated.
+			order = &model.CustomerOrder{
+				MerchantID:     merchantID,
+				OrderID:        orderID,
+				CustomerID:     customerID,
+				OrderedAt:      time.Now(),
+				Pending:        true,
+				RefundedInFull: amount == nil,
+			}
+			if amount != nil {
+				order.TotalAmount, order.RefundedAmount, order.Currency = amount.Amount, amount.Amount, amount.Currency
+			}
+			insertQuery := `
+				INSERT INTO customer_orders (merchant_id, order_id, customer_id, total_amount, refunded_amount, currency, ordered_at, pending, refunded_in_full)
+				VALUES (:merchant_id, :order_id, :customer_id, :total_amount, :refunded_amount, :currency, :ordered_at, :pending, :refunded_in_full)
+				ON CONFLICT (merchant_id, order_id) DO NOTHING
+			`
+			_, err = tx.NamedExecContext(ctx, insertQuery, order)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if order.Pending {
+			// Until the order is seen, its refunds are only accumulated.
+			switch {
+			case order.RefundedInFull:
+				return nil
+			case amount == nil:
+				order.RefundedInFull = true
+			case amount.Currency != order.Currency:
+				return ErrCurrencyMismatch
+			default:
+				order.TotalAmount += amount.Amount
+				order.RefundedAmount = order.TotalAmount
+			}
+			pendingQuery := `
+				UPDATE customer_orders SET total_amount = $1, refunded_amount = $2, refunded_in_full = $3
+				WHERE merchant_id = $4 AND order_id = $5
+			`
+			_, err := tx.ExecContext(ctx, pendingQuery, order.TotalAmount, order.RefundedAmount, order.RefundedInFull, merchantID, orderID)
+			return err
+		}
+
+		refunded := order.TotalAmount
+		if amount != nil {
+			if amount.Currency != order.Currency {
+				return ErrCurrencyMismatch
+			}
+			refunded = order.RefundedAmount + amount.Amount
+			if refunded > order.TotalAmount {
+				refunded = order.TotalAmount
+			}
+		}
+		if refunded == order.RefundedAmount {
+			return nil
+		}
+		updateQuery := `UPDATE customer_orders SET refunded_amount = $1 WHERE merchant_id = $2 AND order_id = $3`
+		if _, err := tx.ExecContext(ctx, updateQuery, refunded, merchantID, orderID); err != nil {
+			return err
+		}
+		if !order.Cancelled {
+			// Only spend in the customer's stats currency is counted.
+			statsQuery := `
+				UPDATE customer_stats SET lifetime_spend = lifetime_spend - $1, updated_at = $2
+				WHERE customer_id = $3 AND currency = $4
+			`
+			if _, err := tx.ExecContext(ctx, statsQuery, refunded-order.RefundedAmount, time.Now(), customerID, order.Currency); err != nil {
+				return err
+			}
+		}
+		order.RefundedAmount = refunded
+		if err := reevaluateSpendTier(ctx, tx, merchantID, customerID); err != nil {
+			return err
+		}
+		return refreshCustomerSegments(ctx, tx, merchantID, customerID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func (r *pgRepository) CancelCustomerOrder(ctx context.Context, event *model.ProcessedEvent, merchantID, customerID uuid.UUID, orderID string) (bool, error) {
+	var found bool
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := markEventProcessed(ctx, tx, event); err != nil {
+			return err
+		}
+		var err error
+		found, err = lockCustomer(ctx, tx, merchantID, customerID)
+		if err != nil || !found {
+			return err
+		}
+
+		query := `UPDATE customer_orders SET cancelled = TRUE WHERE merchant_id = $1 AND order_id = $2 AND customer_id = $3 AND NOT cancelled`
+		res, err := tx.ExecContext(ctx, query, merchantID, orderID, customerID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		// Removing an order can move the first and last purchase, the
+		// spend currency and the favourite store, none of which can be
+		// worked out from the totals alone.
+		if err := refreshCustomerStats(ctx, tx, merchantID, customerID); err != nil {
+			return err
+		}
+		if err := reevaluateSpendTier(ctx, tx, merchantID, customerID); err != nil {
+			return err
+		}
+		return refreshCustomerSegments(ctx, tx, merchantID, customerID)
+	})
+	return found, err
+}
+
+func (r *pgRepository) GetCustomerStats(ctx context.Context, merchantID, customerID uuid.UUID) (*model.CustomerStats, error) {
+	var s model.CustomerStats
+	query := `SELECT * FROM customer_stats WHERE merchant_id = $1 AND customer_id = $2`
+	if err := r.db.GetContext(ctx, &s, query, merchantID, customerID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *pgRepository) ListCustomerStats(ctx context.Context, merchantID uuid.UUID, customerIDs []uuid.UUID) ([]*model.CustomerStats, error) {
+	stats := []*model.CustomerStats{}
+	if len(customerIDs) == 0 {
+		return stats, nil
+	}
+	query, args, err := sqlx.In(`SELECT * FROM customer_stats WHERE merchant_id = ? AND customer_id IN (?)`, merchantID, customerIDs)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.db.SelectContext(ctx, &stats, r.db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// lockCustomer locks a live customer row for the rest of the transaction,
+// reporting false if there is none.
+func lockCustomer(ctx context.Context, tx *sqlx.Tx, merchantID, customerID uuid.UUID) (bool, error) {
+	_, found, err := lockBalance(ctx, tx, merchantID, customerID)
+	return found, err
+}
+
+// favouriteStoreQuery selects the favourite store of customer $1 from
+// customer_store_stats.
+const favouriteStoreQuery = `
+	SELECT store_id FROM customer_store_stats
+	WHERE customer_id = $1 AND order_count > 0
+	ORDER BY order_count DESC, last_ordered_at DESC
+	LIMIT 1
+`
+
+// addOrderToStats adds a newly recorded order to the customer's statistics.
+// The customer row must already be locked. Spend is counted in the currency
+// of the customer's first order, so an order in another currency that
+// predates it changes which orders count, and everything is recomputed.
+func addOrderToStats(ctx context.Context, tx *sqlx.Tx, o *model.CustomerOrder) error {
+	var current struct {
+		Currency        *string    `db:"currency"`
+		FirstPurchaseAt *time.Time `db:"first_purchase_at"`
+	}
+	err := tx.GetContext(ctx, &current, `SELECT currency, first_purchase_at FROM customer_stats WHERE customer_id = $1`, o.CustomerID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if current.Currency != nil && *current.Currency != o.Currency && current.FirstPurchaseAt != nil && o.OrderedAt.Before(*current.FirstPurchaseAt) {
+		return refreshCustomerStats(ctx, tx, o.MerchantID, o.CustomerID)
+	}
+
+	if o.StoreID != nil {
+		storeQuery := `
+			INSERT INTO customer_store_stats (customer_id, store_id, order_count, last_ordered_at)
+			VALUES ($1, $2, 1, $3)
+			ON CONFLICT (customer_id, store_id) DO UPDATE SET
+				order_count = customer_store_stats.order_count + 1,
+				last_ordered_at = GREATEST(customer_store_stats.last_ordered_at, EXCLUDED.last_ordered_at)
+		`
+		if _, err := tx.ExecContext(ctx, storeQuery, o.CustomerID, *o.StoreID, o.OrderedAt); err != nil {
+			return err
+		}
+	}
+
+	// A customer whose orders were all cancelled has no stats currency, and
+	// takes this order's.
+	query := `
+		INSERT INTO customer_stats (customer_id, merchant_id, order_count, lifetime_spend, currency, first_purchase_at, last_purchase_at, favourite_store_id, updated_at)
+		VALUES ($1, $2, 1, $3, $4, $5, $5, (` + favouriteStoreQuery + `), $6)
+		ON CONFLICT (customer_id) DO UPDATE SET
+			order_count = customer_stats.order_count + 1,
+			lifetime_spend = customer_stats.lifetime_spend + CASE
+				WHEN COALESCE(customer_stats.currency, EXCLUDED.currency) = EXCLUDED.currency THEN EXCLUDED.lifetime_spend
+				ELSE 0
+			END,
+			currency = COALESCE(customer_stats.currency, EXCLUDED.currency),
+			first_purchase_at = LEAST(customer_stats.first_purchase_at, EXCLUDED.first_purchase_at),
+			last_purchase_at = GREATEST(customer_stats.last_purchase_at, EXCLUDED.last_purchase_at),
+			favourite_store_id = EXCLUDED.favourite_store_id,
+			updated_at = EXCLUDED.updated_at
+	`
+	_, err = tx.ExecContext(ctx, query, o.CustomerID, o.MerchantID, o.TotalAmount-o.RefundedAmount, o.Currency, o.OrderedAt, time.Now())
+	return err
+}
+
+// refreshCustomerStats recomputes the customer's statistics, including their
+// per-store counts, from all their orders. Events normally apply deltas; this
+// handles the changes a delta cannot express and repairs statistics that
+// have drifted. The customer row must already be locked.
+func refreshCustomerStats(ctx context.Context, tx *sqlx.Tx, merchantID, customerID uuid.UUID) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM customer_store_stats WHERE customer_id = $1`, customerID); err != nil {
+		return err
+	}
+	storeQuery := `
+		INSERT INTO customer_store_stats (customer_id, store_id, order_count, last_ordered_at)
+		SELECT customer_id, store_id, COUNT(*), MAX(ordered_at)
+		FROM customer_orders
+		WHERE customer_id = $1 AND store_id IS NOT NULL AND NOT cancelled AND NOT pending
+		GROUP BY customer_id, store_id
+	`
+	if _, err := tx.ExecContext(ctx, storeQuery, customerID); err != nil {
+		return err
+	}
+
+	query := `
+		WITH live AS (
+			SELECT * FROM customer_orders WHERE customer_id = $2 AND NOT cancelled AND NOT pending
+		),
+		first_currency AS (
+			SELECT currency FROM live ORDER BY ordered_at LIMIT 1
+		),
+		favourite AS (
+			SELECT store_id FROM live
+			WHERE store_id IS NOT NULL
+			GROUP BY store_id
+			ORDER BY COUNT(*) DESC, MAX(ordered_at) DESC
+			LIMIT 1
+		)
+		INSERT INTO customer_stats (customer_id, merchant_id, order_count, lifetime_spend, currency, first_purchase_at, last_purchase_at, favourite_store_id, updated_at)
+		SELECT
+			$2, $1,
+			COUNT(*),
+			COALESCE(SUM(total_amount - refunded_amount) FILTER (WHERE currency = (SELECT currency FROM first_currency)), 0),
+			(SELECT currency FROM first_currency),
+			MIN(ordered_at),
+			MAX(ordered_at),
+			(SELECT store_id FROM favourite),
+			$3
+		FROM live
+		ON CONFLICT (customer_id) DO UPDATE SET
+			order_count = EXCLUDED.order_count,
+			lifetime_spend = EXCLUDED.lifetime_spend,
+			currency = EXCLUDED.currency,
+			first_purchase_at = EXCLUDED.first_purchase_at,
+			last_purchase_at = EXCLUDED.last_purchase_at,
+			favourite_store_id = EXCLUDED.favourite_store_id,
+			updated_at = EXCLUDED.updated_at
+	`
+	_, err := tx.ExecContext(ctx, query, merchantID, customerID, time.Now())
+	return err
+}
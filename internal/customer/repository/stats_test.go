@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// TestCustomerStatsDeltas applies order events one at a time and checks,
+// after each, that the statistics kept by deltas match a full recompute.
+func TestCustomerStatsDeltas(t *testing.T) {
+	db := testDB(t)
+	repo := NewPGRepository(db)
+	ctx := context.Background()
+	merchant := uuid.New()
+	c := createTestCustomer(t, repo, merchant, "Ann Tan", "0812 3456 7890", "+6281234567890", "", "")
+
+	event := func() *model.ProcessedEvent {
+		return &model.ProcessedEvent{EventID: uuid.NewString(), EventType: "test", ProcessedAt: time.Now()}
+	}
+	now := time.Now().Truncate(time.Microsecond)
+	record := func(orderID, storeID string, amount model.Money, orderedAt time.Time) {
+		t.Helper()
+		found, err := repo.RecordCustomerOrder(ctx, event(), &model.CustomerOrder{
+			MerchantID:  merchant,
+			OrderID:     orderID,
+			CustomerID:  c.ID,
+			StoreID:     &storeID,
+			TotalAmount: amount.Amount,
+			Currency:    amount.Currency,
+			OrderedAt:   orderedAt,
+		})
+		if err != nil || !found {
+			t.Fatalf("record %s: %v, %v", orderID, found, err)
+		}
+	}
+	check := func(step string, wantCount int32, wantSpend int64, wantCurrency, wantStore string) {
+		t.Helper()
+		got, err := repo.GetCustomerStats(ctx, merchant, c.ID)
+		if err != nil || got == nil {
+			t.Fatalf("%s: get stats: %v, %v", step, got, err)
+		}
+		if got.OrderCount != wantCount || got.LifetimeSpend != wantSpend ||
+			got.Currency == nil || *got.Currency != wantCurrency ||
+			got.FavouriteStoreID == nil || *got.FavouriteStoreID != wantStore {
+			t.Errorf("%s: got %d orders, %d %v spend, favourite %v; want %d, %d %s, %s",
+				step, got.OrderCount, got.LifetimeSpend, got.Currency, got.FavouriteStoreID, wantCount, wantSpend, wantCurrency, wantStore)
+		}
+		if want := recomputedStats(t, db, merchant, c.ID); !sameStats(got, want) {
+			t.Errorf("%s: deltas gave %+v, recompute gives %+v", step, got, want)
+		}
+	}
+
+	record("order-1", "store-a", model.Money{Amount: 10000, Currency: "IDR"}, now.Add(-72*time.Hour))
+	check("first order", 1, 10000, "IDR", "store-a")
+
+	record("order-2", "store-b", model.Money{Amount: 5000, Currency: "IDR"}, now.Add(-48*time.Hour))
+	record("order-3", "store-b", model.Money{Amount: 3000, Currency: "IDR"}, now.Add(-24*time.Hour))
+	check("repeat store", 3, 18000, "IDR", "store-b")
+
+	// Orders in another currency count, but their spend does not.
+	record("order-4", "store-a", model.Money{Amount: 1000, Currency: "USD"}, now)
+	check("later order in another currency", 4, 18000, "IDR", "store-a")
+
+	if _, err := repo.RecordCustomerOrderRefund(ctx, event(), merchant, c.ID, "order-2", &model.Money{Amount: 2000, Currency: "IDR"}); err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	check("partial refund", 4, 16000, "IDR", "store-a")
+
+	if _, err := repo.CancelCustomerOrder(ctx, event(), merchant, c.ID, "order-4"); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	check("cancellation", 3, 16000, "IDR", "store-b")
+
+	// An earlier order in another currency becomes the first order, so
+	// spend switches to its currency.
+	record("order-0", "store-a", model.Money{Amount: 500, Currency: "USD"}, now.Add(-96*time.Hour))
+	check("earlier order in another currency", 4, 500, "USD", "store-b")
+
+	// Recording an order again under a new event changes nothing.
+	record("order-3", "store-b", model.Money{Amount: 3000, Currency: "IDR"}, now.Add(-24*time.Hour))
+	check("redelivered order", 4, 500, "USD", "store-b")
+}
+
+// TestRefundBeforeOrder refunds an order before it is recorded, and checks
+// the order is then counted net of the refund rather than at full value.
+func TestRefundBeforeOrder(t *testing.T) {
+	db := testDB(t)
+	repo := NewPGRepository(db)
+	ctx := context.Background()
+	merchant := uuid.New()
+	c := createTestCustomer(t, repo, merchant, "Ann Tan", "0812 3456 7890", "+6281234567890", "", "")
+
+	event := func() *model.ProcessedEvent {
+		return &model.ProcessedEvent{EventID: uuid.NewString(), EventType: "test", ProcessedAt: time.Now()}
+	}
+	for _, amount := range []int64{2000, 1000} {
+		order, err := repo.RecordCustomerOrderRefund(ctx, event(), merchant, c.ID, "order-1", &model.Money{Amount: amount, Currency: "IDR"})
+		if err != nil || order == nil || !order.Pending {
+			t.Fatalf("refund %d: got %+v, %v, want a pending order", amount, order, err)
+		}
+	}
+	if s, err := repo.GetCustomerStats(ctx, merchant, c.ID); err != nil || s != nil {
+		t.Fatalf("stats from a refund alone: %+v, %v", s, err)
+	}
+
+	found, err := repo.RecordCustomerOrder(ctx, event(), &model.CustomerOrder{
+		MerchantID:  merchant,
+		OrderID:     "order-1",
+		CustomerID:  c.ID,
+		TotalAmount: 10000,
+		Currency:    "IDR",
+		OrderedAt:   time.Now(),
+	})
+	if err != nil || !found {
+		t.Fatalf("record order: %v, %v", found, err)
+	}
+	got, err := repo.GetCustomerStats(ctx, merchant, c.ID)
+	if err != nil || got == nil {
+		t.Fatalf("get stats: %v, %v", got, err)
+	}
+	if got.OrderCount != 1 || got.LifetimeSpend != 7000 {
+		t.Errorf("got %d orders and %d spend, want 1 and 7000", got.OrderCount, got.LifetimeSpend)
+	}
+	if want := recomputedStats(t, db, merchant, c.ID); !sameStats(got, want) {
+		t.Errorf("deltas gave %+v, recompute gives %+v", got, want)
+	}
+
+	// A full refund of an order not seen yet leaves nothing to count.
+	if _, err := repo.RecordCustomerOrderRefund(ctx, event(), merchant, c.ID, "order-2", nil); err != nil {
+		t.Fatalf("full refund: %v", err)
+	}
+	if _, err := repo.RecordCustomerOrder(ctx, event(), &model.CustomerOrder{
+		MerchantID:  merchant,
+		OrderID:     "order-2",
+		CustomerID:  c.ID,
+		TotalAmount: 5000,
+		Currency:    "IDR",
+		OrderedAt:   time.Now(),
+	}); err != nil {
+		t.Fatalf("record fully refunded order: %v", err)
+	}
+	if got, err = repo.GetCustomerStats(ctx, merchant, c.ID); err != nil || got == nil {
+		t.Fatalf("get stats: %v, %v", got, err)
+	}
+	if got.OrderCount != 2 || got.LifetimeSpend != 7000 {
+		t.Errorf("got %d orders and %d spend, want 2 and 7000", got.OrderCount, got.LifetimeSpend)
+	}
+}
+
+// recomputedStats returns the customer's statistics as a full recompute
+// would leave them. The recompute is rolled back.
+func recomputedStats(t *testing.T, db *sqlx.DB, merchantID, customerID uuid.UUID) *model.CustomerStats {
+	t.Helper()
+	ctx := context.Background()
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer tx.Rollback()
+	if err := refreshCustomerStats(ctx, tx, merchantID, customerID); err != nil {
+		t.Fatalf("recompute: %v", err)
+	}
+	var s model.CustomerStats
+	if err := tx.GetContext(ctx, &s, `SELECT * FROM customer_stats WHERE customer_id = $1`, customerID); err != nil {
+		t.Fatalf("read recomputed stats: %v", err)
+	}
+	return &s
+}
+
+// sameStats compares statistics, ignoring when they were updated.
+func sameStats(a, b *model.CustomerStats) bool {
+	equalString := func(x, y *string) bool { return (x == nil) == (y == nil) && (x == nil || *x == *y) }
+	equalTime := func(x, y *time.Time) bool { return (x == nil) == (y == nil) && (x == nil || x.Equal(*y)) }
+	return a.OrderCount == b.OrderCount && a.LifetimeSpend == b.LifetimeSpend &&
+		a.AverageOrderValue == b.AverageOrderValue && equalString(a.Currency, b.Currency) &&
+		equalTime(a.FirstPurchaseAt, b.FirstPurchaseAt) && equalTime(a.LastPurchaseAt, b.LastPurchaseAt) &&
+		equalString(a.FavouriteStoreID, b.FavouriteStoreID)
+}
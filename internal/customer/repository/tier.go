@@ -0,0 +1,320 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+func (r *pgRepository) ListLoyaltyTiers(ctx context.Context, merchantID uuid.UUID) ([]*model.LoyaltyTier, error) {
+	tiers := []*model.LoyaltyTier{}
+	query := `SELECT * FROM loyalty_tiers WHERE merchant_id = $1 ORDER BY threshold ASC`
+	if err := r.db.SelectContext(ctx, &tiers, query, merchantID); err != nil {
+		return nil, err
+	}
+	return tiers, nil
+}
+
+func (r *pgRepository) GetCustomerTier(ctx context.Context, merchantID, customerID uuid.UUID) (*model.LoyaltyTier, error) {
+	var t model.LoyaltyTier
+	query := `
+		SELECT t.* FROM loyalty_tiers t
+		JOIN customers c ON c.tier_id = t.id
+		WHERE c.merchant_id = $1 AND c.id = $2
+	`
+	if err := r.db.GetContext(ctx, &t, query, merchantID, customerID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *pgRepository) CreateLoyaltyTier(ctx context.Context, t *model.LoyaltyTier) error {
+	t.CreatedAt = time.Now()
+	t.UpdatedAt = t.CreatedAt
+	query := `
+		INSERT INTO loyalty_tiers (id, merchant_id, name, threshold, earn_multiplier, created_at, updated_at)
+		VALUES (:id, :merchant_id, :name, :threshold, :earn_multiplier, :created_at, :updated_at)
+	`
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.NamedExecContext(ctx, query, t); err != nil {
+			return err
+		}
+		return invalidateTiers(ctx, tx, t.MerchantID)
+	})
+	return mapTierWriteError(err)
+}
+
+func (r *pgRepository) UpdateLoyaltyTier(ctx context.Context, t *model.LoyaltyTier) (bool, error) {
+	t.UpdatedAt = time.Now()
+	query := `
+		UPDATE loyalty_tiers
+		SET name = :name, threshold = :threshold, earn_multiplier = :earn_multiplier, updated_at = :updated_at
+		WHERE id = :id AND merchant_id = :merchant_id
+	`
+	var updated bool
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.NamedExecContext(ctx, query, t)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil || affected == 0 {
+			return err
+		}
+		updated = true
+		return invalidateTiers(ctx, tx, t.MerchantID)
+	})
+	if err != nil {
+		return false, mapTierWriteError(err)
+	}
+	return updated, nil
+}
+
+// DeleteLoyaltyTier deletes the tier and moves its members straight to the
+// tier they now qualify for, recording the change like any other.
+func (r *pgRepository) DeleteLoyaltyTier(ctx context.Context, merchantID, id uuid.UUID) (bool, error) {
+	var deleted bool
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		var members []uuid.UUID
+		membersQuery := `
+			SELECT id FROM customers
+			WHERE merchant_id = $1 AND tier_id = $2
+			ORDER BY id
+			FOR UPDATE
+		`
+		if err := tx.SelectContext(ctx, &members, membersQuery, merchantID, id); err != nil {
+			return err
+		}
+
+		// The foreign key clears the members' tier_id.
+		res, err := tx.ExecContext(ctx, `DELETE FROM loyalty_tiers WHERE merchant_id = $1 AND id = $2`, merchantID, id)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil || affected == 0 {
+			return err
+		}
+		deleted = true
+
+		program, err := loadLoyaltyProgram(ctx, tx, merchantID)
+		if err != nil {
+			return err
+		}
+		for _, customerID := range members {
+			target, metric, err := qualifyingTier(ctx, tx, program, customerID)
+			if err != nil {
+				return err
+			}
+			if _, err := moveTier(ctx, tx, merchantID, customerID, &id, target, metric); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+func (r *pgRepository) ListTierHistory(ctx context.Context, merchantID, customerID uuid.UUID) ([]*model.CustomerTierChange, error) {
+	changes := []*model.CustomerTierChange{}
+	query := `
+		SELECT * FROM customer_tier_history
+		WHERE merchant_id = $1 AND customer_id = $2
+		ORDER BY created_at DESC
+	`
+	if err := r.db.SelectContext(ctx, &changes, query, merchantID, customerID); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (r *pgRepository) ListStaleTierCustomers(ctx context.Context, evaluatedBefore time.Time, limit int) ([]*model.Customer, error) {
+	customers := []*model.Customer{}
+	query := `
+		SELECT c.* FROM customers c
+		LEFT JOIN loyalty_programs p ON p.merchant_id = c.merchant_id
+		WHERE c.deleted_at IS NULL
+			AND (c.tier_evaluated_at IS NULL
+				OR (p.tier_basis = 'rolling_spend' AND c.tier_evaluated_at < $1))
+		ORDER BY c.tier_evaluated_at NULLS FIRST, c.id
+		LIMIT $2
+	`
+	if err := r.db.SelectContext(ctx, &customers, query, evaluatedBefore, limit); err != nil {
+		return nil, err
+	}
+	return customers, nil
+}
+
+func (r *pgRepository) ReevaluateCustomerTier(ctx context.Context, merchantID, customerID uuid.UUID) (*model.CustomerTierChange, error) {
+	var change *model.CustomerTierChange
+	err := r.withTx(ctx, func(tx *sqlx.Tx) error {
+		found, err := lockCustomer(ctx, tx, merchantID, customerID)
+		if err != nil || !found {
+			return err
+		}
+		program, err := loadLoyaltyProgram(ctx, tx, merchantID)
+		if err != nil {
+			return err
+		}
+		change, err = reevaluateTier(ctx, tx, program, customerID)
+		if err != nil || change == nil {
+			return err
+		}
+		return refreshCustomerSegments(ctx, tx, merchantID, customerID)
+	})
+	return change, err
+}
+
+// reevaluateSpendTier reevaluates the customer's tier after their orders
+// changed, if the merchant's tiers are based on spend. The customer row must
+// already be locked.
+func reevaluateSpendTier(ctx context.Context, tx *sqlx.Tx, merchantID, customerID uuid.UUID) error {
+	program, err := loadLoyaltyProgram(ctx, tx, merchantID)
+	if err != nil {
+		return err
+	}
+	if program.TierBasis != model.TierBasisRollingSpend {
+		return nil
+	}
+	_, err = reevaluateTier(ctx, tx, program, customerID)
+	return err
+}
+
+// invalidateTiers marks every customer of the merchant for re-evaluation by
+// the tier refresher, after the merchant's tiers or tier basis changed.
+func invalidateTiers(ctx context.Context, tx *sqlx.Tx, merchantID uuid.UUID) error {
+	query := `
+		UPDATE customers SET tier_evaluated_at = NULL
+		WHERE merchant_id = $1 AND deleted_at IS NULL AND tier_evaluated_at IS NOT NULL
+	`
+	_, err := tx.ExecContext(ctx, query, merchantID)
+	return err
+}
+
+// reevaluateTier moves the customer to the tier matching their current
+// metric. It returns nil if the tier is unchanged. The customer row must
+// already be locked.
+//
+// Rolling-spend metrics also change as orders are recorded, refunded or
+// cancelled, which reevaluateSpendTier handles, and as old orders leave the
+// window, which the tier refresher catches up on.
+func reevaluateTier(ctx context.Context, tx *sqlx.Tx, program *model.LoyaltyProgram, customerID uuid.UUID) (*model.CustomerTierChange, error) {
+	target, metric, err := qualifyingTier(ctx, tx, program, customerID)
+	if err != nil {
+		return nil, err
+	}
+	var current *uuid.UUID
+	if err := tx.GetContext(ctx, &current, `SELECT tier_id FROM customers WHERE id = $1`, customerID); err != nil {
+		return nil, err
+	}
+	return moveTier(ctx, tx, program.MerchantID, customerID, current, target, metric)
+}
+
+// qualifyingTier returns the highest tier the customer's metric reaches, or
+// nil if none, along with the metric.
+func qualifyingTier(ctx context.Context, tx *sqlx.Tx, program *model.LoyaltyProgram, customerID uuid.UUID) (*uuid.UUID, string, error) {
+	// metric is compared to thresholds as an exact decimal: points, or spend
+	// in major units of the program currency.
+	var metric string
+	var err error
+	switch program.TierBasis {
+	case model.TierBasisRollingSpend:
+		since := time.Now().AddDate(0, 0, -int(program.TierWindowDays))
+		var spend int64
+		// Spend comes from the customer's orders rather than their points,
+		// so orders that earn nothing still count.
+		query := `
+			SELECT COALESCE(SUM(total_amount - refunded_amount), 0) FROM customer_orders
+			WHERE merchant_id = $1 AND customer_id = $2 AND NOT cancelled AND NOT pending
+				AND currency = $3 AND ordered_at > $4
+		`
+		err = tx.GetContext(ctx, &spend, query, program.MerchantID, customerID, program.Currency, since)
+		metric = model.Money{Amount: spend, Currency: program.Currency}.Decimal()
+	default:
+		var points int64
+		query := `SELECT COALESCE(SUM(delta), 0) FROM loyalty_transactions WHERE customer_id = $1 AND type IN ('earn', 'reverse')`
+		err = tx.GetContext(ctx, &points, query, customerID)
+		metric = strconv.FormatInt(points, 10)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	tierQuery := `
+		SELECT id FROM loyalty_tiers
+		WHERE merchant_id = $1 AND threshold <= $2::numeric
+		ORDER BY threshold DESC
+		LIMIT 1
+	`
+	var tierID uuid.UUID
+	err = tx.GetContext(ctx, &tierID, tierQuery, program.MerchantID, metric)
+	switch {
+	case err == nil:
+		return &tierID, metric, nil
+	case err == sql.ErrNoRows:
+		return nil, metric, nil
+	default:
+		return nil, "", err
+	}
+}
+
+// moveTier puts the customer in tier to, marks their tier as evaluated and,
+// if it differs from from, records the change in customer_tier_history and
+// queues a TierChanged event. It returns nil if the tier is unchanged.
+func moveTier(ctx context.Context, tx *sqlx.Tx, merchantID, customerID uuid.UUID, from, to *uuid.UUID, metric string) (*model.CustomerTierChange, error) {
+	now := time.Now()
+	if _, err := tx.ExecContext(ctx, `UPDATE customers SET tier_id = $1, tier_evaluated_at = $2 WHERE id = $3`, to, now, customerID); err != nil {
+		return nil, err
+	}
+	if sameTier(from, to) {
+		return nil, nil
+	}
+
+	metricValue, err := strconv.ParseFloat(metric, 64)
+	if err != nil {
+		return nil, err
+	}
+	change := &model.CustomerTierChange{
+		ID:         uuid.New(),
+		MerchantID: merchantID,
+		CustomerID: customerID,
+		FromTierID: from,
+		ToTierID:   to,
+		Metric:     metricValue,
+		CreatedAt:  now,
+	}
+	historyQuery := `
+		INSERT INTO customer_tier_history (id, merchant_id, customer_id, from_tier_id, to_tier_id, metric, created_at)
+		VALUES (:id, :merchant_id, :customer_id, :from_tier_id, :to_tier_id, :metric, :created_at)
+	`
+	if _, err := tx.NamedExecContext(ctx, historyQuery, change); err != nil {
+		return nil, err
+	}
+	if err := insertOutboxEvent(ctx, tx, merchantID, customerID, model.EventTierChanged, model.NewTierChangedEvent(change)); err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+func sameTier(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func mapTierWriteError(err error) error {
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%w: %v", ErrDuplicateTierName, err)
+	}
+	return err
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/google/uuid"
+)
+
+// TestRollingSpendCountsOrdersWithoutPoints checks that rolling-spend tiers
+// are reached by order spend in the program currency, including orders below
+// the program's minimum that earn no points.
+func TestRollingSpendCountsOrdersWithoutPoints(t *testing.T) {
+	repo := NewPGRepository(testDB(t))
+	ctx := context.Background()
+	merchant := uuid.New()
+
+	program := model.DefaultLoyaltyProgram(merchant)
+	program.TierBasis = model.TierBasisRollingSpend
+	program.MinOrderAmount = 10_000_000 // IDR 100,000.00
+	if err := repo.UpsertLoyaltyProgram(ctx, program); err != nil {
+		t.Fatalf("upsert program: %v", err)
+	}
+	silver := &model.LoyaltyTier{ID: uuid.New(), MerchantID: merchant, Name: "Silver", Threshold: 40000, EarnMultiplier: 1}
+	if err := repo.CreateLoyaltyTier(ctx, silver); err != nil {
+		t.Fatalf("create tier: %v", err)
+	}
+	c := createTestCustomer(t, repo, merchant, "Ann Tan", "0812 3456 7890", "+6281234567890", "", "")
+
+	record := func(orderID string, amount model.Money) {
+		t.Helper()
+		event := &model.ProcessedEvent{EventID: uuid.NewString(), EventType: "OrderCreated", ProcessedAt: time.Now()}
+		found, err := repo.RecordCustomerOrder(ctx, event, &model.CustomerOrder{
+			MerchantID:  merchant,
+			OrderID:     orderID,
+			CustomerID:  c.ID,
+			TotalAmount: amount.Amount,
+			Currency:    amount.Currency,
+			OrderedAt:   time.Now(),
+		})
+		if err != nil || !found {
+			t.Fatalf("record %s: %v, %v", orderID, found, err)
+		}
+	}
+	tierName := func() string {
+		t.Helper()
+		tier, err := repo.GetCustomerTier(ctx, merchant, c.ID)
+		if err != nil {
+			t.Fatalf("get tier: %v", err)
+		}
+		if tier == nil {
+			return ""
+		}
+		return tier.Name
+	}
+
+	// Spend in another currency does not count towards the program's tiers.
+	record("order-usd", model.Money{Amount: 100_000_00, Currency: "USD"})
+	if got := tierName(); got != "" {
+		t.Fatalf("tier %q after a USD order, want none", got)
+	}
+
+	// IDR 50,000.00 is below the minimum order, so it earns no points, but
+	// it is still spend.
+	record("order-idr", model.Money{Amount: 5_000_000, Currency: "IDR"})
+	if got := tierName(); got != "Silver" {
+		t.Errorf("tier %q after IDR 50,000 of spend, want Silver", got)
+	}
+}
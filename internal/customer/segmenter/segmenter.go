@@ -0,0 +1,70 @@
+package segmenter
+
+import (
+	"context"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/customer/usecase"
+	"github.com/fekuna/omnipos-pkg/logger"
+	"go.uber.org/zap"
+)
+
+// SegmentRefresher periodically re-evaluates customer segments in full, so
+// rules that change with the passage of time, such as days since the last
+// purchase, stay accurate for customers with no new activity.
+type SegmentRefresher struct {
+	uc        usecase.UseCase
+	logger    logger.ZapLogger
+	maxAge    time.Duration
+	interval  time.Duration
+	batchSize int
+}
+
+func NewSegmentRefresher(uc usecase.UseCase, logger logger.ZapLogger, maxAge, interval time.Duration, batchSize int) *SegmentRefresher {
+	return &SegmentRefresher{
+		uc:        uc,
+		logger:    logger,
+		maxAge:    maxAge,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+func (r *SegmentRefresher) Start(ctx context.Context) {
+	r.logger.Info("Starting Segment Refresher", zap.Duration("max_age", r.maxAge), zap.Duration("interval", r.interval))
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			r.logger.Info("Stopping Segment Refresher")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh drains stale segments batch by batch until none are left.
+func (r *SegmentRefresher) refresh(ctx context.Context) {
+	total := 0
+	for ctx.Err() == nil {
+		refreshed, err := r.uc.RefreshStaleSegments(ctx, r.maxAge, r.batchSize)
+		total += refreshed
+		if err != nil {
+			if ctx.Err() == nil {
+				r.logger.Error("Failed to refresh customer segments", zap.Error(err))
+			}
+			break
+		}
+		if refreshed < r.batchSize {
+			break
+		}
+	}
+	if total > 0 {
+		r.logger.Info("Refreshed customer segments", zap.Int("count", total))
+	}
+}
@@ -0,0 +1,73 @@
+package tierer
+
+import (
+	"context"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/customer/usecase"
+	"github.com/fekuna/omnipos-pkg/logger"
+	"go.uber.org/zap"
+)
+
+// TierRefresher periodically re-evaluates loyalty tiers that ledger entries
+// do not keep current: every customer of a merchant after its tiers or
+// program change, and customers on rolling-spend tiers whose spend is
+// leaving the window, so lapsed customers are demoted.
+type TierRefresher struct {
+	uc        usecase.UseCase
+	logger    logger.ZapLogger
+	maxAge    time.Duration
+	interval  time.Duration
+	batchSize int
+}
+
+func NewTierRefresher(uc usecase.UseCase, logger logger.ZapLogger, maxAge, interval time.Duration, batchSize int) *TierRefresher {
+	return &TierRefresher{
+		uc:        uc,
+		logger:    logger,
+		maxAge:    maxAge,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+func (r *TierRefresher) Start(ctx context.Context) {
+	r.logger.Info("Starting Tier Refresher", zap.Duration("max_age", r.maxAge), zap.Duration("interval", r.interval))
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			r.logger.Info("Stopping Tier Refresher")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh drains stale tiers batch by batch. It stops at the first batch
+// that is not fully evaluated, so customers that keep failing wait for the
+// next tick instead of being retried in a loop.
+func (r *TierRefresher) refresh(ctx context.Context) {
+	total := 0
+	for ctx.Err() == nil {
+		evaluated, err := r.uc.RefreshStaleTiers(ctx, r.maxAge, r.batchSize)
+		total += evaluated
+		if err != nil {
+			if ctx.Err() == nil {
+				r.logger.Error("Failed to refresh loyalty tiers", zap.Error(err))
+			}
+			break
+		}
+		if evaluated < r.batchSize {
+			break
+		}
+	}
+	if total > 0 {
+		r.logger.Info("Re-evaluated loyalty tiers", zap.Int("count", total))
+	}
+}
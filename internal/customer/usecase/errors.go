@@ -0,0 +1,90 @@
+package usecase
+
+import (
+	"errors"
+
+	"github.com/fekuna/omnipos-customer-service/internal/apperror"
+	"github.com/fekuna/omnipos-customer-service/internal/customer/repository"
+	"github.com/google/uuid"
+)
+
+// ErrEventAlreadyProcessed is returned when an inbound event was applied
+// before and has been skipped.
+var ErrEventAlreadyProcessed = errors.New("event already processed")
+
+func errCustomerNotFound() error {
+	return apperror.NotFound("customer not found")
+}
+
+// parseID parses a UUID request field, reporting the field on failure.
+func parseID(field, value string) (uuid.UUID, error) {
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, apperror.InvalidArgument("invalid "+field, apperror.FieldViolation{
+			Field:       field,
+			Description: "must be a valid UUID",
+		})
+	}
+	return id, nil
+}
+
+// mapRepoError converts known repository errors into domain errors.
+func mapRepoError(err error) error {
+	if errors.Is(err, repository.ErrEventAlreadyProcessed) {
+		return ErrEventAlreadyProcessed
+	}
+	if errors.Is(err, repository.ErrInsufficientPoints) {
+		return apperror.FailedPrecondition("insufficient loyalty points", apperror.FieldViolation{
+			Field:       "points",
+			Description: "exceeds the customer's available balance",
+		}).Wrap(err)
+	}
+	if errors.Is(err, repository.ErrHoldNotActive) {
+		return apperror.FailedPrecondition("loyalty hold is not active", apperror.FieldViolation{
+			Field:       "hold_id",
+			Description: "hold was already confirmed, cancelled, or has expired",
+		}).Wrap(err)
+	}
+	if errors.Is(err, repository.ErrDuplicateTierName) {
+		return apperror.AlreadyExists("loyalty tier with this name already exists", apperror.FieldViolation{
+			Field:       "name",
+			Description: "another tier of this merchant already uses this name",
+		}).Wrap(err)
+	}
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return apperror.InvalidArgument("invalid page token", apperror.FieldViolation{
+			Field:       "page_token",
+			Description: "must be a next_page_token returned for the same sort",
+		}).Wrap(err)
+	}
+	if errors.Is(err, repository.ErrDuplicateSegmentName) {
+		return apperror.AlreadyExists("customer segment with this name already exists", apperror.FieldViolation{
+			Field:       "name",
+			Description: "another segment of this merchant already uses this name",
+		}).Wrap(err)
+	}
+	if errors.Is(err, repository.ErrCurrencyMismatch) {
+		return apperror.InvalidArgument("refund currency does not match order", apperror.FieldViolation{
+			Field:       "refund_amount",
+			Description: "must be in the currency the order was paid in",
+		}).Wrap(err)
+	}
+	if errors.Is(err, repository.ErrDuplicatePhone) {
+		return apperror.AlreadyExists("customer with this phone already exists", apperror.FieldViolation{
+			Field:       "phone",
+			Description: "another customer of this merchant already uses this phone",
+		}).Wrap(err)
+	}
+	return err
+}
+
+// requirePositive rejects non-positive point amounts.
+func requirePositive(field string, points int32) error {
+	if points <= 0 {
+		return apperror.InvalidArgument("invalid "+field, apperror.FieldViolation{
+			Field:       field,
+			Description: "must be greater than zero",
+		})
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"go.uber.org/zap"
+)
+
+// defaultExpiryLookahead is used when the caller does not say how far ahead
+// to look for expiring points.
+const defaultExpiryLookahead = 30 * 24 * time.Hour
+
+// ExpireDuePoints expires every due point lot, each in its own transaction,
+// reading batchSize lots at a time, and returns how many were expired. Lots
+// that fail are logged and passed over until the next run, so one bad lot
+// cannot hold up the rest.
+func (uc *customerUseCase) ExpireDuePoints(ctx context.Context, batchSize int) (int, error) {
+	now := time.Now()
+	expired := 0
+	var after *model.LoyaltyPointLot
+	for {
+		lots, err := uc.repo.ListDueLots(ctx, now, after, batchSize)
+		if err != nil {
+			uc.logger.Error("Failed to list due point lots", zap.Error(err))
+			return expired, err
+		}
+
+		for _, lot := range lots {
+			if ctx.Err() != nil {
+				return expired, ctx.Err()
+			}
+			t, err := uc.repo.ExpireLot(ctx, lot.ID, now)
+			if err != nil {
+				uc.logger.Error("Failed to expire point lot", zap.String("lot_id", lot.ID.String()), zap.Error(err))
+				continue
+			}
+			if t != nil {
+				expired++
+			}
+		}
+		if len(lots) < batchSize {
+			return expired, nil
+		}
+		after = lots[len(lots)-1]
+	}
+}
+
+// ListUpcomingExpirations returns the customer's points that expire within
+// the given window, grouped by expiry time.
+func (uc *customerUseCase) ListUpcomingExpirations(ctx context.Context, merchantID, customerID string, within time.Duration) ([]*model.PointExpiration, error) {
+	mid, err := parseID("merchant_id", merchantID)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := parseID("customer_id", customerID)
+	if err != nil {
+		return nil, err
+	}
+	if within <= 0 {
+		within = defaultExpiryLookahead
+	}
+
+	customer, err := uc.repo.GetByID(ctx, mid, uid)
+	if err != nil {
+		return nil, err
+	}
+	if customer == nil {
+		return nil, errCustomerNotFound()
+	}
+
+	expirations, err := uc.repo.ListUpcomingExpirations(ctx, mid, uid, time.Now().Add(within))
+	if err != nil {
+		uc.logger.Error("Failed to list upcoming expirations", zap.Error(err))
+		return nil, err
+	}
+	return expirations, nil
+}
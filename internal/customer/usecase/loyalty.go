@@ -0,0 +1,312 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/apperror"
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"go.uber.org/zap"
+)
+
+// systemActor is recorded on ledger entries written by background processing.
+const systemActor = "system"
+
+// holdTTL bounds how long a checkout may keep points reserved before the
+// hold lapses and the points become available again.
+const holdTTL = 15 * time.Minute
+
+// AddLoyaltyPoints records a manual adjustment on behalf of actor.
+func (uc *customerUseCase) AddLoyaltyPoints(ctx context.Context, merchantID, customerID string, points int32, actor, reason string) (int32, error) {
+	mid, err := parseID("merchant_id", merchantID)
+	if err != nil {
+		return 0, err
+	}
+	uid, err := parseID("customer_id", customerID)
+	if err != nil {
+		return 0, err
+	}
+	if points == 0 {
+		return 0, apperror.InvalidArgument("invalid points", apperror.FieldViolation{
+			Field:       "points",
+			Description: "must not be zero",
+		})
+	}
+
+	t, err := uc.recordLoyaltyTransaction(ctx, &model.LoyaltyTransaction{
+		MerchantID: mid,
+		CustomerID: uid,
+		Type:       model.LoyaltyTransactionAdjust,
+		Delta:      points,
+		Actor:      actor,
+		Reason:     reason,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return t.BalanceAfter, nil
+}
+
+// EarnLoyaltyPoints credits the points an order earns under the merchant's
+// loyalty program. The award is applied at most once per eventID; a
+// redelivery returns ErrEventAlreadyProcessed. It returns nil if the order
+// earns no points.
+func (uc *customerUseCase) EarnLoyaltyPoints(ctx context.Context, eventID, merchantID, customerID, orderID string, amount model.Money) (*model.LoyaltyTransaction, error) {
+	mid, err := parseID("merchant_id", merchantID)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := parseID("customer_id", customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	program, err := uc.earningProgram(ctx, mid, amount.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if program.Currency != amount.Currency {
+		uc.logger.Warn("Order currency differs from loyalty program currency, no points earned",
+			zap.String("event_id", eventID),
+			zap.String("order_currency", amount.Currency),
+			zap.String("program_currency", program.Currency),
+		)
+		return nil, nil
+	}
+	multiplier, err := uc.earnMultiplier(ctx, mid, uid)
+	if err != nil {
+		return nil, err
+	}
+	points := program.PointsFor(amount, multiplier)
+	if points <= 0 {
+		return nil, nil
+	}
+
+	event := &model.ProcessedEvent{
+		EventID:   eventID,
+		EventType: "OrderCreated",
+	}
+	t, err := uc.repo.RecordEventLoyaltyTransaction(ctx, event, &model.LoyaltyTransaction{
+		MerchantID:    mid,
+		CustomerID:    uid,
+		Type:          model.LoyaltyTransactionEarn,
+		SourceOrderID: &orderID,
+		OrderAmount:   &amount.Amount,
+		OrderCurrency: &amount.Currency,
+		Delta:         points,
+		Actor:         systemActor,
+	})
+	if err != nil {
+		err = mapRepoError(err)
+		if !errors.Is(err, ErrEventAlreadyProcessed) {
+			uc.logger.Error("Failed to record earned loyalty points", zap.String("event_id", eventID), zap.Error(err))
+		}
+		return nil, err
+	}
+	if t == nil {
+		return nil, errCustomerNotFound()
+	}
+	return t, nil
+}
+
+// ReverseOrderPoints claws back the points an order earned after it was
+// cancelled (refundAmount nil) or partially refunded. Points that were
+// already spent leave the customer with a negative balance, which later
+// earnings pay off first. Like EarnLoyaltyPoints it is idempotent per eventID
+// and returns nil when nothing is left to reverse.
+func (uc *customerUseCase) ReverseOrderPoints(ctx context.Context, eventID, eventType, merchantID, customerID, orderID string, refundAmount *model.Money) (*model.LoyaltyTransaction, error) {
+	mid, err := parseID("merchant_id", merchantID)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := parseID("customer_id", customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &model.ProcessedEvent{
+		EventID:   eventID,
+		EventType: eventType,
+	}
+	t, err := uc.repo.RecordEventOrderReversal(ctx, event, &model.LoyaltyTransaction{
+		MerchantID:    mid,
+		CustomerID:    uid,
+		Type:          model.LoyaltyTransactionReverse,
+		SourceOrderID: &orderID,
+		Actor:         systemActor,
+		Reason:        eventType,
+	}, refundAmount)
+	if err != nil {
+		err = mapRepoError(err)
+		if !errors.Is(err, ErrEventAlreadyProcessed) {
+			uc.logger.Error("Failed to reverse order loyalty points", zap.String("event_id", eventID), zap.Error(err))
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+func (uc *customerUseCase) ListLoyaltyTransactions(ctx context.Context, merchantID, customerID string, page, pageSize int) ([]*model.LoyaltyTransaction, int, error) {
+	mid, err := parseID("merchant_id", merchantID)
+	if err != nil {
+		return nil, 0, err
+	}
+	uid, err := parseID("customer_id", customerID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+
+	customer, err := uc.repo.GetByID(ctx, mid, uid)
+	if err != nil {
+		return nil, 0, err
+	}
+	if customer == nil {
+		return nil, 0, errCustomerNotFound()
+	}
+
+	transactions, total, err := uc.repo.ListLoyaltyTransactions(ctx, mid, uid, page, pageSize)
+	if err != nil {
+		uc.logger.Error("Failed to list loyalty transactions", zap.Error(err))
+		return nil, 0, err
+	}
+	return transactions, total, nil
+}
+
+// RedeemLoyaltyPoints debits points immediately, failing if they exceed the
+// available balance.
+func (uc *customerUseCase) RedeemLoyaltyPoints(ctx context.Context, merchantID, customerID string, points int32, orderID, actor, reason string) (int32, error) {
+	mid, err := parseID("merchant_id", merchantID)
+	if err != nil {
+		return 0, err
+	}
+	uid, err := parseID("customer_id", customerID)
+	if err != nil {
+		return 0, err
+	}
+	if err := requirePositive("points", points); err != nil {
+		return 0, err
+	}
+
+	t := &model.LoyaltyTransaction{
+		MerchantID: mid,
+		CustomerID: uid,
+		Type:       model.LoyaltyTransactionRedeem,
+		Delta:      -points,
+		Actor:      actor,
+		Reason:     reason,
+	}
+	if orderID != "" {
+		t.SourceOrderID = &orderID
+	}
+
+	recorded, err := uc.recordLoyaltyTransaction(ctx, t)
+	if err != nil {
+		return 0, err
+	}
+	return recorded.BalanceAfter, nil
+}
+
+// HoldLoyaltyPoints reserves points for a pending order. The hold must be
+// confirmed or cancelled before it expires.
+func (uc *customerUseCase) HoldLoyaltyPoints(ctx context.Context, merchantID, customerID string, points int32, orderID string) (*model.LoyaltyHold, error) {
+	mid, err := parseID("merchant_id", merchantID)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := parseID("customer_id", customerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requirePositive("points", points); err != nil {
+		return nil, err
+	}
+
+	h := &model.LoyaltyHold{
+		MerchantID: mid,
+		CustomerID: uid,
+		Points:     points,
+		ExpiresAt:  time.Now().Add(holdTTL),
+	}
+	if orderID != "" {
+		h.OrderID = &orderID
+	}
+
+	hold, err := uc.repo.CreateLoyaltyHold(ctx, h)
+	if err != nil {
+		uc.logger.Error("Failed to hold loyalty points", zap.String("customer_id", customerID), zap.Error(err))
+		return nil, mapRepoError(err)
+	}
+	if hold == nil {
+		return nil, errCustomerNotFound()
+	}
+	return hold, nil
+}
+
+// ConfirmLoyaltyHold turns a hold into a redeem entry and returns the new
+// balance.
+func (uc *customerUseCase) ConfirmLoyaltyHold(ctx context.Context, merchantID, holdID, actor string) (int32, error) {
+	mid, err := parseID("merchant_id", merchantID)
+	if err != nil {
+		return 0, err
+	}
+	hid, err := parseID("hold_id", holdID)
+	if err != nil {
+		return 0, err
+	}
+
+	t, err := uc.repo.ConfirmLoyaltyHold(ctx, mid, hid, actor)
+	if err != nil {
+		uc.logger.Error("Failed to confirm loyalty hold", zap.String("hold_id", holdID), zap.Error(err))
+		return 0, mapRepoError(err)
+	}
+	if t == nil {
+		return 0, apperror.NotFound("loyalty hold not found")
+	}
+	return t.BalanceAfter, nil
+}
+
+// CancelLoyaltyHold releases a hold's points back to the available balance.
+func (uc *customerUseCase) CancelLoyaltyHold(ctx context.Context, merchantID, holdID string) (*model.LoyaltyHold, error) {
+	mid, err := parseID("merchant_id", merchantID)
+	if err != nil {
+		return nil, err
+	}
+	hid, err := parseID("hold_id", holdID)
+	if err != nil {
+		return nil, err
+	}
+
+	hold, err := uc.repo.CancelLoyaltyHold(ctx, mid, hid)
+	if err != nil {
+		uc.logger.Error("Failed to cancel loyalty hold", zap.String("hold_id", holdID), zap.Error(err))
+		return nil, mapRepoError(err)
+	}
+	if hold == nil {
+		return nil, apperror.NotFound("loyalty hold not found")
+	}
+	return hold, nil
+}
+
+func (uc *customerUseCase) recordLoyaltyTransaction(ctx context.Context, t *model.LoyaltyTransaction) (*model.LoyaltyTransaction, error) {
+	recorded, err := uc.repo.RecordLoyaltyTransaction(ctx, t)
+	if err != nil {
+		uc.logger.Error("Failed to record loyalty transaction",
+			zap.String("customer_id", t.CustomerID.String()),
+			zap.String("type", string(t.Type)),
+			zap.Int32("delta", t.Delta),
+			zap.Error(err),
+		)
+		return nil, mapRepoError(err)
+	}
+	if recorded == nil {
+		return nil, errCustomerNotFound()
+	}
+	return recorded, nil
+}
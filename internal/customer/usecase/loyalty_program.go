@@ -0,0 +1,110 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/fekuna/omnipos-customer-service/internal/apperror"
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// GetLoyaltyProgram returns the merchant's earning rules, or the defaults if
+// the merchant has not configured any.
+func (uc *customerUseCase) GetLoyaltyProgram(ctx context.Context, merchantID string) (*model.LoyaltyProgram, error) {
+	mid, err := parseID("merchant_id", merchantID)
+	if err != nil {
+		return nil, err
+	}
+	return uc.loyaltyProgram(ctx, mid)
+}
+
+func (uc *customerUseCase) UpdateLoyaltyProgram(ctx context.Context, input *model.LoyaltyProgram) (*model.LoyaltyProgram, error) {
+	// Tier settings are optional for callers that only manage earning rules.
+	defaults := model.DefaultLoyaltyProgram(input.MerchantID)
+	if input.TierBasis == "" {
+		input.TierBasis = defaults.TierBasis
+	}
+	if input.TierWindowDays == 0 {
+		input.TierWindowDays = defaults.TierWindowDays
+	}
+	if input.ExpiryPolicy == "" {
+		input.ExpiryPolicy = defaults.ExpiryPolicy
+	}
+
+	var violations []apperror.FieldViolation
+	if _, err := model.CurrencyExponent(input.Currency); err != nil {
+		violations = append(violations, apperror.FieldViolation{Field: "currency", Description: "must be a supported ISO 4217 code such as IDR"})
+	}
+	if input.PointsPerUnit < 0 {
+		violations = append(violations, apperror.FieldViolation{Field: "points_per_unit", Description: "must not be negative"})
+	}
+	switch input.RoundingMode {
+	case model.RoundingFloor, model.RoundingRound, model.RoundingCeil:
+	default:
+		violations = append(violations, apperror.FieldViolation{Field: "rounding_mode", Description: "must be one of floor, round, ceil"})
+	}
+	if input.MinOrderAmount < 0 {
+		violations = append(violations, apperror.FieldViolation{Field: "min_order_amount", Description: "must not be negative"})
+	}
+	if input.MaxPointsPerOrder < 0 {
+		violations = append(violations, apperror.FieldViolation{Field: "max_points_per_order", Description: "must not be negative"})
+	}
+	switch input.TierBasis {
+	case model.TierBasisLifetimePoints, model.TierBasisRollingSpend:
+	default:
+		violations = append(violations, apperror.FieldViolation{Field: "tier_basis", Description: "must be one of lifetime_points, rolling_spend"})
+	}
+	if input.TierWindowDays <= 0 {
+		violations = append(violations, apperror.FieldViolation{Field: "tier_window_days", Description: "must be greater than zero"})
+	}
+	switch input.ExpiryPolicy {
+	case model.ExpiryNone, model.ExpiryEndOfYear:
+	case model.ExpiryMonthsAfterEarn:
+		if input.ExpiryMonths <= 0 {
+			violations = append(violations, apperror.FieldViolation{Field: "expiry_months", Description: "must be greater than zero for months_after_earn"})
+		}
+	default:
+		violations = append(violations, apperror.FieldViolation{Field: "expiry_policy", Description: "must be one of none, months_after_earn, end_of_year"})
+	}
+	if input.ExpiryMonths < 0 {
+		violations = append(violations, apperror.FieldViolation{Field: "expiry_months", Description: "must not be negative"})
+	}
+	if len(violations) > 0 {
+		return nil, apperror.InvalidArgument("invalid loyalty program", violations...)
+	}
+
+	if err := uc.repo.UpsertLoyaltyProgram(ctx, input); err != nil {
+		uc.logger.Error("Failed to update loyalty program", zap.Error(err))
+		return nil, err
+	}
+	return input, nil
+}
+
+func (uc *customerUseCase) loyaltyProgram(ctx context.Context, merchantID uuid.UUID) (*model.LoyaltyProgram, error) {
+	program, err := uc.repo.GetLoyaltyProgram(ctx, merchantID)
+	if err != nil {
+		uc.logger.Error("Failed to get loyalty program", zap.Error(err))
+		return nil, err
+	}
+	if program == nil {
+		return model.DefaultLoyaltyProgram(merchantID), nil
+	}
+	return program, nil
+}
+
+// earningProgram returns the program an order in currency earns under.
+// Merchants that have not configured a program earn at the default rate in
+// the order's own currency, as they did before programs were configurable.
+func (uc *customerUseCase) earningProgram(ctx context.Context, merchantID uuid.UUID, currency string) (*model.LoyaltyProgram, error) {
+	program, err := uc.repo.GetLoyaltyProgram(ctx, merchantID)
+	if err != nil {
+		uc.logger.Error("Failed to get loyalty program", zap.Error(err))
+		return nil, err
+	}
+	if program == nil {
+		program = model.DefaultLoyaltyProgram(merchantID)
+		program.Currency = currency
+	}
+	return program, nil
+}
@@ -0,0 +1,55 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+
+	"github.com/fekuna/omnipos-customer-service/internal/apperror"
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// GetMerchantSettings returns the merchant's settings, or the defaults if
+// the merchant has not configured any.
+func (uc *customerUseCase) GetMerchantSettings(ctx context.Context, merchantID string) (*model.MerchantSettings, error) {
+	mid, err := parseID("merchant_id", merchantID)
+	if err != nil {
+		return nil, err
+	}
+	return uc.merchantSettings(ctx, mid)
+}
+
+// UpdateMerchantSettings replaces the merchant's settings. Changing the phone
+// country only affects numbers saved afterwards; run cmd/phone-normalize to
+// renormalize existing customers.
+func (uc *customerUseCase) UpdateMerchantSettings(ctx context.Context, input *model.MerchantSettings) (*model.MerchantSettings, error) {
+	input.PhoneCountry = strings.ToUpper(strings.TrimSpace(input.PhoneCountry))
+	if input.PhoneCountry == "" {
+		input.PhoneCountry = model.DefaultMerchantSettings(input.MerchantID).PhoneCountry
+	}
+	if err := model.ValidatePhoneCountry(input.PhoneCountry); err != nil {
+		return nil, apperror.InvalidArgument("invalid merchant settings", apperror.FieldViolation{
+			Field:       "phone_country",
+			Description: "must be a supported ISO 3166-1 alpha-2 country code such as ID",
+		})
+	}
+
+	if err := uc.repo.UpsertMerchantSettings(ctx, input); err != nil {
+		uc.logger.Error("Failed to update merchant settings", zap.Error(err))
+		return nil, err
+	}
+	return input, nil
+}
+
+func (uc *customerUseCase) merchantSettings(ctx context.Context, merchantID uuid.UUID) (*model.MerchantSettings, error) {
+	settings, err := uc.repo.GetMerchantSettings(ctx, merchantID)
+	if err != nil {
+		uc.logger.Error("Failed to get merchant settings", zap.Error(err))
+		return nil, err
+	}
+	if settings == nil {
+		return model.DefaultMerchantSettings(merchantID), nil
+	}
+	return settings, nil
+}
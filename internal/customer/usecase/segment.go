@@ -0,0 +1,175 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/apperror"
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// maxSegmentRules bounds how much SQL a single segment compiles to.
+const maxSegmentRules = 20
+
+// maxTagLength matches customer_tags.tag.
+const maxTagLength = 64
+
+func (uc *customerUseCase) ListSegments(ctx context.Context, merchantID string) ([]*model.CustomerSegment, error) {
+	mid, err := parseID("merchant_id", merchantID)
+	if err != nil {
+		return nil, err
+	}
+
+	segments, err := uc.repo.ListSegments(ctx, mid)
+	if err != nil {
+		uc.logger.Error("Failed to list customer segments", zap.Error(err))
+		return nil, err
+	}
+	return segments, nil
+}
+
+// SaveSegment creates the segment if input.ID is unset and updates it
+// otherwise. Membership is re-evaluated before it returns.
+func (uc *customerUseCase) SaveSegment(ctx context.Context, input *model.CustomerSegment) (*model.CustomerSegment, error) {
+	var violations []apperror.FieldViolation
+	if input.Name == "" || len(input.Name) > 64 {
+		violations = append(violations, apperror.FieldViolation{Field: "name", Description: "must be between 1 and 64 characters"})
+	}
+	violations = append(violations, validateSegmentRules(input.Rules)...)
+	if len(violations) > 0 {
+		return nil, apperror.InvalidArgument("invalid customer segment", violations...)
+	}
+
+	if input.ID == uuid.Nil {
+		input.ID = uuid.New()
+		if err := uc.repo.CreateSegment(ctx, input); err != nil {
+			uc.logger.Error("Failed to create customer segment", zap.Error(err))
+			return nil, mapRepoError(err)
+		}
+		return input, nil
+	}
+
+	updated, err := uc.repo.UpdateSegment(ctx, input)
+	if err != nil {
+		uc.logger.Error("Failed to update customer segment", zap.Error(err))
+		return nil, mapRepoError(err)
+	}
+	if !updated {
+		return nil, apperror.NotFound("customer segment not found")
+	}
+	return input, nil
+}
+
+func (uc *customerUseCase) DeleteSegment(ctx context.Context, merchantID, id string) error {
+	mid, err := parseID("merchant_id", merchantID)
+	if err != nil {
+		return err
+	}
+	sid, err := parseID("id", id)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := uc.repo.DeleteSegment(ctx, mid, sid)
+	if err != nil {
+		uc.logger.Error("Failed to delete customer segment", zap.Error(err))
+		return err
+	}
+	if !deleted {
+		return apperror.NotFound("customer segment not found")
+	}
+	return nil
+}
+
+// RefreshStaleSegments fully re-evaluates up to batchSize segments last
+// evaluated more than maxAge ago, and returns how many were refreshed.
+// Customer changes update membership as they happen; this catches up on
+// rules that drift with time alone, such as recency.
+func (uc *customerUseCase) RefreshStaleSegments(ctx context.Context, maxAge time.Duration, batchSize int) (int, error) {
+	segments, err := uc.repo.ListStaleSegments(ctx, time.Now().Add(-maxAge), batchSize)
+	if err != nil {
+		uc.logger.Error("Failed to list stale customer segments", zap.Error(err))
+		return 0, err
+	}
+
+	refreshed := 0
+	for _, s := range segments {
+		if err := uc.repo.EvaluateSegment(ctx, s); err != nil {
+			uc.logger.Error("Failed to evaluate customer segment", zap.String("segment_id", s.ID.String()), zap.Error(err))
+			return refreshed, err
+		}
+		refreshed++
+	}
+	return refreshed, nil
+}
+
+// validateSegmentRules checks each rule's field, operator and value.
+func validateSegmentRules(rules model.SegmentRules) []apperror.FieldViolation {
+	if len(rules) == 0 || len(rules) > maxSegmentRules {
+		return []apperror.FieldViolation{{
+			Field:       "rules",
+			Description: fmt.Sprintf("must have between 1 and %d rules", maxSegmentRules),
+		}}
+	}
+
+	var violations []apperror.FieldViolation
+	for i, rule := range rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		switch rule.Field {
+		case model.SegmentFieldTier, model.SegmentFieldTag:
+			if rule.Operator != model.SegmentOpEq && rule.Operator != model.SegmentOpNeq {
+				violations = append(violations, apperror.FieldViolation{Field: field + ".operator", Description: "must be eq or neq"})
+			}
+			if rule.Field == model.SegmentFieldTier {
+				if _, err := uuid.Parse(rule.Value); err != nil {
+					violations = append(violations, apperror.FieldViolation{Field: field + ".value", Description: "must be a valid tier ID"})
+				}
+			} else if rule.Value == "" || len(rule.Value) > maxTagLength {
+				violations = append(violations, apperror.FieldViolation{Field: field + ".value", Description: "must be a tag between 1 and 64 characters"})
+			}
+		case model.SegmentFieldRecencyDays, model.SegmentFieldFrequency, model.SegmentFieldMonetary,
+			model.SegmentFieldAverageOrderValue, model.SegmentFieldCustomerAgeDays, model.SegmentFieldLoyaltyPoints:
+			switch rule.Operator {
+			case model.SegmentOpEq, model.SegmentOpNeq, model.SegmentOpGt, model.SegmentOpGte, model.SegmentOpLt, model.SegmentOpLte:
+			default:
+				violations = append(violations, apperror.FieldViolation{Field: field + ".operator", Description: "must be one of eq, neq, gt, gte, lt, lte"})
+			}
+			if _, err := strconv.ParseInt(rule.Value, 10, 64); err != nil {
+				violations = append(violations, apperror.FieldViolation{Field: field + ".value", Description: "must be an integer"})
+			}
+		default:
+			violations = append(violations, apperror.FieldViolation{
+				Field:       field + ".field",
+				Description: "must be one of recency_days, frequency, monetary, average_order_value, customer_age_days, loyalty_points, tier_id, tag",
+			})
+		}
+	}
+	return violations
+}
+
+// normalizeTags trims and deduplicates tags, keeping their order.
+func normalizeTags(tags []string) ([]string, []apperror.FieldViolation) {
+	var normalized []string
+	var violations []apperror.FieldViolation
+	seen := make(map[string]bool, len(tags))
+	for i, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || len(tag) > maxTagLength {
+			violations = append(violations, apperror.FieldViolation{
+				Field:       fmt.Sprintf("tags[%d]", i),
+				Description: "must be between 1 and 64 characters",
+			})
+			continue
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized, violations
+}
@@ -0,0 +1,113 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// statsEventPrefix keeps statistics deduplication independent of the loyalty
+// award for the same event, so a redelivery after one of them committed
+// still applies the other.
+const statsEventPrefix = "stats:"
+
+// RecordCustomerOrder adds an order to the customer's statistics. Like
+// EarnLoyaltyPoints it is idempotent per eventID.
+func (uc *customerUseCase) RecordCustomerOrder(ctx context.Context, eventID, merchantID, customerID, orderID string, storeID *string, amount model.Money, orderedAt time.Time) error {
+	return uc.updateOrderStats(ctx, eventID, "OrderCreated", merchantID, customerID, func(event *model.ProcessedEvent, mid, uid uuid.UUID) (bool, error) {
+		return uc.repo.RecordCustomerOrder(ctx, event, &model.CustomerOrder{
+			MerchantID:  mid,
+			OrderID:     orderID,
+			CustomerID:  uid,
+			StoreID:     storeID,
+			TotalAmount: amount.Amount,
+			Currency:    amount.Currency,
+			OrderedAt:   orderedAt,
+		})
+	})
+}
+
+// RecordCustomerOrderRefund deducts a refund from the customer's lifetime
+// spend. A nil amount refunds the whole order.
+func (uc *customerUseCase) RecordCustomerOrderRefund(ctx context.Context, eventID, merchantID, customerID, orderID string, amount *model.Money) error {
+	return uc.updateOrderStats(ctx, eventID, "OrderRefunded", merchantID, customerID, func(event *model.ProcessedEvent, mid, uid uuid.UUID) (bool, error) {
+		order, err := uc.repo.RecordCustomerOrderRefund(ctx, event, mid, uid, orderID, amount)
+		if order != nil && order.Pending {
+			uc.logger.Warn("Refund recorded before its order",
+				zap.String("merchant_id", merchantID),
+				zap.String("customer_id", customerID),
+				zap.String("order_id", orderID))
+		}
+		return order != nil, err
+	})
+}
+
+// CancelCustomerOrder removes a cancelled order from the customer's
+// statistics.
+func (uc *customerUseCase) CancelCustomerOrder(ctx context.Context, eventID, merchantID, customerID, orderID string) error {
+	return uc.updateOrderStats(ctx, eventID, "OrderCancelled", merchantID, customerID, func(event *model.ProcessedEvent, mid, uid uuid.UUID) (bool, error) {
+		return uc.repo.CancelCustomerOrder(ctx, event, mid, uid, orderID)
+	})
+}
+
+// updateOrderStats parses the IDs and runs apply under the statistics key
+// for eventID, mapping its result the way the loyalty event methods do.
+func (uc *customerUseCase) updateOrderStats(ctx context.Context, eventID, eventType, merchantID, customerID string, apply func(*model.ProcessedEvent, uuid.UUID, uuid.UUID) (bool, error)) error {
+	mid, err := parseID("merchant_id", merchantID)
+	if err != nil {
+		return err
+	}
+	uid, err := parseID("customer_id", customerID)
+	if err != nil {
+		return err
+	}
+
+	event := &model.ProcessedEvent{
+		EventID:   statsEventPrefix + eventID,
+		EventType: eventType,
+	}
+	found, err := apply(event, mid, uid)
+	if err != nil {
+		err = mapRepoError(err)
+		if !errors.Is(err, ErrEventAlreadyProcessed) {
+			uc.logger.Error("Failed to update customer statistics", zap.String("event_id", eventID), zap.Error(err))
+		}
+		return err
+	}
+	if !found {
+		return errCustomerNotFound()
+	}
+	return nil
+}
+
+// attachDetails loads the statistics and tags of customers, one query each.
+func (uc *customerUseCase) attachDetails(ctx context.Context, merchantID uuid.UUID, customers []*model.Customer) error {
+	if len(customers) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(customers))
+	for i, c := range customers {
+		ids[i] = c.ID
+	}
+	stats, err := uc.repo.ListCustomerStats(ctx, merchantID, ids)
+	if err != nil {
+		return err
+	}
+	byCustomer := make(map[uuid.UUID]*model.CustomerStats, len(stats))
+	for _, s := range stats {
+		byCustomer[s.CustomerID] = s
+	}
+	tags, err := uc.repo.ListCustomerTags(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, c := range customers {
+		c.Stats = byCustomer[c.ID]
+		c.Tags = tags[c.ID]
+	}
+	return nil
+}
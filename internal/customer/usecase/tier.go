@@ -0,0 +1,150 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/apperror"
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+func (uc *customerUseCase) ListLoyaltyTiers(ctx context.Context, merchantID string) ([]*model.LoyaltyTier, error) {
+	mid, err := parseID("merchant_id", merchantID)
+	if err != nil {
+		return nil, err
+	}
+
+	tiers, err := uc.repo.ListLoyaltyTiers(ctx, mid)
+	if err != nil {
+		uc.logger.Error("Failed to list loyalty tiers", zap.Error(err))
+		return nil, err
+	}
+	return tiers, nil
+}
+
+// SaveLoyaltyTier creates the tier if input.ID is unset and updates it
+// otherwise. The tier refresher then moves existing customers as needed.
+func (uc *customerUseCase) SaveLoyaltyTier(ctx context.Context, input *model.LoyaltyTier) (*model.LoyaltyTier, error) {
+	var violations []apperror.FieldViolation
+	if input.Name == "" || len(input.Name) > 64 {
+		violations = append(violations, apperror.FieldViolation{Field: "name", Description: "must be between 1 and 64 characters"})
+	}
+	if input.Threshold < 0 {
+		violations = append(violations, apperror.FieldViolation{Field: "threshold", Description: "must not be negative"})
+	}
+	if input.EarnMultiplier < 0 {
+		violations = append(violations, apperror.FieldViolation{Field: "earn_multiplier", Description: "must not be negative"})
+	}
+	if len(violations) > 0 {
+		return nil, apperror.InvalidArgument("invalid loyalty tier", violations...)
+	}
+
+	if input.ID == uuid.Nil {
+		input.ID = uuid.New()
+		if err := uc.repo.CreateLoyaltyTier(ctx, input); err != nil {
+			uc.logger.Error("Failed to create loyalty tier", zap.Error(err))
+			return nil, mapRepoError(err)
+		}
+		return input, nil
+	}
+
+	updated, err := uc.repo.UpdateLoyaltyTier(ctx, input)
+	if err != nil {
+		uc.logger.Error("Failed to update loyalty tier", zap.Error(err))
+		return nil, mapRepoError(err)
+	}
+	if !updated {
+		return nil, apperror.NotFound("loyalty tier not found")
+	}
+	return input, nil
+}
+
+func (uc *customerUseCase) DeleteLoyaltyTier(ctx context.Context, merchantID, id string) error {
+	mid, err := parseID("merchant_id", merchantID)
+	if err != nil {
+		return err
+	}
+	tid, err := parseID("id", id)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := uc.repo.DeleteLoyaltyTier(ctx, mid, tid)
+	if err != nil {
+		uc.logger.Error("Failed to delete loyalty tier", zap.Error(err))
+		return err
+	}
+	if !deleted {
+		return apperror.NotFound("loyalty tier not found")
+	}
+	return nil
+}
+
+func (uc *customerUseCase) ListTierHistory(ctx context.Context, merchantID, customerID string) ([]*model.CustomerTierChange, error) {
+	mid, err := parseID("merchant_id", merchantID)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := parseID("customer_id", customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	customer, err := uc.repo.GetByID(ctx, mid, uid)
+	if err != nil {
+		return nil, err
+	}
+	if customer == nil {
+		return nil, errCustomerNotFound()
+	}
+
+	changes, err := uc.repo.ListTierHistory(ctx, mid, uid)
+	if err != nil {
+		uc.logger.Error("Failed to list tier history", zap.Error(err))
+		return nil, err
+	}
+	return changes, nil
+}
+
+// earnMultiplier returns the multiplier of the customer's current tier, or 1
+// if they have none.
+func (uc *customerUseCase) earnMultiplier(ctx context.Context, merchantID, customerID uuid.UUID) (float64, error) {
+	tier, err := uc.repo.GetCustomerTier(ctx, merchantID, customerID)
+	if err != nil {
+		uc.logger.Error("Failed to get customer tier", zap.Error(err))
+		return 0, err
+	}
+	if tier == nil {
+		return 1, nil
+	}
+	return tier.EarnMultiplier, nil
+}
+
+// RefreshStaleTiers re-evaluates up to batchSize customers whose tier is
+// stale, and returns how many were evaluated. A tier is stale once the
+// merchant's tiers or program change, and on rolling-spend programs also
+// after maxAge, since spend leaves the window without any new activity.
+// Customers that fail are logged and skipped so they do not hold up the
+// rest; they are retried on the next call.
+func (uc *customerUseCase) RefreshStaleTiers(ctx context.Context, maxAge time.Duration, batchSize int) (int, error) {
+	customers, err := uc.repo.ListStaleTierCustomers(ctx, time.Now().Add(-maxAge), batchSize)
+	if err != nil {
+		uc.logger.Error("Failed to list customers with stale tiers", zap.Error(err))
+		return 0, err
+	}
+
+	evaluated := 0
+	for _, c := range customers {
+		if ctx.Err() != nil {
+			return evaluated, ctx.Err()
+		}
+		if _, err := uc.repo.ReevaluateCustomerTier(ctx, c.MerchantID, c.ID); err != nil {
+			uc.logger.Error("Failed to re-evaluate customer tier", zap.String("customer_id", c.ID.String()), zap.Error(err))
+			continue
+		}
+		evaluated++
+	}
+	return evaluated, nil
+}
@@ -2,9 +2,10 @@ package usecase
 
 import (
 	"context"
-	"errors"
+	"strings"
 	"time"
 
+	"github.com/fekuna/omnipos-customer-service/internal/apperror"
 	"github.com/fekuna/omnipos-customer-service/internal/customer/repository"
 	"github.com/fekuna/omnipos-customer-service/internal/model"
 	"github.com/fekuna/omnipos-pkg/logger"
@@ -14,11 +15,41 @@ import (
 
 type UseCase interface {
 	CreateCustomer(ctx context.Context, input *model.Customer) (*model.Customer, error)
-	GetCustomer(ctx context.Context, id string) (*model.Customer, error)
-	ListCustomers(ctx context.Context, merchantID string, page, pageSize int, search string) ([]*model.Customer, int, error)
-	UpdateCustomer(ctx context.Context, input *model.Customer) (*model.Customer, error)
-	DeleteCustomer(ctx context.Context, id string) error
-	AddLoyaltyPoints(ctx context.Context, customerID string, points int32) (int32, error)
+	GetCustomer(ctx context.Context, merchantID, id string) (*model.Customer, error)
+	// CustomerMerchant returns the ID of the merchant that owns a customer.
+	// It is not scoped by merchant and must not back an RPC.
+	CustomerMerchant(ctx context.Context, customerID string) (string, error)
+	ListCustomers(ctx context.Context, merchantID string, opts model.CustomerListOptions) (*model.CustomerPage, error)
+	UpdateCustomer(ctx context.Context, input *model.Customer, updateMask []string) (*model.Customer, error)
+	DeleteCustomer(ctx context.Context, merchantID, id string) error
+	RestoreCustomer(ctx context.Context, merchantID, id string) (*model.Customer, error)
+	PurgeDeletedCustomers(ctx context.Context, retention time.Duration) (int64, error)
+	AddLoyaltyPoints(ctx context.Context, merchantID, customerID string, points int32, actor, reason string) (int32, error)
+	EarnLoyaltyPoints(ctx context.Context, eventID, merchantID, customerID, orderID string, amount model.Money) (*model.LoyaltyTransaction, error)
+	ReverseOrderPoints(ctx context.Context, eventID, eventType, merchantID, customerID, orderID string, refundAmount *model.Money) (*model.LoyaltyTransaction, error)
+	ListLoyaltyTransactions(ctx context.Context, merchantID, customerID string, page, pageSize int) ([]*model.LoyaltyTransaction, int, error)
+	RedeemLoyaltyPoints(ctx context.Context, merchantID, customerID string, points int32, orderID, actor, reason string) (int32, error)
+	HoldLoyaltyPoints(ctx context.Context, merchantID, customerID string, points int32, orderID string) (*model.LoyaltyHold, error)
+	ConfirmLoyaltyHold(ctx context.Context, merchantID, holdID, actor string) (int32, error)
+	CancelLoyaltyHold(ctx context.Context, merchantID, holdID string) (*model.LoyaltyHold, error)
+	GetLoyaltyProgram(ctx context.Context, merchantID string) (*model.LoyaltyProgram, error)
+	UpdateLoyaltyProgram(ctx context.Context, input *model.LoyaltyProgram) (*model.LoyaltyProgram, error)
+	ListLoyaltyTiers(ctx context.Context, merchantID string) ([]*model.LoyaltyTier, error)
+	SaveLoyaltyTier(ctx context.Context, input *model.LoyaltyTier) (*model.LoyaltyTier, error)
+	DeleteLoyaltyTier(ctx context.Context, merchantID, id string) error
+	ListTierHistory(ctx context.Context, merchantID, customerID string) ([]*model.CustomerTierChange, error)
+	RefreshStaleTiers(ctx context.Context, maxAge time.Duration, batchSize int) (int, error)
+	ExpireDuePoints(ctx context.Context, batchSize int) (int, error)
+	ListUpcomingExpirations(ctx context.Context, merchantID, customerID string, within time.Duration) ([]*model.PointExpiration, error)
+	RecordCustomerOrder(ctx context.Context, eventID, merchantID, customerID, orderID string, storeID *string, amount model.Money, orderedAt time.Time) error
+	RecordCustomerOrderRefund(ctx context.Context, eventID, merchantID, customerID, orderID string, amount *model.Money) error
+	CancelCustomerOrder(ctx context.Context, eventID, merchantID, customerID, orderID string) error
+	ListSegments(ctx context.Context, merchantID string) ([]*model.CustomerSegment, error)
+	SaveSegment(ctx context.Context, input *model.CustomerSegment) (*model.CustomerSegment, error)
+	DeleteSegment(ctx context.Context, merchantID, id string) error
+	RefreshStaleSegments(ctx context.Context, maxAge time.Duration, batchSize int) (int, error)
+	GetMerchantSettings(ctx context.Context, merchantID string) (*model.MerchantSettings, error)
+	UpdateMerchantSettings(ctx context.Context, input *model.MerchantSettings) (*model.MerchantSettings, error)
 }
 
 type customerUseCase struct {
@@ -35,6 +66,9 @@ func (uc *customerUseCase) CreateCustomer(ctx context.Context, input *model.Cust
 	if input.ID == uuid.Nil {
 		input.ID = uuid.New()
 	}
+	if err := uc.validateCustomer(ctx, input, model.CustomerFields); err != nil {
+		return nil, err
+	}
 	// Initial Loyalty Points
 	input.LoyaltyPoints = 0
 	input.CreatedAt = time.Now()
@@ -42,105 +76,239 @@ func (uc *customerUseCase) CreateCustomer(ctx context.Context, input *model.Cust
 
 	if err := uc.repo.Create(ctx, input); err != nil {
 		uc.logger.Error("Failed to create customer", zap.Error(err))
-		return nil, err
+		return nil, mapRepoError(err)
 	}
 	return input, nil
 }
 
-func (uc *customerUseCase) GetCustomer(ctx context.Context, id string) (*model.Customer, error) {
-	uid, err := uuid.Parse(id)
+func (uc *customerUseCase) CustomerMerchant(ctx context.Context, customerID string) (string, error) {
+	id, err := parseID("customer_id", customerID)
+	if err != nil {
+		return "", err
+	}
+	merchantID, err := uc.repo.GetCustomerMerchantID(ctx, id)
+	if err != nil {
+		uc.logger.Error("Failed to get customer merchant", zap.Error(err))
+		return "", err
+	}
+	if merchantID == nil {
+		return "", errCustomerNotFound()
+	}
+	return merchantID.String(), nil
+}
+
+func (uc *customerUseCase) GetCustomer(ctx context.Context, merchantID, id string) (*model.Customer, error) {
+	mid, err := parseID("merchant_id", merchantID)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := parseID("id", id)
 	if err != nil {
-		return nil, errors.New("invalid customer id")
+		return nil, err
 	}
 
-	customer, err := uc.repo.GetByID(ctx, uid)
+	customer, err := uc.repo.GetByID(ctx, mid, uid)
 	if err != nil {
 		uc.logger.Error("Failed to get customer", zap.Error(err))
 		return nil, err
 	}
 	if customer == nil {
-		return nil, errors.New("customer not found")
+		return nil, errCustomerNotFound()
+	}
+
+	if err := uc.attachDetails(ctx, mid, []*model.Customer{customer}); err != nil {
+		uc.logger.Error("Failed to load customer details", zap.Error(err))
+		return nil, err
 	}
 	return customer, nil
 }
 
-func (uc *customerUseCase) ListCustomers(ctx context.Context, merchantID string, page, pageSize int, search string) ([]*model.Customer, int, error) {
-	mid, err := uuid.Parse(merchantID)
+func (uc *customerUseCase) ListCustomers(ctx context.Context, merchantID string, opts model.CustomerListOptions) (*model.CustomerPage, error) {
+	mid, err := parseID("merchant_id", merchantID)
 	if err != nil {
-		return nil, 0, errors.New("invalid merchant id")
+		return nil, err
+	}
+	if opts.Page < 0 {
+		opts.Page = 0
+	}
+	if opts.PageSize < 1 {
+		opts.PageSize = 10
 	}
-	if page < 1 {
-		page = 1
+	if opts.Page > 0 {
+		// Offset paging has always reported the total.
+		opts.IncludeTotal = true
 	}
-	if pageSize < 1 {
-		pageSize = 10
+	searching := strings.TrimSpace(opts.Search) != ""
+	if opts.SortBy == "" {
+		// Searches default to best match, listings to creation time.
+		opts.SortBy = model.SortByCreatedAt
+		if searching {
+			opts.SortBy = model.SortByRelevance
+		}
+	}
+	if !opts.SortBy.Valid() {
+		return nil, apperror.InvalidArgument("invalid sort_by", apperror.FieldViolation{
+			Field:       "sort_by",
+			Description: "must be one of created_at, name, loyalty_points, lifetime_spend, order_count, average_order_value, last_purchase_at, relevance",
+		})
+	}
+	if opts.SortBy == model.SortByRelevance && !searching {
+		return nil, apperror.InvalidArgument("invalid sort_by", apperror.FieldViolation{
+			Field:       "sort_by",
+			Description: "relevance requires a search",
+		})
+	}
+
+	if violations := normalizeListFilters(&opts); len(violations) > 0 {
+		return nil, apperror.InvalidArgument("invalid customer filters", violations...)
 	}
 
-	customers, total, err := uc.repo.List(ctx, mid, page, pageSize, search)
+	page, err := uc.repo.List(ctx, mid, opts)
 	if err != nil {
 		uc.logger.Error("Failed to list customers", zap.Error(err))
-		return nil, 0, err
+		return nil, mapRepoError(err)
 	}
-	return customers, total, nil
+	if err := uc.attachDetails(ctx, mid, page.Customers); err != nil {
+		uc.logger.Error("Failed to load customer details", zap.Error(err))
+		return nil, err
+	}
+	return page, nil
 }
 
-func (uc *customerUseCase) UpdateCustomer(ctx context.Context, input *model.Customer) (*model.Customer, error) {
-	existing, err := uc.repo.GetByID(ctx, input.ID)
+// UpdateCustomer changes the fields named in updateMask to their values in
+// input and leaves the others as stored. Without a mask only the fields set
+// in input change, so a field can only be cleared by naming it.
+func (uc *customerUseCase) UpdateCustomer(ctx context.Context, input *model.Customer, updateMask []string) (*model.Customer, error) {
+	fields, err := parseUpdateMask(updateMask, input)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := uc.repo.GetByID(ctx, input.MerchantID, input.ID)
 	if err != nil {
 		return nil, err
 	}
 	if existing == nil {
-		return nil, errors.New("customer not found")
+		return nil, errCustomerNotFound()
+	}
+	// Load the current tags and stats so the response is complete when the
+	// mask leaves tags unchanged.
+	if err := uc.attachDetails(ctx, existing.MerchantID, []*model.Customer{existing}); err != nil {
+		uc.logger.Error("Failed to load customer details", zap.Error(err))
+		return nil, err
 	}
 
-	// Update fields
-	existing.Name = input.Name
-	existing.Phone = input.Phone
-	existing.Email = input.Email
-	existing.Address = input.Address
-	existing.UpdatedAt = time.Now()
+	for _, f := range fields {
+		switch f {
+		case model.CustomerFieldName:
+			existing.Name = input.Name
+		case model.CustomerFieldPhone:
+			existing.Phone = input.Phone
+		case model.CustomerFieldEmail:
+			existing.Email = input.Email
+		case model.CustomerFieldAddress:
+			existing.Address = input.Address
+		case model.CustomerFieldTags:
+			existing.Tags = input.Tags
+		case model.CustomerFieldBirthday:
+			existing.Birthday = input.Birthday
+		}
+	}
+	if err := uc.validateCustomer(ctx, existing, fields); err != nil {
+		return nil, err
+	}
 
-	if err := uc.repo.Update(ctx, existing); err != nil {
+	if err := uc.repo.Update(ctx, existing, fields); err != nil {
 		uc.logger.Error("Failed to update customer", zap.Error(err))
-		return nil, err
+		return nil, mapRepoError(err)
 	}
 	return existing, nil
 }
 
-func (uc *customerUseCase) DeleteCustomer(ctx context.Context, id string) error {
-	uid, err := uuid.Parse(id)
+func (uc *customerUseCase) DeleteCustomer(ctx context.Context, merchantID, id string) error {
+	mid, err := parseID("merchant_id", merchantID)
+	if err != nil {
+		return err
+	}
+	uid, err := parseID("id", id)
+	if err != nil {
+		return err
+	}
+
+	existing, err := uc.repo.GetByID(ctx, mid, uid)
 	if err != nil {
-		return errors.New("invalid customer id")
+		return err
 	}
-	if err := uc.repo.Delete(ctx, uid); err != nil {
+	if existing == nil {
+		return errCustomerNotFound()
+	}
+
+	if err := uc.repo.Delete(ctx, mid, uid); err != nil {
 		uc.logger.Error("Failed to delete customer", zap.Error(err))
 		return err
 	}
 	return nil
 }
 
-func (uc *customerUseCase) AddLoyaltyPoints(ctx context.Context, customerID string, points int32) (int32, error) {
-	uid, err := uuid.Parse(customerID)
+func (uc *customerUseCase) RestoreCustomer(ctx context.Context, merchantID, id string) (*model.Customer, error) {
+	mid, err := parseID("merchant_id", merchantID)
 	if err != nil {
-		return 0, errors.New("invalid customer id")
+		return nil, err
+	}
+	uid, err := parseID("id", id)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := uc.repo.AddLoyaltyPoints(ctx, uid, points); err != nil {
-		uc.logger.Error("Failed to add loyalty points", zap.Error(err))
-		return 0, err
+	customer, err := uc.repo.Restore(ctx, mid, uid)
+	if err != nil {
+		uc.logger.Error("Failed to restore customer", zap.Error(err))
+		return nil, mapRepoError(err)
+	}
+	if customer == nil {
+		return nil, apperror.NotFound("deleted customer not found")
 	}
+	return customer, nil
+}
 
-	// Fetch updated customer to get latest points
-	updatedCustomer, err := uc.repo.GetByID(ctx, uid)
+// PurgeDeletedCustomers permanently removes customers that were soft-deleted
+// more than retention ago.
+func (uc *customerUseCase) PurgeDeletedCustomers(ctx context.Context, retention time.Duration) (int64, error) {
+	purged, err := uc.repo.PurgeDeleted(ctx, time.Now().Add(-retention))
 	if err != nil {
-		// Points added but failed to fetch. Return 0 or error?
-		// Better to return success but 0 points, or try to estimate?
-		// Or strictly return error.
+		uc.logger.Error("Failed to purge deleted customers", zap.Error(err))
 		return 0, err
 	}
-	if updatedCustomer == nil {
-		return 0, errors.New("customer not found after update")
+	return purged, nil
+}
+
+// maxTagFilters bounds how many tags one listing can require.
+const maxTagFilters = 10
+
+// normalizeListFilters normalizes the tag filter and rejects empty ranges
+// and impossible values.
+func normalizeListFilters(opts *model.CustomerListOptions) []apperror.FieldViolation {
+	var violations []apperror.FieldViolation
+	timeRange := func(field string, after, before *time.Time) {
+		if after != nil && before != nil && !after.Before(*before) {
+			violations = append(violations, apperror.FieldViolation{Field: field, Description: "must end after it starts"})
+		}
+	}
+	timeRange("created_before", opts.CreatedAfter, opts.CreatedBefore)
+	timeRange("updated_before", opts.UpdatedAfter, opts.UpdatedBefore)
+	timeRange("last_purchase_before", opts.LastPurchaseAfter, opts.LastPurchaseBefore)
+	if opts.MinLoyaltyPoints != nil && opts.MaxLoyaltyPoints != nil && *opts.MinLoyaltyPoints > *opts.MaxLoyaltyPoints {
+		violations = append(violations, apperror.FieldViolation{Field: "max_loyalty_points", Description: "must not be less than min_loyalty_points"})
+	}
+	if opts.BirthdayMonth != nil && (*opts.BirthdayMonth < 1 || *opts.BirthdayMonth > 12) {
+		violations = append(violations, apperror.FieldViolation{Field: "birthday_month", Description: "must be between 1 and 12"})
 	}
 
-	return updatedCustomer.LoyaltyPoints, nil
+	tags, tagViolations := normalizeTags(opts.Tags)
+	violations = append(violations, tagViolations...)
+	if len(tags) > maxTagFilters {
+		violations = append(violations, apperror.FieldViolation{Field: "tags", Description: "must not have more than 10 tags"})
+	}
+	opts.Tags = tags
+	return violations
 }
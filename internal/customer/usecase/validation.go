@@ -0,0 +1,203 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fekuna/omnipos-customer-service/internal/apperror"
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+)
+
+// Limits for customer fields. Name, phone and email match their column
+// sizes; address is TEXT but is capped so it stays printable on receipts.
+const (
+	maxNameLength    = 255
+	maxPhoneLength   = 20
+	maxEmailLength   = 255
+	maxAddressLength = 500
+	maxCustomerTags  = 20
+)
+
+// validateCustomer validates the given fields of c against the merchant's
+// settings and reports all field violations in one InvalidArgument error.
+func (uc *customerUseCase) validateCustomer(ctx context.Context, c *model.Customer, fields []model.CustomerField) error {
+	settings, err := uc.merchantSettings(ctx, c.MerchantID)
+	if err != nil {
+		return err
+	}
+	if violations := customerViolations(c, fields, settings.PhoneCountry, time.Now()); len(violations) > 0 {
+		return apperror.InvalidArgument("invalid customer", violations...)
+	}
+	return nil
+}
+
+// customerViolations trims and normalizes the given fields of c in place and
+// returns every problem found, so callers can report them together. Other
+// fields are left alone, so stored values that predate a rule do not block
+// partial updates. The phone is read in phoneCountry and its E.164 form
+// stored in c.PhoneE164.
+func customerViolations(c *model.Customer, fields []model.CustomerField, phoneCountry string, now time.Time) []apperror.FieldViolation {
+	var violations []apperror.FieldViolation
+	add := func(field, description string) {
+		violations = append(violations, apperror.FieldViolation{Field: field, Description: description})
+	}
+
+	for _, f := range fields {
+		switch f {
+		case model.CustomerFieldName:
+			c.Name = strings.TrimSpace(c.Name)
+			switch {
+			case c.Name == "":
+				add("name", "is required")
+			case utf8.RuneCountInString(c.Name) > maxNameLength:
+				add("name", fmt.Sprintf("must not be longer than %d characters", maxNameLength))
+			case hasControlChars(c.Name, false):
+				add("name", "must not contain control characters")
+			}
+
+		case model.CustomerFieldPhone:
+			c.Phone = strings.TrimSpace(c.Phone)
+			c.PhoneE164 = nil
+			switch {
+			case c.Phone == "":
+				add("phone", "is required")
+			case utf8.RuneCountInString(c.Phone) > maxPhoneLength:
+				add("phone", fmt.Sprintf("must not be longer than %d characters", maxPhoneLength))
+			default:
+				e164, err := model.NormalizePhone(c.Phone, phoneCountry)
+				if err != nil {
+					add("phone", "must be a phone number, with a + and country code if not in "+phoneCountry)
+					break
+				}
+				c.PhoneE164 = &e164
+			}
+
+		case model.CustomerFieldEmail:
+			c.Email = strings.TrimSpace(c.Email)
+			switch {
+			case c.Email == "":
+			case utf8.RuneCountInString(c.Email) > maxEmailLength:
+				add("email", fmt.Sprintf("must not be longer than %d characters", maxEmailLength))
+			case !validEmail(c.Email):
+				add("email", "must be an email address such as name@example.com")
+			}
+
+		case model.CustomerFieldAddress:
+			c.Address = strings.TrimSpace(c.Address)
+			switch {
+			case utf8.RuneCountInString(c.Address) > maxAddressLength:
+				add("address", fmt.Sprintf("must not be longer than %d characters", maxAddressLength))
+			case hasControlChars(c.Address, true):
+				add("address", "must not contain control characters other than line breaks")
+			}
+
+		case model.CustomerFieldBirthday:
+			if c.Birthday != nil && c.Birthday.After(now) {
+				add("birthday", "must not be in the future")
+			}
+
+		case model.CustomerFieldTags:
+			tags, tagViolations := normalizeTags(c.Tags)
+			violations = append(violations, tagViolations...)
+			if len(tags) > maxCustomerTags {
+				add("tags", fmt.Sprintf("must not have more than %d tags", maxCustomerTags))
+			}
+			c.Tags = tags
+		}
+	}
+	return violations
+}
+
+// parseUpdateMask validates the field mask paths of an update and returns the
+// fields to change, without duplicates. An empty mask means the fields set in
+// input, since a client that omits the mask cannot mean to clear the rest;
+// an update that sets nothing is rejected.
+func parseUpdateMask(paths []string, input *model.Customer) ([]model.CustomerField, error) {
+	if len(paths) == 0 {
+		fields := setCustomerFields(input)
+		if len(fields) == 0 {
+			return nil, apperror.InvalidArgument("invalid update mask", apperror.FieldViolation{
+				Field:       "update_mask",
+				Description: "must name the fields to change when the request sets none",
+			})
+		}
+		return fields, nil
+	}
+	var fields []model.CustomerField
+	var violations []apperror.FieldViolation
+	seen := make(map[model.CustomerField]bool, len(paths))
+	for i, path := range paths {
+		f := model.CustomerField(path)
+		if !f.Valid() {
+			violations = append(violations, apperror.FieldViolation{
+				Field:       fmt.Sprintf("update_mask.paths[%d]", i),
+				Description: "must be one of name, phone, email, address, tags, birthday",
+			})
+			continue
+		}
+		if !seen[f] {
+			seen[f] = true
+			fields = append(fields, f)
+		}
+	}
+	if len(violations) > 0 {
+		return nil, apperror.InvalidArgument("invalid update mask", violations...)
+	}
+	return fields, nil
+}
+
+// setCustomerFields returns the fields of c that hold a value.
+func setCustomerFields(c *model.Customer) []model.CustomerField {
+	var fields []model.CustomerField
+	for _, f := range model.CustomerFields {
+		var set bool
+		switch f {
+		case model.CustomerFieldName:
+			set = c.Name != ""
+		case model.CustomerFieldPhone:
+			set = c.Phone != ""
+		case model.CustomerFieldEmail:
+			set = c.Email != ""
+		case model.CustomerFieldAddress:
+			set = c.Address != ""
+		case model.CustomerFieldTags:
+			set = len(c.Tags) > 0
+		case model.CustomerFieldBirthday:
+			set = c.Birthday != nil
+		}
+		if set {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// validEmail accepts a bare address with a dotted domain. mail.ParseAddress
+// alone also accepts display names ("Ann <ann@example.com>") and local
+// domains, which cannot be mailed to.
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return false
+	}
+	at := strings.LastIndexByte(email, '@')
+	domain := email[at+1:]
+	return strings.Contains(domain, ".") && !strings.HasPrefix(domain, ".") && !strings.HasSuffix(domain, ".")
+}
+
+func hasControlChars(s string, allowLineBreaks bool) bool {
+	for _, r := range s {
+		if allowLineBreaks && (r == '\n' || r == '\r') {
+			continue
+		}
+		if unicode.IsControl(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,349 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fekuna/omnipos-customer-service/internal/apperror"
+	"github.com/fekuna/omnipos-customer-service/internal/customer/repository"
+	"github.com/fekuna/omnipos-customer-service/internal/middleware"
+	"github.com/fekuna/omnipos-customer-service/internal/model"
+	"github.com/fekuna/omnipos-pkg/logger"
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+)
+
+var validationNow = time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+
+func validCustomer() *model.Customer {
+	birthday := time.Date(1990, time.May, 1, 0, 0, 0, 0, time.UTC)
+	return &model.Customer{
+		Name:     "Ann Tan",
+		Phone:    "0812 3456 7890",
+		Email:    "ann@example.com",
+		Address:  "Jalan Merdeka 1\nJakarta",
+		Tags:     []string{"vip"},
+		Birthday: &birthday,
+	}
+}
+
+func manyTags(n int) []string {
+	tags := make([]string, n)
+	for i := range tags {
+		tags[i] = strings.Repeat("t", i+1)
+	}
+	return tags
+}
+
+func TestCustomerViolations(t *testing.T) {
+	tomorrow := validationNow.AddDate(0, 0, 1)
+
+	tests := []struct {
+		name   string
+		change func(c *model.Customer)
+		fields []model.CustomerField // defaults to every field
+		want   []string
+	}{
+		{name: "valid", change: func(c *model.Customer) {}},
+
+		{name: "empty name", change: func(c *model.Customer) { c.Name = "   " }, want: []string{"name"}},
+		{name: "longest name", change: func(c *model.Customer) { c.Name = strings.Repeat("a", maxNameLength) }},
+		{name: "overlong name", change: func(c *model.Customer) { c.Name = strings.Repeat("a", maxNameLength+1) }, want: []string{"name"}},
+		{name: "name counted in characters", change: func(c *model.Customer) { c.Name = strings.Repeat("é", maxNameLength) }},
+		{name: "name with NUL", change: func(c *model.Customer) { c.Name = "Ann\x00Tan" }, want: []string{"name"}},
+		{name: "name with line break", change: func(c *model.Customer) { c.Name = "Ann\nTan" }, want: []string{"name"}},
+
+		{name: "empty phone", change: func(c *model.Customer) { c.Phone = "" }, want: []string{"phone"}},
+		{name: "overlong phone", change: func(c *model.Customer) { c.Phone = strings.Repeat("1", maxPhoneLength+1) }, want: []string{"phone"}},
+		{name: "unparseable phone", change: func(c *model.Customer) { c.Phone = "call me" }, want: []string{"phone"}},
+		{name: "phone too short", change: func(c *model.Customer) { c.Phone = "+62 12" }, want: []string{"phone"}},
+
+		{name: "no email", change: func(c *model.Customer) { c.Email = "" }},
+		{name: "email without domain", change: func(c *model.Customer) { c.Email = "ann" }, want: []string{"email"}},
+		{name: "email with local domain", change: func(c *model.Customer) { c.Email = "ann@localhost" }, want: []string{"email"}},
+		{name: "email with display name", change: func(c *model.Customer) { c.Email = "Ann <ann@example.com>" }, want: []string{"email"}},
+		{name: "email with trailing dot", change: func(c *model.Customer) { c.Email = "ann@example." }, want: []string{"email"}},
+		{name: "overlong email", change: func(c *model.Customer) { c.Email = strings.Repeat("a", maxEmailLength) + "@example.com" }, want: []string{"email"}},
+
+		{name: "address with tab", change: func(c *model.Customer) { c.Address = "Jalan\tMerdeka" }, want: []string{"address"}},
+		{name: "address with bell", change: func(c *model.Customer) { c.Address = "Jalan Merdeka\a" }, want: []string{"address"}},
+		{name: "overlong address", change: func(c *model.Customer) { c.Address = strings.Repeat("a", maxAddressLength+1) }, want: []string{"address"}},
+
+		{name: "empty tag", change: func(c *model.Customer) { c.Tags = []string{"vip", " "} }, want: []string{"tags[1]"}},
+		{name: "overlong tag", change: func(c *model.Customer) { c.Tags = []string{strings.Repeat("t", 65)} }, want: []string{"tags[0]"}},
+		{name: "most tags", change: func(c *model.Customer) { c.Tags = manyTags(maxCustomerTags) }},
+		{name: "too many tags", change: func(c *model.Customer) { c.Tags = manyTags(maxCustomerTags + 1) }, want: []string{"tags"}},
+
+		{name: "birthday today", change: func(c *model.Customer) { c.Birthday = &validationNow }},
+		{name: "future birthday", change: func(c *model.Customer) { c.Birthday = &tomorrow }, want: []string{"birthday"}},
+		{name: "no birthday", change: func(c *model.Customer) { c.Birthday = nil }},
+
+		{
+			name: "several violations",
+			change: func(c *model.Customer) {
+				c.Name = ""
+				c.Phone = "call me"
+				c.Email = "ann"
+				c.Birthday = &tomorrow
+			},
+			want: []string{"name", "phone", "email", "birthday"},
+		},
+		{
+			name:   "only the given fields",
+			change: func(c *model.Customer) { c.Name = ""; c.Email = "ann" },
+			fields: []model.CustomerField{model.CustomerFieldEmail},
+			want:   []string{"email"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validCustomer()
+			tt.change(c)
+			fields := tt.fields
+			if fields == nil {
+				fields = model.CustomerFields
+			}
+
+			var got []string
+			for _, v := range customerViolations(c, fields, "ID", validationNow) {
+				got = append(got, v.Field)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("violations on %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomerViolationsNormalizes(t *testing.T) {
+	c := validCustomer()
+	c.Name = "  Ann Tan  "
+	c.Phone = " 0812-3456-7890 "
+	c.Email = " ann@example.com "
+	c.Tags = []string{" vip ", "vip", "new"}
+
+	if v := customerViolations(c, model.CustomerFields, "ID", validationNow); len(v) > 0 {
+		t.Fatalf("unexpected violations: %+v", v)
+	}
+	if c.Name != "Ann Tan" || c.Phone != "0812-3456-7890" || c.Email != "ann@example.com" {
+		t.Errorf("fields not trimmed: %q %q %q", c.Name, c.Phone, c.Email)
+	}
+	if c.PhoneE164 == nil || *c.PhoneE164 != "+6281234567890" {
+		t.Errorf("PhoneE164 = %v, want +6281234567890", c.PhoneE164)
+	}
+	if strings.Join(c.Tags, ",") != "vip,new" {
+		t.Errorf("tags = %v, want [vip new]", c.Tags)
+	}
+}
+
+// settingsRepository serves merchant settings; a merchant without stored
+// settings gets the defaults. Other methods are not reached.
+type settingsRepository struct {
+	repository.Repository
+	settings *model.MerchantSettings
+}
+
+func (r *settingsRepository) GetMerchantSettings(context.Context, uuid.UUID) (*model.MerchantSettings, error) {
+	return r.settings, nil
+}
+
+// TestCreateCustomerReportsViolationsTogether checks that every invalid field
+// comes back in a single InvalidArgument status with BadRequest details.
+func TestCreateCustomerReportsViolationsTogether(t *testing.T) {
+	log := logger.NewZapLogger(&logger.ZapLoggerConfig{Encoding: "console", Level: "error"})
+	uc := NewCustomerUseCase(&settingsRepository{}, log)
+
+	future := time.Now().AddDate(1, 0, 0)
+	_, err := uc.CreateCustomer(context.Background(), &model.Customer{
+		MerchantID: uuid.New(),
+		Name:       "",
+		Phone:      "call me",
+		Email:      "ann@",
+		Tags:       []string{""},
+		Birthday:   &future,
+	})
+
+	appErr, ok := apperror.As(err)
+	if !ok {
+		t.Fatalf("got %v, want an apperror", err)
+	}
+	st := middleware.ToStatus(appErr)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("code = %v, want InvalidArgument", st.Code())
+	}
+
+	var got []string
+	for _, detail := range st.Details() {
+		if br, ok := detail.(*errdetails.BadRequest); ok {
+			for _, v := range br.GetFieldViolations() {
+				got = append(got, v.GetField())
+				if v.GetDescription() == "" {
+					t.Errorf("violation on %s has no description", v.GetField())
+				}
+			}
+		}
+	}
+	want := []string{"name", "phone", "email", "tags[0]", "birthday"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("field violations on %v, want %v", got, want)
+	}
+}
+
+// TestCreateCustomerUsesMerchantPhoneCountry checks that national numbers are
+// read in the merchant's country.
+func TestCreateCustomerUsesMerchantPhoneCountry(t *testing.T) {
+	log := logger.NewZapLogger(&logger.ZapLoggerConfig{Encoding: "console", Level: "error"})
+	repo := &settingsRepository{settings: &model.MerchantSettings{PhoneCountry: "SG"}}
+	uc := NewCustomerUseCase(repo, log).(*customerUseCase)
+
+	c := validCustomer()
+	c.Phone = "9123 4567"
+	if err := uc.validateCustomer(context.Background(), c, model.CustomerFields); err != nil {
+		t.Fatalf("validateCustomer: %v", err)
+	}
+	if c.PhoneE164 == nil || *c.PhoneE164 != "+6591234567" {
+		t.Errorf("PhoneE164 = %v, want +6591234567", c.PhoneE164)
+	}
+}
+
+func TestParseUpdateMask(t *testing.T) {
+	birthday := time.Date(1990, time.May, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		paths   []string
+		input   *model.Customer
+		want    []model.CustomerField
+		wantErr []string
+	}{
+		{
+			name:  "named fields",
+			paths: []string{"email", "name"},
+			input: &model.Customer{},
+			want:  []model.CustomerField{model.CustomerFieldEmail, model.CustomerFieldName},
+		},
+		{
+			name:  "duplicates",
+			paths: []string{"tags", "tags"},
+			input: &model.Customer{},
+			want:  []model.CustomerField{model.CustomerFieldTags},
+		},
+		{
+			name:    "unknown paths",
+			paths:   []string{"name", "loyalty_points", "id"},
+			input:   &model.Customer{},
+			wantErr: []string{"update_mask.paths[1]", "update_mask.paths[2]"},
+		},
+		{
+			name:  "no mask takes the set fields",
+			input: &model.Customer{Name: "Ann", Tags: []string{"vip"}, Birthday: &birthday},
+			want:  []model.CustomerField{model.CustomerFieldName, model.CustomerFieldTags, model.CustomerFieldBirthday},
+		},
+		{
+			name:  "no mask with every field set",
+			input: &model.Customer{Name: "Ann", Phone: "0812", Email: "a@b.co", Address: "Jalan", Tags: []string{"vip"}, Birthday: &birthday},
+			want:  model.CustomerFields,
+		},
+		{
+			name:    "no mask and nothing set",
+			input:   &model.Customer{Tags: []string{}},
+			wantErr: []string{"update_mask"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseUpdateMask(tt.paths, tt.input)
+			if tt.wantErr != nil {
+				appErr, ok := apperror.As(err)
+				if !ok || appErr.Kind != apperror.KindInvalidArgument {
+					t.Fatalf("got %v, want InvalidArgument", err)
+				}
+				var fields []string
+				for _, v := range appErr.Violations {
+					fields = append(fields, v.Field)
+				}
+				if strings.Join(fields, ",") != strings.Join(tt.wantErr, ",") {
+					t.Errorf("violations on %v, want %v", fields, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// updateRepository stores a single customer for UpdateCustomer.
+type updateRepository struct {
+	settingsRepository
+	customer *model.Customer
+	fields   []model.CustomerField
+}
+
+func (r *updateRepository) GetByID(_ context.Context, merchantID, id uuid.UUID) (*model.Customer, error) {
+	if r.customer.MerchantID != merchantID || r.customer.ID != id {
+		return nil, nil
+	}
+	copied := *r.customer
+	return &copied, nil
+}
+
+func (r *updateRepository) Update(_ context.Context, c *model.Customer, fields []model.CustomerField) error {
+	r.customer, r.fields = c, fields
+	return nil
+}
+
+func (r *updateRepository) ListCustomerStats(context.Context, uuid.UUID, []uuid.UUID) ([]*model.CustomerStats, error) {
+	return nil, nil
+}
+
+func (r *updateRepository) ListCustomerTags(context.Context, []uuid.UUID) (map[uuid.UUID][]string, error) {
+	return nil, nil
+}
+
+// TestUpdateCustomerWithoutMask checks that an update without a mask leaves
+// the fields it does not set as stored instead of clearing them.
+func TestUpdateCustomerWithoutMask(t *testing.T) {
+	stored := validCustomer()
+	stored.ID, stored.MerchantID = uuid.New(), uuid.New()
+	repo := &updateRepository{customer: stored}
+	log := logger.NewZapLogger(&logger.ZapLoggerConfig{Encoding: "console", Level: "error"})
+	uc := NewCustomerUseCase(repo, log)
+
+	res, err := uc.UpdateCustomer(context.Background(), &model.Customer{
+		ID:         stored.ID,
+		MerchantID: stored.MerchantID,
+		Name:       "Ann Lim",
+	}, nil)
+	if err != nil {
+		t.Fatalf("UpdateCustomer: %v", err)
+	}
+	if res.Name != "Ann Lim" {
+		t.Errorf("name = %q, want Ann Lim", res.Name)
+	}
+	if res.Phone != stored.Phone || res.Email != stored.Email || res.Address != stored.Address || res.Birthday == nil {
+		t.Errorf("unset fields changed: %+v", res)
+	}
+	if len(repo.fields) != 1 || repo.fields[0] != model.CustomerFieldName {
+		t.Errorf("repository updated %v, want [name]", repo.fields)
+	}
+
+	_, err = uc.UpdateCustomer(context.Background(), &model.Customer{ID: stored.ID, MerchantID: stored.MerchantID}, nil)
+	if appErr, ok := apperror.As(err); !ok || appErr.Kind != apperror.KindInvalidArgument {
+		t.Errorf("empty update without a mask: got %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,114 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fekuna/omnipos-pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Manager runs background components and shuts them down in order: it
+// cancels their shared context, waits for them to return, then runs the
+// registered closers. Components that are still running at the deadline
+// have their Drain context cancelled, and closers only run once they have
+// returned.
+type Manager struct {
+	logger  logger.ZapLogger
+	timeout time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	drain      context.Context
+	abortDrain context.CancelFunc
+
+	mu      sync.Mutex
+	closers []closer
+}
+
+type closer struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func NewManager(logger logger.ZapLogger, timeout time.Duration) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	drain, abortDrain := context.WithCancel(context.Background())
+	return &Manager{
+		logger:     logger,
+		timeout:    timeout,
+		ctx:        ctx,
+		cancel:     cancel,
+		drain:      drain,
+		abortDrain: abortDrain,
+	}
+}
+
+// Drain returns a context for finishing in-flight work after a component's
+// own context is done. It is cancelled once the shutdown deadline passes.
+func (m *Manager) Drain() context.Context {
+	return m.drain
+}
+
+// Go runs fn in a goroutine. fn must return once its context is done.
+func (m *Manager) Go(name string, fn func(ctx context.Context)) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		fn(m.ctx)
+		m.logger.Info("Component stopped", zap.String("component", name))
+	}()
+}
+
+// OnShutdown registers fn to run after every component started with Go has
+// returned. Closers run in registration order.
+func (m *Manager) OnShutdown(name string, fn func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closers = append(m.closers, closer{name: name, fn: fn})
+}
+
+// Shutdown stops all components and runs the closers. Components that miss
+// the deadline are cut short through Drain, and the closers wait for them to
+// return, so nothing is closed while still in use.
+func (m *Manager) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+	defer m.abortDrain()
+
+	m.cancel()
+
+	var errs []error
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		m.logger.Warn("Components did not stop before the shutdown deadline, aborting in-flight work", zap.Duration("timeout", m.timeout))
+		errs = append(errs, fmt.Errorf("wait for components: %w", ctx.Err()))
+		m.abortDrain()
+		<-done
+	}
+
+	m.mu.Lock()
+	closers := m.closers
+	m.mu.Unlock()
+
+	for _, c := range closers {
+		if err := c.fn(ctx); err != nil {
+			m.logger.Error("Failed to close component", zap.String("component", c.name), zap.Error(err))
+			errs = append(errs, fmt.Errorf("close %s: %w", c.name, err))
+			continue
+		}
+		m.logger.Info("Component closed", zap.String("component", c.name))
+	}
+	return errors.Join(errs...)
+}
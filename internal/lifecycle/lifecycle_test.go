@@ -0,0 +1,60 @@
+package lifecycle
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fekuna/omnipos-pkg/logger"
+)
+
+// TestShutdownAbortsDrainAtDeadline runs a component that keeps working
+// after its context is done, and checks that Drain is cancelled at the
+// deadline and that closers only run once the component has returned.
+func TestShutdownAbortsDrainAtDeadline(t *testing.T) {
+	log := logger.NewZapLogger(&logger.ZapLoggerConfig{Encoding: "console", Level: "error"})
+	m := NewManager(log, 50*time.Millisecond)
+
+	var returned atomic.Bool
+	m.Go("worker", func(ctx context.Context) {
+		<-ctx.Done()
+		// Finishing in-flight work, which only the deadline interrupts.
+		<-m.Drain().Done()
+		time.Sleep(10 * time.Millisecond)
+		returned.Store(true)
+	})
+	var closedAfterReturn bool
+	m.OnShutdown("resource", func(context.Context) error {
+		closedAfterReturn = returned.Load()
+		return nil
+	})
+
+	start := time.Now()
+	if err := m.Shutdown(); err == nil {
+		t.Error("Shutdown reported a clean stop past the deadline")
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Shutdown returned after %v, before the deadline", elapsed)
+	}
+	if !closedAfterReturn {
+		t.Error("closer ran while the component was still running")
+	}
+}
+
+func TestShutdownKeepsDrainUntilComponentsReturn(t *testing.T) {
+	log := logger.NewZapLogger(&logger.ZapLoggerConfig{Encoding: "console", Level: "error"})
+	m := NewManager(log, time.Minute)
+
+	var drainErr error
+	m.Go("worker", func(ctx context.Context) {
+		<-ctx.Done()
+		drainErr = m.Drain().Err()
+	})
+	if err := m.Shutdown(); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if drainErr != nil {
+		t.Errorf("Drain cancelled during a shutdown within the deadline: %v", drainErr)
+	}
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+
+	"github.com/fekuna/omnipos-customer-service/internal/apperror"
+	"github.com/fekuna/omnipos-pkg/logger"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorInterceptor translates domain errors returned by handlers into gRPC statuses
+type ErrorInterceptor struct {
+	logger logger.ZapLogger
+}
+
+// NewErrorInterceptor creates a new error mapping interceptor
+func NewErrorInterceptor(log logger.ZapLogger) *ErrorInterceptor {
+	return &ErrorInterceptor{
+		logger: log,
+	}
+}
+
+// Unary returns a server interceptor that maps handler errors to status codes
+func (i *ErrorInterceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return nil, i.toStatus(info.FullMethod, err)
+		}
+		return resp, nil
+	}
+}
+
+func (i *ErrorInterceptor) toStatus(method string, err error) error {
+	// Handlers may already return a status (e.g. Unauthenticated).
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	if appErr, ok := apperror.As(err); ok {
+		return ToStatus(appErr).Err()
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+
+	i.logger.Error("unhandled error", zap.String("method", method), zap.Error(err))
+	return status.Error(codes.Internal, "internal error")
+}
+
+// ToStatus converts a domain error into a gRPC status with error details
+func ToStatus(appErr *apperror.Error) *status.Status {
+	st := status.New(kindToCode(appErr.Kind), appErr.Message)
+	if len(appErr.Violations) == 0 {
+		return st
+	}
+
+	switch appErr.Kind {
+	case apperror.KindFailedPrecondition:
+		pf := &errdetails.PreconditionFailure{}
+		for _, v := range appErr.Violations {
+			pf.Violations = append(pf.Violations, &errdetails.PreconditionFailure_Violation{
+				Type:        "STATE",
+				Subject:     v.Field,
+				Description: v.Description,
+			})
+		}
+		if withDetails, err := st.WithDetails(pf); err == nil {
+			return withDetails
+		}
+	default:
+		br := &errdetails.BadRequest{}
+		for _, v := range appErr.Violations {
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       v.Field,
+				Description: v.Description,
+			})
+		}
+		if withDetails, err := st.WithDetails(br); err == nil {
+			return withDetails
+		}
+	}
+	return st
+}
+
+func kindToCode(kind apperror.Kind) codes.Code {
+	switch kind {
+	case apperror.KindNotFound:
+		return codes.NotFound
+	case apperror.KindInvalidArgument:
+		return codes.InvalidArgument
+	case apperror.KindAlreadyExists:
+		return codes.AlreadyExists
+	case apperror.KindFailedPrecondition:
+		return codes.FailedPrecondition
+	default:
+		return codes.Unknown
+	}
+}
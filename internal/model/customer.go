@@ -7,13 +7,51 @@ import (
 )
 
 type Customer struct {
-	ID            uuid.UUID `db:"id"`
-	MerchantID    uuid.UUID `db:"merchant_id"`
-	Name          string    `db:"name"`
-	Phone         string    `db:"phone"`
-	Email         string    `db:"email"`
-	Address       string    `db:"address"`
-	LoyaltyPoints int32     `db:"loyalty_points"`
-	CreatedAt     time.Time `db:"created_at"`
-	UpdatedAt     time.Time `db:"updated_at"`
+	ID              uuid.UUID  `db:"id"`
+	MerchantID      uuid.UUID  `db:"merchant_id"`
+	Name            string     `db:"name"`
+	Phone           string     `db:"phone"` // as entered, for display
+	PhoneE164       *string    `db:"phone_e164"`
+	Email           string     `db:"email"`
+	Address         string     `db:"address"`
+	Birthday        *time.Time `db:"birthday"`
+	LoyaltyPoints   int32      `db:"loyalty_points"`
+	TierID          *uuid.UUID `db:"tier_id"`
+	TierEvaluatedAt *time.Time `db:"tier_evaluated_at"`
+	CreatedAt       time.Time  `db:"created_at"`
+	UpdatedAt       time.Time  `db:"updated_at"`
+	DeletedAt       *time.Time `db:"deleted_at"`
+
+	// Tags are stored in customer_tags and loaded separately.
+	Tags []string `db:"-"`
+	// Stats is loaded separately and may be nil for customers without orders.
+	Stats *CustomerStats `db:"-"`
+}
+
+// CustomerField is a customer field UpdateCustomer can change on its own.
+type CustomerField string
+
+const (
+	CustomerFieldName     CustomerField = "name"
+	CustomerFieldPhone    CustomerField = "phone"
+	CustomerFieldEmail    CustomerField = "email"
+	CustomerFieldAddress  CustomerField = "address"
+	CustomerFieldTags     CustomerField = "tags"
+	CustomerFieldBirthday CustomerField = "birthday"
+)
+
+// CustomerFields lists every updatable field.
+var CustomerFields = []CustomerField{
+	CustomerFieldName, CustomerFieldPhone, CustomerFieldEmail,
+	CustomerFieldAddress, CustomerFieldTags, CustomerFieldBirthday,
+}
+
+// Valid reports whether f is an updatable field.
+func (f CustomerField) Valid() bool {
+	for _, known := range CustomerFields {
+		if f == known {
+			return true
+		}
+	}
+	return false
 }
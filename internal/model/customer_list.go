@@ -0,0 +1,79 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CustomerSortKey is a column customers can be listed by.
+type CustomerSortKey string
+
+const (
+	SortByCreatedAt         CustomerSortKey = "created_at"
+	SortByName              CustomerSortKey = "name"
+	SortByLifetimeSpend     CustomerSortKey = "lifetime_spend"
+	SortByOrderCount        CustomerSortKey = "order_count"
+	SortByAverageOrderValue CustomerSortKey = "average_order_value"
+	SortByLastPurchaseAt    CustomerSortKey = "last_purchase_at"
+	SortByLoyaltyPoints     CustomerSortKey = "loyalty_points"
+	// SortByRelevance ranks search matches, best first. It requires a search.
+	SortByRelevance CustomerSortKey = "relevance"
+)
+
+// Valid reports whether k is a known sort key.
+func (k CustomerSortKey) Valid() bool {
+	switch k {
+	case SortByCreatedAt, SortByName, SortByLifetimeSpend, SortByOrderCount, SortByAverageOrderValue, SortByLastPurchaseAt, SortByLoyaltyPoints, SortByRelevance:
+		return true
+	}
+	return false
+}
+
+// CustomerListOptions narrows and orders ListCustomers. Nil filters are not
+// applied; spend filters are in minor units.
+type CustomerListOptions struct {
+	PageSize int
+	// Cursor resumes after the previous page's NextCursor. It must be used
+	// with the same sort.
+	Cursor string
+	// Page selects 1-based offset paging instead of Cursor. Offset pages can
+	// skip or repeat customers added while paging.
+	Page int
+	// IncludeTotal counts every matching customer, which is slow for large
+	// merchants.
+	IncludeTotal bool
+
+	Search     string
+	SortBy     CustomerSortKey
+	Descending bool
+
+	// Date ranges are half-open: [after, before).
+	CreatedAfter     *time.Time
+	CreatedBefore    *time.Time
+	UpdatedAfter     *time.Time
+	UpdatedBefore    *time.Time
+	MinLoyaltyPoints *int32
+	MaxLoyaltyPoints *int32
+	TierID           *uuid.UUID
+	// Tags restricts the list to customers with every tag.
+	Tags []string
+	// SegmentID restricts the list to members of a segment.
+	SegmentID *uuid.UUID
+	HasEmail  *bool
+	// BirthdayMonth is 1 to 12.
+	BirthdayMonth      *int
+	MinLifetimeSpend   *int64
+	MinOrderCount      *int32
+	LastPurchaseAfter  *time.Time
+	LastPurchaseBefore *time.Time
+}
+
+// CustomerPage is one page of ListCustomers.
+type CustomerPage struct {
+	Customers []*Customer
+	// NextCursor is empty on the last page.
+	NextCursor string
+	// Total is nil unless IncludeTotal was set.
+	Total *int
+}
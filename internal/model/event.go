@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// ProcessedEvent marks an inbound event whose side effects have been
+// committed, so redeliveries can be skipped.
+type ProcessedEvent struct {
+	EventID     string    `db:"event_id"`
+	EventType   string    `db:"event_type"`
+	ProcessedAt time.Time `db:"processed_at"`
+}
@@ -0,0 +1,125 @@
+package model
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type LoyaltyTransactionType string
+
+const (
+	LoyaltyTransactionEarn   LoyaltyTransactionType = "earn"
+	LoyaltyTransactionRedeem LoyaltyTransactionType = "redeem"
+	LoyaltyTransactionAdjust LoyaltyTransactionType = "adjust"
+	LoyaltyTransactionExpire LoyaltyTransactionType = "expire"
+	// LoyaltyTransactionReverse claws back points earned by a cancelled or
+	// refunded order. It may take the balance below zero.
+	LoyaltyTransactionReverse LoyaltyTransactionType = "reverse"
+)
+
+// LoyaltyTransaction is an immutable ledger entry. Customer.LoyaltyPoints is
+// the running sum of Delta over a customer's entries.
+type LoyaltyTransaction struct {
+	ID            uuid.UUID              `db:"id"`
+	MerchantID    uuid.UUID              `db:"merchant_id"`
+	CustomerID    uuid.UUID              `db:"customer_id"`
+	Type          LoyaltyTransactionType `db:"type"`
+	SourceOrderID *string                `db:"source_order_id"`
+	OrderAmount   *int64                 `db:"order_amount"` // minor units of OrderCurrency
+	OrderCurrency *string                `db:"order_currency"`
+	Delta         int32                  `db:"delta"`
+	BalanceAfter  int32                  `db:"balance_after"`
+	Actor         string                 `db:"actor"`
+	Reason        string                 `db:"reason"`
+	CreatedAt     time.Time              `db:"created_at"`
+}
+
+// OrderPoints summarizes the ledger entries tied to one order. Amounts are in
+// minor units; reverse entries carry the refunded amount as a negative
+// OrderAmount.
+type OrderPoints struct {
+	Earned         int32   `db:"earned"`
+	Reversed       int32   `db:"reversed"`
+	EarnedAmount   int64   `db:"earned_amount"`
+	RefundedAmount int64   `db:"refunded_amount"`
+	Currency       *string `db:"currency"`
+}
+
+// Reversal returns the points and amount to claw back for a refund of
+// refundAmount minor units, or of the whole remaining order if refundAmount
+// is nil. Points are derived from the cumulative refunded share so that a
+// series of partial refunds adding up to the order total reverses exactly
+// what was earned.
+func (o *OrderPoints) Reversal(refundAmount *int64) (int32, int64) {
+	remainingPoints := o.Earned - o.Reversed
+	remainingAmount := o.EarnedAmount - o.RefundedAmount
+	if remainingPoints <= 0 {
+		return 0, 0
+	}
+	if refundAmount == nil || o.EarnedAmount <= 0 || *refundAmount >= remainingAmount {
+		return remainingPoints, remainingAmount
+	}
+	if *refundAmount <= 0 {
+		return 0, 0
+	}
+
+	refunded := o.RefundedAmount + *refundAmount
+	share := new(big.Rat).SetFrac(
+		new(big.Int).Mul(big.NewInt(int64(o.Earned)), big.NewInt(refunded)),
+		big.NewInt(o.EarnedAmount),
+	)
+	target := int32(roundHalfAway(share).Int64())
+	points := target - o.Reversed
+	if points > remainingPoints {
+		points = remainingPoints
+	}
+	if points < 0 {
+		points = 0
+	}
+	return points, *refundAmount
+}
+
+type LoyaltyHoldStatus string
+
+const (
+	LoyaltyHoldHeld      LoyaltyHoldStatus = "held"
+	LoyaltyHoldConfirmed LoyaltyHoldStatus = "confirmed"
+	LoyaltyHoldCancelled LoyaltyHoldStatus = "cancelled"
+)
+
+// LoyaltyHold reserves points for a pending redemption, e.g. during checkout.
+// Held points are excluded from the available balance until the hold is
+// confirmed into a redeem entry, cancelled, or expires.
+type LoyaltyHold struct {
+	ID            uuid.UUID         `db:"id"`
+	MerchantID    uuid.UUID         `db:"merchant_id"`
+	CustomerID    uuid.UUID         `db:"customer_id"`
+	OrderID       *string           `db:"order_id"`
+	Points        int32             `db:"points"`
+	Status        LoyaltyHoldStatus `db:"status"`
+	TransactionID *uuid.UUID        `db:"transaction_id"`
+	ExpiresAt     time.Time         `db:"expires_at"`
+	CreatedAt     time.Time         `db:"created_at"`
+	UpdatedAt     time.Time         `db:"updated_at"`
+}
+
+// LoyaltyPointLot tracks points from one credit entry until they are spent or
+// expire. Debits consume lots oldest first.
+type LoyaltyPointLot struct {
+	ID            uuid.UUID  `db:"id"`
+	MerchantID    uuid.UUID  `db:"merchant_id"`
+	CustomerID    uuid.UUID  `db:"customer_id"`
+	TransactionID *uuid.UUID `db:"transaction_id"`
+	Earned        int32      `db:"earned"`
+	Remaining     int32      `db:"remaining"`
+	ExpiresAt     *time.Time `db:"expires_at"`
+	CreatedAt     time.Time  `db:"created_at"`
+}
+
+// PointExpiration is the number of points due to expire at one instant.
+type PointExpiration struct {
+	Points    int32     `db:"points"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
@@ -0,0 +1,106 @@
+package model
+
+import (
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RoundingMode string
+
+const (
+	RoundingFloor RoundingMode = "floor"
+	RoundingRound RoundingMode = "round"
+	RoundingCeil  RoundingMode = "ceil"
+)
+
+// ExpiryPolicy controls when earned points expire.
+type ExpiryPolicy string
+
+const (
+	ExpiryNone ExpiryPolicy = "none"
+	// ExpiryMonthsAfterEarn expires points ExpiryMonths after they were earned.
+	ExpiryMonthsAfterEarn ExpiryPolicy = "months_after_earn"
+	// ExpiryEndOfYear expires points at the end of the calendar year that
+	// contains the earn date plus ExpiryMonths, so 0 means the end of the
+	// year they were earned in and 12 the end of the following year.
+	ExpiryEndOfYear ExpiryPolicy = "end_of_year"
+)
+
+// LoyaltyProgram holds a merchant's earning rules.
+type LoyaltyProgram struct {
+	MerchantID        uuid.UUID    `db:"merchant_id"`
+	Enabled           bool         `db:"enabled"`
+	Currency          string       `db:"currency"`
+	PointsPerUnit     float64      `db:"points_per_unit"`
+	RoundingMode      RoundingMode `db:"rounding_mode"`
+	MinOrderAmount    int64        `db:"min_order_amount"`     // minor units of Currency
+	MaxPointsPerOrder int32        `db:"max_points_per_order"` // 0 means uncapped
+	TierBasis         TierBasis    `db:"tier_basis"`
+	TierWindowDays    int32        `db:"tier_window_days"`
+	ExpiryPolicy      ExpiryPolicy `db:"expiry_policy"`
+	ExpiryMonths      int32        `db:"expiry_months"`
+	CreatedAt         time.Time    `db:"created_at"`
+	UpdatedAt         time.Time    `db:"updated_at"`
+}
+
+// DefaultLoyaltyProgram is used for merchants that have not configured a
+// program: 1 point per 10 currency units, rounded down. Orders earn under it
+// in their own currency; IDR is only what is shown until one is configured.
+func DefaultLoyaltyProgram(merchantID uuid.UUID) *LoyaltyProgram {
+	return &LoyaltyProgram{
+		MerchantID:     merchantID,
+		Enabled:        true,
+		Currency:       "IDR",
+		PointsPerUnit:  0.1,
+		RoundingMode:   RoundingFloor,
+		TierBasis:      TierBasisLifetimePoints,
+		TierWindowDays: 365,
+		ExpiryPolicy:   ExpiryNone,
+		ExpiryMonths:   12,
+	}
+}
+
+// ExpiryFor returns when points earned at earnedAt expire, or nil if they
+// never do. Calendar boundaries are evaluated in UTC.
+func (p *LoyaltyProgram) ExpiryFor(earnedAt time.Time) *time.Time {
+	var expiresAt time.Time
+	switch p.ExpiryPolicy {
+	case ExpiryMonthsAfterEarn:
+		expiresAt = earnedAt.AddDate(0, int(p.ExpiryMonths), 0)
+	case ExpiryEndOfYear:
+		year := earnedAt.UTC().AddDate(0, int(p.ExpiryMonths), 0).Year()
+		expiresAt = time.Date(year+1, time.January, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return nil
+	}
+	return &expiresAt
+}
+
+// PointsFor returns the points earned for an order total, scaled by the
+// customer's tier multiplier before rounding. The calculation is exact: the
+// total is taken in minor units and the rate and multiplier as decimals.
+// Orders in another currency, below the minimum, or placed while the program
+// is disabled earn nothing.
+func (p *LoyaltyProgram) PointsFor(amount Money, multiplier float64) int32 {
+	if !p.Enabled || amount.Currency != p.Currency || amount.Amount <= 0 || amount.Amount < p.MinOrderAmount {
+		return 0
+	}
+	raw, err := amount.rat()
+	if err != nil {
+		return 0
+	}
+	raw.Mul(raw, decimalRat(p.PointsPerUnit))
+	raw.Mul(raw, decimalRat(multiplier))
+	points := roundRat(raw, p.RoundingMode)
+
+	if p.MaxPointsPerOrder > 0 && points.Cmp(big.NewInt(int64(p.MaxPointsPerOrder))) > 0 {
+		return p.MaxPointsPerOrder
+	}
+	if points.Cmp(big.NewInt(math.MaxInt32)) > 0 {
+		return math.MaxInt32
+	}
+	return int32(points.Int64())
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MerchantSettings holds per-merchant preferences that are not part of the
+// loyalty program.
+type MerchantSettings struct {
+	MerchantID uuid.UUID `db:"merchant_id"`
+	// PhoneCountry is the ISO 3166-1 alpha-2 country phone numbers without
+	// an international prefix are read in.
+	PhoneCountry string    `db:"phone_country"`
+	CreatedAt    time.Time `db:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at"`
+}
+
+// DefaultMerchantSettings is used for merchants that have not configured
+// any settings.
+func DefaultMerchantSettings(merchantID uuid.UUID) *MerchantSettings {
+	return &MerchantSettings{
+		MerchantID:   merchantID,
+		PhoneCountry: "ID",
+	}
+}
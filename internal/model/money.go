@@ -0,0 +1,121 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// Money is an exact amount in the minor units of an ISO 4217 currency, e.g.
+// 1050 USD is $10.50 and 1050 JPY is ¥1050.
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// currencyExponents lists the supported currencies and the number of minor
+// unit digits each has under ISO 4217.
+var currencyExponents = map[string]int{
+	// No minor units.
+	"CLP": 0, "ISK": 0, "JPY": 0, "KRW": 0, "PYG": 0, "UGX": 0, "VND": 0,
+	"XAF": 0, "XOF": 0,
+	// Cents.
+	"AUD": 2, "BND": 2, "CAD": 2, "CHF": 2, "CNY": 2, "EUR": 2, "GBP": 2,
+	"HKD": 2, "IDR": 2, "INR": 2, "MYR": 2, "NZD": 2, "PHP": 2, "SGD": 2,
+	"THB": 2, "TWD": 2, "USD": 2,
+	// Thousandths.
+	"BHD": 3, "JOD": 3, "KWD": 3, "OMR": 3, "TND": 3,
+}
+
+// ErrUnsupportedCurrency is returned for currency codes without a known
+// exponent.
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// CurrencyExponent returns the number of minor unit digits of currency.
+func CurrencyExponent(currency string) (int, error) {
+	exp, ok := currencyExponents[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, currency)
+	}
+	return exp, nil
+}
+
+// ParseMoney converts a decimal string in major units, such as "29.99", to
+// Money. Digits beyond the currency's precision are rounded half away from
+// zero, so a float artefact like "29.999999" becomes 3000 cents.
+func ParseMoney(decimal, currency string) (Money, error) {
+	exp, err := CurrencyExponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	r, ok := new(big.Rat).SetString(decimal)
+	if !ok {
+		return Money{}, fmt.Errorf("invalid amount %q", decimal)
+	}
+	minor := roundHalfAway(r.Mul(r, new(big.Rat).SetInt(pow10(exp))))
+	if !minor.IsInt64() {
+		return Money{}, fmt.Errorf("amount %q out of range", decimal)
+	}
+	return Money{Amount: minor.Int64(), Currency: currency}, nil
+}
+
+// Decimal returns m in major units as an exact decimal string, e.g. "10.50".
+func (m Money) Decimal() string {
+	exp, err := CurrencyExponent(m.Currency)
+	if err != nil {
+		exp = 0
+	}
+	return new(big.Rat).SetFrac(big.NewInt(m.Amount), pow10(exp)).FloatString(exp)
+}
+
+// rat returns m in major units as an exact rational.
+func (m Money) rat() (*big.Rat, error) {
+	exp, err := CurrencyExponent(m.Currency)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).SetFrac(big.NewInt(m.Amount), pow10(exp)), nil
+}
+
+// decimalRat returns the exact decimal value of a rate read from a NUMERIC
+// column. Such values have few significant digits, so the shortest float
+// representation recovers the stored decimal.
+func decimalRat(f float64) *big.Rat {
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(f, 'f', -1, 64))
+	return r
+}
+
+func pow10(exp int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil)
+}
+
+// roundRat rounds r to an integer using mode.
+func roundRat(r *big.Rat, mode RoundingMode) *big.Int {
+	switch mode {
+	case RoundingCeil:
+		q := floorRat(r)
+		if !r.IsInt() {
+			q.Add(q, big.NewInt(1))
+		}
+		return q
+	case RoundingRound:
+		return roundHalfAway(r)
+	default:
+		return floorRat(r)
+	}
+}
+
+func floorRat(r *big.Rat) *big.Int {
+	// Int.Div is Euclidean division, which floors for a positive divisor.
+	return new(big.Int).Div(r.Num(), r.Denom())
+}
+
+func roundHalfAway(r *big.Rat) *big.Int {
+	abs := new(big.Rat).Abs(r)
+	q := floorRat(abs.Add(abs, big.NewRat(1, 2)))
+	if r.Sign() < 0 {
+		q.Neg(q)
+	}
+	return q
+}
@@ -0,0 +1,125 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		decimal  string
+		currency string
+		want     int64
+		wantErr  bool
+	}{
+		// Exponent 0.
+		{decimal: "1050", currency: "JPY", want: 1050},
+		{decimal: "1050.4", currency: "JPY", want: 1050},
+		{decimal: "1050.5", currency: "JPY", want: 1051},
+		// Exponent 2.
+		{decimal: "10", currency: "USD", want: 1000},
+		{decimal: "29.99", currency: "USD", want: 2999},
+		{decimal: "29.999999", currency: "USD", want: 3000},
+		{decimal: "0.005", currency: "USD", want: 1},
+		{decimal: "-0.005", currency: "USD", want: -1},
+		{decimal: "150000.00", currency: "IDR", want: 15000000},
+		// Exponent 3.
+		{decimal: "1.234", currency: "KWD", want: 1234},
+		{decimal: "1.2345", currency: "KWD", want: 1235},
+		{decimal: "0.1", currency: "KWD", want: 100},
+		// Errors.
+		{decimal: "abc", currency: "USD", wantErr: true},
+		{decimal: "", currency: "USD", wantErr: true},
+		{decimal: "1e30", currency: "USD", wantErr: true},
+		{decimal: "10", currency: "XXX", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.decimal+" "+tt.currency, func(t *testing.T) {
+			got, err := ParseMoney(tt.decimal, tt.currency)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Amount != tt.want || got.Currency != tt.currency {
+				t.Errorf("got %+v, want {%d %s}", got, tt.want, tt.currency)
+			}
+		})
+	}
+}
+
+func TestParseMoneyUnsupportedCurrency(t *testing.T) {
+	if _, err := ParseMoney("10", "XXX"); !errors.Is(err, ErrUnsupportedCurrency) {
+		t.Errorf("got %v, want ErrUnsupportedCurrency", err)
+	}
+}
+
+func TestPointsFor(t *testing.T) {
+	usd := func(mode RoundingMode) *LoyaltyProgram {
+		return &LoyaltyProgram{Enabled: true, Currency: "USD", PointsPerUnit: 1, RoundingMode: mode}
+	}
+
+	tests := []struct {
+		name       string
+		program    *LoyaltyProgram
+		amount     Money
+		multiplier float64
+		want       int32
+	}{
+		// Rounding modes on $29.50 and $29.49.
+		{"floor half", usd(RoundingFloor), Money{2950, "USD"}, 1, 29},
+		{"round half", usd(RoundingRound), Money{2950, "USD"}, 1, 30},
+		{"ceil half", usd(RoundingCeil), Money{2950, "USD"}, 1, 30},
+		{"floor below half", usd(RoundingFloor), Money{2949, "USD"}, 1, 29},
+		{"round below half", usd(RoundingRound), Money{2949, "USD"}, 1, 29},
+		{"ceil below half", usd(RoundingCeil), Money{2949, "USD"}, 1, 30},
+		{"ceil exact", usd(RoundingCeil), Money{3000, "USD"}, 1, 30},
+
+		// A float total of 29.999999 is parsed to $30.00 before earning.
+		{"float artefact", usd(RoundingFloor), mustParseMoney(t, "29.999999", "USD"), 1, 30},
+
+		// Exponent 0: 0.1 points per yen.
+		{"JPY floor", &LoyaltyProgram{Enabled: true, Currency: "JPY", PointsPerUnit: 0.1, RoundingMode: RoundingFloor}, Money{1055, "JPY"}, 1, 105},
+		{"JPY round", &LoyaltyProgram{Enabled: true, Currency: "JPY", PointsPerUnit: 0.1, RoundingMode: RoundingRound}, Money{1055, "JPY"}, 1, 106},
+		{"JPY ceil", &LoyaltyProgram{Enabled: true, Currency: "JPY", PointsPerUnit: 0.1, RoundingMode: RoundingCeil}, Money{1051, "JPY"}, 1, 106},
+
+		// Exponent 3: 10 points per dinar on 1.234 KWD is 12.34 points.
+		{"KWD floor", &LoyaltyProgram{Enabled: true, Currency: "KWD", PointsPerUnit: 10, RoundingMode: RoundingFloor}, Money{1234, "KWD"}, 1, 12},
+		{"KWD round", &LoyaltyProgram{Enabled: true, Currency: "KWD", PointsPerUnit: 10, RoundingMode: RoundingRound}, Money{1250, "KWD"}, 1, 13},
+		{"KWD ceil", &LoyaltyProgram{Enabled: true, Currency: "KWD", PointsPerUnit: 10, RoundingMode: RoundingCeil}, Money{1201, "KWD"}, 1, 13},
+
+		// The multiplier applies before rounding: 0.1 * 1.5 * 10 is exactly 1.5.
+		{"multiplier before rounding", &LoyaltyProgram{Enabled: true, Currency: "USD", PointsPerUnit: 0.1, RoundingMode: RoundingRound}, Money{1000, "USD"}, 1.5, 2},
+		{"multiplier floor", &LoyaltyProgram{Enabled: true, Currency: "USD", PointsPerUnit: 0.1, RoundingMode: RoundingFloor}, Money{1000, "USD"}, 1.5, 1},
+
+		// Nothing is earned outside the program's rules.
+		{"disabled", &LoyaltyProgram{Currency: "USD", PointsPerUnit: 1}, Money{1000, "USD"}, 1, 0},
+		{"other currency", usd(RoundingFloor), Money{1000, "SGD"}, 1, 0},
+		{"zero total", usd(RoundingFloor), Money{0, "USD"}, 1, 0},
+		{"below minimum", &LoyaltyProgram{Enabled: true, Currency: "USD", PointsPerUnit: 1, MinOrderAmount: 1000}, Money{999, "USD"}, 1, 0},
+		{"at minimum", &LoyaltyProgram{Enabled: true, Currency: "USD", PointsPerUnit: 1, MinOrderAmount: 1000}, Money{1000, "USD"}, 1, 10},
+		{"capped", &LoyaltyProgram{Enabled: true, Currency: "USD", PointsPerUnit: 1, MaxPointsPerOrder: 50}, Money{10000, "USD"}, 1, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.program.PointsFor(tt.amount, tt.multiplier); got != tt.want {
+				t.Errorf("PointsFor(%+v, %v) = %d, want %d", tt.amount, tt.multiplier, got, tt.want)
+			}
+		})
+	}
+}
+
+func mustParseMoney(t *testing.T, decimal, currency string) Money {
+	t.Helper()
+	m, err := ParseMoney(decimal, currency)
+	if err != nil {
+		t.Fatalf("ParseMoney(%q, %q): %v", decimal, currency, err)
+	}
+	return m
+}
@@ -0,0 +1,116 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Customer domain event types published to customer.events.
+const (
+	EventCustomerCreated      = "CustomerCreated"
+	EventCustomerUpdated      = "CustomerUpdated"
+	EventCustomerDeleted      = "CustomerDeleted"
+	EventLoyaltyPointsChanged = "LoyaltyPointsChanged"
+	EventTierChanged          = "TierChanged"
+)
+
+// OutboxEvent is a domain event written in the same transaction as the change
+// it describes. The relay publishes it and then sets PublishedAt.
+type OutboxEvent struct {
+	ID          uuid.UUID  `db:"id"`
+	Seq         int64      `db:"seq"`
+	MerchantID  uuid.UUID  `db:"merchant_id"`
+	CustomerID  uuid.UUID  `db:"customer_id"`
+	EventType   string     `db:"event_type"`
+	Payload     []byte     `db:"payload"`
+	CreatedAt   time.Time  `db:"created_at"`
+	PublishedAt *time.Time `db:"published_at"`
+}
+
+// CustomerEvent is the payload of CustomerCreated and CustomerUpdated.
+type CustomerEvent struct {
+	ID            uuid.UUID  `json:"id"`
+	MerchantID    uuid.UUID  `json:"merchant_id"`
+	Name          string     `json:"name"`
+	Phone         string     `json:"phone"`
+	PhoneE164     *string    `json:"phone_e164,omitempty"`
+	Email         string     `json:"email"`
+	Address       string     `json:"address"`
+	Birthday      *time.Time `json:"birthday,omitempty"`
+	LoyaltyPoints int32      `json:"loyalty_points"`
+	TierID        *uuid.UUID `json:"tier_id,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func NewCustomerEvent(c *Customer) *CustomerEvent {
+	return &CustomerEvent{
+		ID:            c.ID,
+		MerchantID:    c.MerchantID,
+		Name:          c.Name,
+		Phone:         c.Phone,
+		PhoneE164:     c.PhoneE164,
+		Email:         c.Email,
+		Address:       c.Address,
+		Birthday:      c.Birthday,
+		LoyaltyPoints: c.LoyaltyPoints,
+		TierID:        c.TierID,
+		CreatedAt:     c.CreatedAt,
+		UpdatedAt:     c.UpdatedAt,
+	}
+}
+
+// CustomerDeletedEvent is the payload of CustomerDeleted.
+type CustomerDeletedEvent struct {
+	ID         uuid.UUID `json:"id"`
+	MerchantID uuid.UUID `json:"merchant_id"`
+	DeletedAt  time.Time `json:"deleted_at"`
+}
+
+// LoyaltyPointsChangedEvent is the payload of LoyaltyPointsChanged, emitted
+// for every ledger entry.
+type LoyaltyPointsChangedEvent struct {
+	CustomerID    uuid.UUID              `json:"customer_id"`
+	MerchantID    uuid.UUID              `json:"merchant_id"`
+	TransactionID uuid.UUID              `json:"transaction_id"`
+	Type          LoyaltyTransactionType `json:"type"`
+	SourceOrderID *string                `json:"source_order_id,omitempty"`
+	Delta         int32                  `json:"delta"`
+	BalanceAfter  int32                  `json:"balance_after"`
+	CreatedAt     time.Time              `json:"created_at"`
+}
+
+func NewLoyaltyPointsChangedEvent(t *LoyaltyTransaction) *LoyaltyPointsChangedEvent {
+	return &LoyaltyPointsChangedEvent{
+		CustomerID:    t.CustomerID,
+		MerchantID:    t.MerchantID,
+		TransactionID: t.ID,
+		Type:          t.Type,
+		SourceOrderID: t.SourceOrderID,
+		Delta:         t.Delta,
+		BalanceAfter:  t.BalanceAfter,
+		CreatedAt:     t.CreatedAt,
+	}
+}
+
+// TierChangedEvent is the payload of TierChanged. A nil tier means none.
+type TierChangedEvent struct {
+	CustomerID uuid.UUID  `json:"customer_id"`
+	MerchantID uuid.UUID  `json:"merchant_id"`
+	FromTierID *uuid.UUID `json:"from_tier_id"`
+	ToTierID   *uuid.UUID `json:"to_tier_id"`
+	Metric     float64    `json:"metric"`
+	ChangedAt  time.Time  `json:"changed_at"`
+}
+
+func NewTierChangedEvent(c *CustomerTierChange) *TierChangedEvent {
+	return &TierChangedEvent{
+		CustomerID: c.CustomerID,
+		MerchantID: c.MerchantID,
+		FromTierID: c.FromTierID,
+		ToTierID:   c.ToTierID,
+		Metric:     c.Metric,
+		ChangedAt:  c.CreatedAt,
+	}
+}
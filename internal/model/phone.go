@@ -0,0 +1,114 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// phoneCountry is how numbers are dialled within a country: its calling
+// code, the trunk prefix, if any, that national numbers start with, and the
+// range of lengths of a national number without the trunk prefix.
+type phoneCountry struct {
+	code   string
+	trunk  string
+	minNSN int
+	maxNSN int
+}
+
+// phoneCountries lists the supported ISO 3166-1 alpha-2 default countries.
+var phoneCountries = map[string]phoneCountry{
+	"AE": {"971", "0", 8, 9}, "AU": {"61", "0", 9, 9}, "CA": {"1", "", 10, 10},
+	"CN": {"86", "0", 9, 11}, "DE": {"49", "0", 6, 13}, "FR": {"33", "0", 9, 9},
+	"GB": {"44", "0", 9, 10}, "HK": {"852", "", 8, 8}, "ID": {"62", "0", 8, 12},
+	"IN": {"91", "0", 10, 10}, "JP": {"81", "0", 9, 10}, "KR": {"82", "0", 8, 10},
+	"MY": {"60", "0", 8, 10}, "NL": {"31", "0", 9, 9}, "NZ": {"64", "0", 8, 10},
+	"PH": {"63", "0", 8, 10}, "SA": {"966", "0", 8, 9}, "SG": {"65", "", 8, 8},
+	"TH": {"66", "0", 8, 9}, "TW": {"886", "0", 8, 9}, "US": {"1", "", 10, 10},
+	"VN": {"84", "0", 9, 10},
+}
+
+// prefixed reports whether digits, dialled without + or 00, already start
+// with the calling code. That is only assumed when digits are too long to be
+// a national number and what follows the code has a national length, so
+// national numbers that happen to start with the code are left alone.
+func (c phoneCountry) prefixed(digits string) bool {
+	if !strings.HasPrefix(digits, c.code) || len(digits) <= c.maxNSN {
+		return false
+	}
+	n := len(digits) - len(c.code)
+	return n >= c.minNSN && n <= c.maxNSN
+}
+
+// E.164 numbers have at most 15 digits. The lower bound only rejects
+// obvious fragments.
+const (
+	minPhoneDigits = 8
+	maxPhoneDigits = 15
+)
+
+var (
+	// ErrUnsupportedPhoneCountry is returned for default countries without a
+	// known calling code.
+	ErrUnsupportedPhoneCountry = errors.New("unsupported phone country")
+	// ErrInvalidPhone is returned for input that is not a phone number.
+	ErrInvalidPhone = errors.New("invalid phone number")
+)
+
+// ValidatePhoneCountry reports whether country can be used as a default
+// phone country.
+func ValidatePhoneCountry(country string) error {
+	if _, ok := phoneCountries[country]; !ok {
+		return fmt.Errorf("%w: %q", ErrUnsupportedPhoneCountry, country)
+	}
+	return nil
+}
+
+// NormalizePhone converts a phone number as typed to E.164, e.g.
+// "+6281234567890". Numbers starting with + or 00 are international.
+// Otherwise they are read in country: the trunk prefix is replaced by the
+// calling code, a number too long to be national that starts with the
+// calling code is taken as is, and anything else gets the calling code
+// prepended. Spaces, dashes, dots, slashes and parentheses are ignored, so
+// "0812-3456-7890", "+62 812 3456 7890" and "6281234567890" normalize alike
+// in ID, while "9123456789" in IN becomes "+919123456789".
+func NormalizePhone(raw, country string) (string, error) {
+	s := strings.TrimSpace(raw)
+	international := strings.HasPrefix(s, "+")
+	s = strings.TrimPrefix(s, "+")
+
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case strings.ContainsRune(" -.()/", r):
+		default:
+			return "", fmt.Errorf("%w: %q", ErrInvalidPhone, raw)
+		}
+	}
+	digits := b.String()
+
+	if !international && strings.HasPrefix(digits, "00") {
+		international = true
+		digits = digits[2:]
+	}
+	if !international {
+		c, ok := phoneCountries[country]
+		if !ok {
+			return "", fmt.Errorf("%w: %q", ErrUnsupportedPhoneCountry, country)
+		}
+		switch {
+		case c.trunk != "" && strings.HasPrefix(digits, c.trunk):
+			digits = c.code + digits[len(c.trunk):]
+		case c.prefixed(digits):
+		default:
+			digits = c.code + digits
+		}
+	}
+
+	if len(digits) < minPhoneDigits || len(digits) > maxPhoneDigits || digits[0] == '0' {
+		return "", fmt.Errorf("%w: %q", ErrInvalidPhone, raw)
+	}
+	return "+" + digits, nil
+}
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		raw     string
+		country string
+		want    string
+		wantErr error
+	}{
+		// Explicitly international.
+		{raw: "+62 812-3456-7890", country: "ID", want: "+6281234567890"},
+		{raw: "0062 812 3456 7890", country: "ID", want: "+6281234567890"},
+		{raw: "+65 9123 4567", country: "ID", want: "+6591234567"},
+		// Trunk prefix.
+		{raw: "0812-3456-7890", country: "ID", want: "+6281234567890"},
+		{raw: "(020) 7946 0018", country: "GB", want: "+442079460018"},
+		// National numbers that start with the calling code.
+		{raw: "9123456789", country: "IN", want: "+919123456789"},
+		{raw: "6512 3456", country: "SG", want: "+6565123456"},
+		// Calling code without + or 00, recognised by length.
+		{raw: "919123456789", country: "IN", want: "+919123456789"},
+		{raw: "6591234567", country: "SG", want: "+6591234567"},
+		{raw: "6281234567890", country: "ID", want: "+6281234567890"},
+		{raw: "15551234567", country: "US", want: "+15551234567"},
+		// National numbers without a trunk prefix.
+		{raw: "555.123.4567", country: "US", want: "+15551234567"},
+		{raw: "9123 4567", country: "SG", want: "+6591234567"},
+		// Invalid input.
+		{raw: "0812 ABC", country: "ID", wantErr: ErrInvalidPhone},
+		{raw: "+62 12", country: "ID", wantErr: ErrInvalidPhone},
+		{raw: "+1234567890123456", country: "ID", wantErr: ErrInvalidPhone},
+		{raw: "+0812345678", country: "ID", wantErr: ErrInvalidPhone},
+		{raw: "0812 3456 7890", country: "XX", wantErr: ErrUnsupportedPhoneCountry},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.country+" "+tt.raw, func(t *testing.T) {
+			got, err := NormalizePhone(tt.raw, tt.country)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %q, %v, want %v", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SegmentField is a customer attribute a segment rule can test.
+type SegmentField string
+
+const (
+	// SegmentFieldRecencyDays is whole days since the last purchase.
+	// Customers who never purchased match no recency rule.
+	SegmentFieldRecencyDays SegmentField = "recency_days"
+	// SegmentFieldFrequency is the number of orders.
+	SegmentFieldFrequency SegmentField = "frequency"
+	// SegmentFieldMonetary is lifetime spend in minor units.
+	SegmentFieldMonetary SegmentField = "monetary"
+	// SegmentFieldAverageOrderValue is in minor units.
+	SegmentFieldAverageOrderValue SegmentField = "average_order_value"
+	// SegmentFieldCustomerAgeDays is whole days since the customer was
+	// created.
+	SegmentFieldCustomerAgeDays SegmentField = "customer_age_days"
+	SegmentFieldLoyaltyPoints   SegmentField = "loyalty_points"
+	SegmentFieldTier            SegmentField = "tier_id"
+	SegmentFieldTag             SegmentField = "tag"
+)
+
+// SegmentOperator compares a field to a rule's value. Tier and tag rules only
+// support eq and neq.
+type SegmentOperator string
+
+const (
+	SegmentOpEq  SegmentOperator = "eq"
+	SegmentOpNeq SegmentOperator = "neq"
+	SegmentOpGt  SegmentOperator = "gt"
+	SegmentOpGte SegmentOperator = "gte"
+	SegmentOpLt  SegmentOperator = "lt"
+	SegmentOpLte SegmentOperator = "lte"
+)
+
+// SegmentRule is a single condition, e.g. {monetary gte 100000}. Value is an
+// integer for numeric fields, a tier ID or a tag.
+type SegmentRule struct {
+	Field    SegmentField    `json:"field"`
+	Operator SegmentOperator `json:"operator"`
+	Value    string          `json:"value"`
+}
+
+// SegmentRules is stored as a JSON array.
+type SegmentRules []SegmentRule
+
+func (r SegmentRules) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
+func (r *SegmentRules) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, r)
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	default:
+		return errors.New("unsupported segment rules type")
+	}
+}
+
+// CustomerSegment groups the customers matching all of its rules.
+// MemberCount is only filled in when listing segments.
+type CustomerSegment struct {
+	ID          uuid.UUID    `db:"id"`
+	MerchantID  uuid.UUID    `db:"merchant_id"`
+	Name        string       `db:"name"`
+	Description string       `db:"description"`
+	Rules       SegmentRules `db:"rules"`
+	MemberCount int64        `db:"member_count"`
+	EvaluatedAt *time.Time   `db:"evaluated_at"`
+	CreatedAt   time.Time    `db:"created_at"`
+	UpdatedAt   time.Time    `db:"updated_at"`
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CustomerOrder is an order attributed to a customer, as seen in order
+// events. Amounts are in minor units of Currency.
+type CustomerOrder struct {
+	MerchantID     uuid.UUID `db:"merchant_id"`
+	OrderID        string    `db:"order_id"`
+	CustomerID     uuid.UUID `db:"customer_id"`
+	StoreID        *string   `db:"store_id"`
+	TotalAmount    int64     `db:"total_amount"`
+	RefundedAmount int64     `db:"refunded_amount"`
+	Currency       string    `db:"currency"`
+	Cancelled      bool      `db:"cancelled"`
+	OrderedAt      time.Time `db:"ordered_at"`
+	// Pending orders have only been refunded so far; their OrderCreated
+	// event has not been seen. They are left out of statistics.
+	Pending bool `db:"pending"`
+	// RefundedInFull marks a pending order refunded without an amount.
+	RefundedInFull bool `db:"refunded_in_full"`
+}
+
+// CustomerStats summarizes a customer's purchases. Cancelled orders are
+// excluded, refunds reduce spend, and spend is summed in the currency of the
+// customer's first order.
+type CustomerStats struct {
+	CustomerID        uuid.UUID  `db:"customer_id"`
+	MerchantID        uuid.UUID  `db:"merchant_id"`
+	OrderCount        int32      `db:"order_count"`
+	LifetimeSpend     int64      `db:"lifetime_spend"`
+	Currency          *string    `db:"currency"`
+	AverageOrderValue int64      `db:"average_order_value"`
+	FirstPurchaseAt   *time.Time `db:"first_purchase_at"`
+	LastPurchaseAt    *time.Time `db:"last_purchase_at"`
+	// FavouriteStoreID is the store with the most orders, ties going to the
+	// most recently visited.
+	FavouriteStoreID *string   `db:"favourite_store_id"`
+	UpdatedAt        time.Time `db:"updated_at"`
+}
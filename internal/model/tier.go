@@ -0,0 +1,42 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TierBasis selects the metric tier thresholds are compared against.
+type TierBasis string
+
+const (
+	// TierBasisLifetimePoints compares thresholds to all points ever earned.
+	TierBasisLifetimePoints TierBasis = "lifetime_points"
+	// TierBasisRollingSpend compares thresholds to order spend within the
+	// program's tier window.
+	TierBasisRollingSpend TierBasis = "rolling_spend"
+)
+
+// LoyaltyTier is a merchant-defined level. A customer holds the tier with the
+// highest threshold not exceeding their metric.
+type LoyaltyTier struct {
+	ID             uuid.UUID `db:"id"`
+	MerchantID     uuid.UUID `db:"merchant_id"`
+	Name           string    `db:"name"`
+	Threshold      float64   `db:"threshold"`
+	EarnMultiplier float64   `db:"earn_multiplier"`
+	CreatedAt      time.Time `db:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at"`
+}
+
+// CustomerTierChange records a promotion or demotion. A nil tier means the
+// customer had, or now has, no tier.
+type CustomerTierChange struct {
+	ID         uuid.UUID  `db:"id"`
+	MerchantID uuid.UUID  `db:"merchant_id"`
+	CustomerID uuid.UUID  `db:"customer_id"`
+	FromTierID *uuid.UUID `db:"from_tier_id"`
+	ToTierID   *uuid.UUID `db:"to_tier_id"`
+	Metric     float64    `db:"metric"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
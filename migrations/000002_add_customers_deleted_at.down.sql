@@ -0,0 +1,7 @@
+DELETE FROM customers WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_customers_deleted_at;
+DROP INDEX IF EXISTS uq_customers_merchant_phone_active;
+ALTER TABLE customers ADD CONSTRAINT customers_merchant_id_phone_key UNIQUE (merchant_id, phone);
+
+ALTER TABLE customers DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,5 @@
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+ALTER TABLE customers DROP CONSTRAINT IF EXISTS customers_merchant_id_phone_key;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_customers_merchant_phone_active ON customers(merchant_id, phone) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_customers_deleted_at ON customers(deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS loyalty_transactions;
+
+ALTER TABLE customers ALTER COLUMN loyalty_points DROP NOT NULL;
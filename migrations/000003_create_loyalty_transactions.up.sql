@@ -0,0 +1,24 @@
+UPDATE customers SET loyalty_points = 0 WHERE loyalty_points IS NULL;
+ALTER TABLE customers ALTER COLUMN loyalty_points SET NOT NULL;
+
+CREATE TABLE IF NOT EXISTS loyalty_transactions (
+    id UUID PRIMARY KEY,
+    merchant_id UUID NOT NULL,
+    customer_id UUID NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+    type VARCHAR(16) NOT NULL CHECK (type IN ('earn', 'redeem', 'adjust', 'expire')),
+    source_order_id VARCHAR(64),
+    delta INTEGER NOT NULL,
+    balance_after INTEGER NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_loyalty_transactions_customer ON loyalty_transactions(merchant_id, customer_id, created_at DESC);
+CREATE INDEX idx_loyalty_transactions_source_order ON loyalty_transactions(merchant_id, source_order_id) WHERE source_order_id IS NOT NULL;
+
+-- Seed an opening balance so the ledger sums to the existing counters.
+INSERT INTO loyalty_transactions (id, merchant_id, customer_id, type, delta, balance_after, actor, reason, created_at)
+SELECT gen_random_uuid(), merchant_id, id, 'adjust', loyalty_points, loyalty_points, 'system', 'opening balance', NOW()
+FROM customers
+WHERE loyalty_points <> 0;
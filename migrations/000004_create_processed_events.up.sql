@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS processed_events (
+    event_id VARCHAR(128) PRIMARY KEY,
+    event_type VARCHAR(64) NOT NULL,
+    processed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
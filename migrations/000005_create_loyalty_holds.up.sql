@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS loyalty_holds (
+    id UUID PRIMARY KEY,
+    merchant_id UUID NOT NULL,
+    customer_id UUID NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+    order_id VARCHAR(64),
+    points INTEGER NOT NULL CHECK (points > 0),
+    status VARCHAR(16) NOT NULL CHECK (status IN ('held', 'confirmed', 'cancelled')),
+    transaction_id UUID REFERENCES loyalty_transactions(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_loyalty_holds_active ON loyalty_holds(customer_id, expires_at) WHERE status = 'held';
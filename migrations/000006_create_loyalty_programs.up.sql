@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS loyalty_programs (
+    merchant_id UUID PRIMARY KEY,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    currency VARCHAR(3) NOT NULL,
+    points_per_unit NUMERIC(12, 6) NOT NULL CHECK (points_per_unit >= 0),
+    rounding_mode VARCHAR(8) NOT NULL CHECK (rounding_mode IN ('floor', 'round', 'ceil')),
+    min_order_amount NUMERIC(18, 4) NOT NULL DEFAULT 0 CHECK (min_order_amount >= 0),
+    max_points_per_order INTEGER NOT NULL DEFAULT 0 CHECK (max_points_per_order >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS customer_tier_history;
+
+ALTER TABLE loyalty_transactions DROP COLUMN IF EXISTS order_amount;
+ALTER TABLE customers DROP COLUMN IF EXISTS tier_id;
+
+DROP TABLE IF EXISTS loyalty_tiers;
+
+ALTER TABLE loyalty_programs
+    DROP COLUMN IF EXISTS tier_window_days,
+    DROP COLUMN IF EXISTS tier_basis;
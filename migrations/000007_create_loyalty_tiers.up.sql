@@ -0,0 +1,33 @@
+ALTER TABLE loyalty_programs
+    ADD COLUMN IF NOT EXISTS tier_basis VARCHAR(16) NOT NULL DEFAULT 'lifetime_points' CHECK (tier_basis IN ('lifetime_points', 'rolling_spend')),
+    ADD COLUMN IF NOT EXISTS tier_window_days INTEGER NOT NULL DEFAULT 365 CHECK (tier_window_days > 0);
+
+CREATE TABLE IF NOT EXISTS loyalty_tiers (
+    id UUID PRIMARY KEY,
+    merchant_id UUID NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    threshold NUMERIC(18, 4) NOT NULL CHECK (threshold >= 0),
+    earn_multiplier NUMERIC(6, 3) NOT NULL DEFAULT 1 CHECK (earn_multiplier >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE(merchant_id, name)
+);
+
+CREATE INDEX idx_loyalty_tiers_merchant_threshold ON loyalty_tiers(merchant_id, threshold DESC);
+
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS tier_id UUID REFERENCES loyalty_tiers(id) ON DELETE SET NULL;
+
+-- Order totals let tiers be based on spend over a rolling window.
+ALTER TABLE loyalty_transactions ADD COLUMN IF NOT EXISTS order_amount NUMERIC(18, 4);
+
+CREATE TABLE IF NOT EXISTS customer_tier_history (
+    id UUID PRIMARY KEY,
+    merchant_id UUID NOT NULL,
+    customer_id UUID NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+    from_tier_id UUID,
+    to_tier_id UUID,
+    metric NUMERIC(18, 4) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_customer_tier_history_customer ON customer_tier_history(merchant_id, customer_id, created_at DESC);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS loyalty_point_lots;
+
+ALTER TABLE loyalty_programs
+    DROP COLUMN IF EXISTS expiry_months,
+    DROP COLUMN IF EXISTS expiry_policy;
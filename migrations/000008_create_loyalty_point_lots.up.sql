@@ -0,0 +1,23 @@
+ALTER TABLE loyalty_programs
+    ADD COLUMN IF NOT EXISTS expiry_policy VARCHAR(24) NOT NULL DEFAULT 'none' CHECK (expiry_policy IN ('none', 'months_after_earn', 'end_of_year')),
+    ADD COLUMN IF NOT EXISTS expiry_months INTEGER NOT NULL DEFAULT 12 CHECK (expiry_months >= 0);
+
+CREATE TABLE IF NOT EXISTS loyalty_point_lots (
+    id UUID PRIMARY KEY,
+    merchant_id UUID NOT NULL,
+    customer_id UUID NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+    transaction_id UUID REFERENCES loyalty_transactions(id) ON DELETE SET NULL,
+    earned INTEGER NOT NULL CHECK (earned > 0),
+    remaining INTEGER NOT NULL CHECK (remaining >= 0 AND remaining <= earned),
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_loyalty_point_lots_open ON loyalty_point_lots(customer_id, created_at) WHERE remaining > 0;
+CREATE INDEX idx_loyalty_point_lots_due ON loyalty_point_lots(expires_at) WHERE remaining > 0 AND expires_at IS NOT NULL;
+
+-- Existing balances become a single lot that never expires.
+INSERT INTO loyalty_point_lots (id, merchant_id, customer_id, earned, remaining, expires_at, created_at)
+SELECT gen_random_uuid(), merchant_id, id, loyalty_points, loyalty_points, NULL, NOW()
+FROM customers
+WHERE loyalty_points > 0;
@@ -0,0 +1,5 @@
+UPDATE loyalty_transactions SET type = 'adjust' WHERE type = 'reverse';
+
+ALTER TABLE loyalty_transactions DROP CONSTRAINT IF EXISTS loyalty_transactions_type_check;
+ALTER TABLE loyalty_transactions ADD CONSTRAINT loyalty_transactions_type_check
+    CHECK (type IN ('earn', 'redeem', 'adjust', 'expire'));
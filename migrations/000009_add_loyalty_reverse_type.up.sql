@@ -0,0 +1,3 @@
+ALTER TABLE loyalty_transactions DROP CONSTRAINT IF EXISTS loyalty_transactions_type_check;
+ALTER TABLE loyalty_transactions ADD CONSTRAINT loyalty_transactions_type_check
+    CHECK (type IN ('earn', 'redeem', 'adjust', 'expire', 'reverse'));
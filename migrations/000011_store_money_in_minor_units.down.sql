@@ -0,0 +1,17 @@
+CREATE FUNCTION pg_temp.currency_exponent(code TEXT) RETURNS INTEGER AS $$
+    SELECT CASE
+        WHEN code IN ('CLP', 'ISK', 'JPY', 'KRW', 'PYG', 'UGX', 'VND', 'XAF', 'XOF') THEN 0
+        WHEN code IN ('BHD', 'JOD', 'KWD', 'OMR', 'TND') THEN 3
+        ELSE 2
+    END
+$$ LANGUAGE sql IMMUTABLE;
+
+ALTER TABLE loyalty_programs
+    ALTER COLUMN min_order_amount TYPE NUMERIC(18, 4)
+    USING min_order_amount / 10::NUMERIC ^ pg_temp.currency_exponent(currency);
+
+ALTER TABLE loyalty_transactions
+    ALTER COLUMN order_amount TYPE NUMERIC(18, 4)
+    USING order_amount / 10::NUMERIC ^ pg_temp.currency_exponent(COALESCE(order_currency, 'IDR'));
+
+ALTER TABLE loyalty_transactions DROP COLUMN IF EXISTS order_currency;
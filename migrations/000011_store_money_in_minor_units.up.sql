@@ -0,0 +1,24 @@
+-- Exponents of the currencies the service supports (ISO 4217). Anything not
+-- listed has two decimal places.
+CREATE FUNCTION pg_temp.currency_exponent(code TEXT) RETURNS INTEGER AS $$
+    SELECT CASE
+        WHEN code IN ('CLP', 'ISK', 'JPY', 'KRW', 'PYG', 'UGX', 'VND', 'XAF', 'XOF') THEN 0
+        WHEN code IN ('BHD', 'JOD', 'KWD', 'OMR', 'TND') THEN 3
+        ELSE 2
+    END
+$$ LANGUAGE sql IMMUTABLE;
+
+-- Order amounts were stored in major units of the merchant's currency.
+ALTER TABLE loyalty_transactions ADD COLUMN IF NOT EXISTS order_currency VARCHAR(3);
+
+UPDATE loyalty_transactions t
+SET order_currency = COALESCE((SELECT p.currency FROM loyalty_programs p WHERE p.merchant_id = t.merchant_id), 'IDR')
+WHERE order_amount IS NOT NULL;
+
+ALTER TABLE loyalty_transactions
+    ALTER COLUMN order_amount TYPE BIGINT
+    USING ROUND(order_amount * 10::NUMERIC ^ pg_temp.currency_exponent(order_currency))::BIGINT;
+
+ALTER TABLE loyalty_programs
+    ALTER COLUMN min_order_amount TYPE BIGINT
+    USING ROUND(min_order_amount * 10::NUMERIC ^ pg_temp.currency_exponent(currency))::BIGINT;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS customer_stats;
+DROP TABLE IF EXISTS customer_orders;
@@ -0,0 +1,34 @@
+-- One row per order attributed to a customer, kept so statistics can be
+-- recomputed exactly as orders are refunded or cancelled.
+CREATE TABLE IF NOT EXISTS customer_orders (
+    merchant_id UUID NOT NULL,
+    order_id VARCHAR(64) NOT NULL,
+    customer_id UUID NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+    store_id VARCHAR(64),
+    total_amount BIGINT NOT NULL CHECK (total_amount >= 0),
+    refunded_amount BIGINT NOT NULL DEFAULT 0 CHECK (refunded_amount >= 0 AND refunded_amount <= total_amount),
+    currency VARCHAR(3) NOT NULL,
+    cancelled BOOLEAN NOT NULL DEFAULT FALSE,
+    ordered_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (merchant_id, order_id)
+);
+
+CREATE INDEX idx_customer_orders_customer ON customer_orders(customer_id, ordered_at);
+
+CREATE TABLE IF NOT EXISTS customer_stats (
+    customer_id UUID PRIMARY KEY REFERENCES customers(id) ON DELETE CASCADE,
+    merchant_id UUID NOT NULL,
+    order_count INTEGER NOT NULL DEFAULT 0,
+    lifetime_spend BIGINT NOT NULL DEFAULT 0,
+    currency VARCHAR(3),
+    average_order_value BIGINT GENERATED ALWAYS AS (
+        CASE WHEN order_count > 0 THEN lifetime_spend / order_count ELSE 0 END
+    ) STORED,
+    first_purchase_at TIMESTAMPTZ,
+    last_purchase_at TIMESTAMPTZ,
+    favourite_store_id VARCHAR(64),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_customer_stats_merchant_spend ON customer_stats(merchant_id, lifetime_spend DESC);
+CREATE INDEX idx_customer_stats_merchant_last_purchase ON customer_stats(merchant_id, last_purchase_at DESC);
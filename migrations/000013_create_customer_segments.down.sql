@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS customer_segment_members;
+DROP TABLE IF EXISTS customer_segments;
+DROP TABLE IF EXISTS customer_tags;
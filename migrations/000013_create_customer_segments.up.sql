@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS customer_tags (
+    customer_id UUID NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+    merchant_id UUID NOT NULL,
+    tag VARCHAR(64) NOT NULL,
+    PRIMARY KEY (customer_id, tag)
+);
+
+CREATE INDEX idx_customer_tags_merchant_tag ON customer_tags(merchant_id, tag);
+
+-- A segment is a merchant-defined set of rules, all of which a member must
+-- match. Membership is materialized so it can be listed and filtered on.
+CREATE TABLE IF NOT EXISTS customer_segments (
+    id UUID PRIMARY KEY,
+    merchant_id UUID NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    rules JSONB NOT NULL,
+    evaluated_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (merchant_id, name)
+);
+
+CREATE INDEX idx_customer_segments_evaluated_at ON customer_segments(evaluated_at NULLS FIRST);
+
+CREATE TABLE IF NOT EXISTS customer_segment_members (
+    segment_id UUID NOT NULL REFERENCES customer_segments(id) ON DELETE CASCADE,
+    customer_id UUID NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+    joined_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (segment_id, customer_id)
+);
+
+CREATE INDEX idx_customer_segment_members_customer ON customer_segment_members(customer_id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_customers_phone_digits_trgm;
+DROP INDEX IF EXISTS idx_customers_email_trgm;
+DROP INDEX IF EXISTS idx_customers_name_trgm;
+DROP INDEX IF EXISTS idx_customers_search_document;
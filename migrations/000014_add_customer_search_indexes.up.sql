@@ -0,0 +1,11 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Expression indexes rather than generated columns, so the customers row
+-- shape is unchanged. The expressions must match those in the repository's
+-- search query exactly for the planner to use them.
+CREATE INDEX IF NOT EXISTS idx_customers_search_document ON customers
+    USING GIN (to_tsvector('simple', name || ' ' || COALESCE(email, '') || ' ' || COALESCE(address, '')));
+
+CREATE INDEX IF NOT EXISTS idx_customers_name_trgm ON customers USING GIN (lower(name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_customers_email_trgm ON customers USING GIN (lower(COALESCE(email, '')) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_customers_phone_digits_trgm ON customers USING GIN (regexp_replace(phone, '\D', '', 'g') gin_trgm_ops);
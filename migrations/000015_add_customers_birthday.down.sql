@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_customers_merchant_created_at;
+DROP INDEX IF EXISTS idx_customers_birthday_month;
+ALTER TABLE customers DROP COLUMN IF EXISTS birthday;
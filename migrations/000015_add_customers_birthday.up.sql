@@ -0,0 +1,4 @@
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS birthday DATE;
+
+CREATE INDEX IF NOT EXISTS idx_customers_birthday_month ON customers(merchant_id, (EXTRACT(MONTH FROM birthday))) WHERE birthday IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_customers_merchant_created_at ON customers(merchant_id, created_at DESC, id DESC) WHERE deleted_at IS NULL;
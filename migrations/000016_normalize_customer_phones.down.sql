@@ -0,0 +1,5 @@
+CREATE UNIQUE INDEX IF NOT EXISTS uq_customers_merchant_phone_active ON customers(merchant_id, phone) WHERE deleted_at IS NULL;
+DROP INDEX IF EXISTS uq_customers_merchant_phone_e164_active;
+DROP INDEX IF EXISTS idx_customers_merchant_phone_e164;
+ALTER TABLE customers DROP COLUMN IF EXISTS phone_e164;
+DROP TABLE IF EXISTS merchant_settings;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS merchant_settings (
+    merchant_id UUID PRIMARY KEY,
+    phone_country CHAR(2) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- phone keeps the number as entered for display; phone_e164 is what lookups
+-- and uniqueness use. Existing rows are filled in by cmd/phone-normalize, and
+-- migration 000019 replaces the unique index on the raw phone once no
+-- normalized duplicates remain.
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS phone_e164 VARCHAR(16);
+
+CREATE INDEX IF NOT EXISTS idx_customers_merchant_phone_e164 ON customers(merchant_id, phone_e164) WHERE deleted_at IS NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_customers_tier_evaluated_at;
+ALTER TABLE customers DROP COLUMN IF EXISTS tier_evaluated_at;
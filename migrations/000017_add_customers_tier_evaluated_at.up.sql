@@ -0,0 +1,7 @@
+-- tier_evaluated_at is when the customer's tier was last checked. Ledger
+-- entries refresh it; tier and program changes clear it for the merchant.
+-- The tier refresher re-evaluates customers without one, and those on
+-- rolling-spend tiers once it is too old, so lapsed customers are demoted.
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS tier_evaluated_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_customers_tier_evaluated_at ON customers(tier_evaluated_at NULLS FIRST) WHERE deleted_at IS NULL;
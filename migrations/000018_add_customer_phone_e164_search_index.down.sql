@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_customers_phone_e164_trgm;
@@ -0,0 +1,4 @@
+-- Phone search also matches the E.164 form, so numbers entered with a trunk
+-- prefix are found by their international digits. The expression must match
+-- the repository's search query exactly.
+CREATE INDEX IF NOT EXISTS idx_customers_phone_e164_trgm ON customers USING GIN (COALESCE(phone_e164, '') gin_trgm_ops);
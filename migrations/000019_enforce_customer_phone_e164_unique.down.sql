@@ -0,0 +1,2 @@
+CREATE UNIQUE INDEX IF NOT EXISTS uq_customers_merchant_phone_active ON customers(merchant_id, phone) WHERE deleted_at IS NULL;
+DROP INDEX IF EXISTS uq_customers_merchant_phone_e164_active;
@@ -0,0 +1,22 @@
+-- Phone uniqueness moves from the phone as entered to phone_e164. Run
+-- cmd/phone-normalize first: it backfills phone_e164, reports customers that
+-- share a number, and with -enforce builds this index without blocking
+-- writes, which leaves nothing for this migration to do. Otherwise the index
+-- is built here under a write lock, and the migration fails while live
+-- customers still share a number.
+
+-- An interrupted concurrent build leaves an invalid index behind that
+-- IF NOT EXISTS would accept.
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM pg_index
+        WHERE indexrelid = to_regclass('uq_customers_merchant_phone_e164_active') AND NOT indisvalid
+    ) THEN
+        DROP INDEX uq_customers_merchant_phone_e164_active;
+    END IF;
+END $$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_customers_merchant_phone_e164_active ON customers(merchant_id, phone_e164) WHERE deleted_at IS NULL;
+
+DROP INDEX IF EXISTS uq_customers_merchant_phone_active;
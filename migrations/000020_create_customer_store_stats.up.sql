@@ -0,0 +1,16 @@
+-- Live order counts per customer and store, so the favourite store can be
+-- kept current as orders arrive without counting the customer's orders again.
+CREATE TABLE IF NOT EXISTS customer_store_stats (
+    customer_id UUID NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+    store_id VARCHAR(64) NOT NULL,
+    order_count INTEGER NOT NULL CHECK (order_count >= 0),
+    last_ordered_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (customer_id, store_id)
+);
+
+INSERT INTO customer_store_stats (customer_id, store_id, order_count, last_ordered_at)
+SELECT customer_id, store_id, COUNT(*), MAX(ordered_at)
+FROM customer_orders
+WHERE store_id IS NOT NULL AND NOT cancelled
+GROUP BY customer_id, store_id
+ON CONFLICT DO NOTHING;
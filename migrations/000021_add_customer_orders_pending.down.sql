@@ -0,0 +1,3 @@
+DELETE FROM customer_orders WHERE pending;
+ALTER TABLE customer_orders DROP COLUMN IF EXISTS refunded_in_full;
+ALTER TABLE customer_orders DROP COLUMN IF EXISTS pending;
@@ -0,0 +1,6 @@
+-- A refund can arrive before its order. It is then kept on a pending row,
+-- which statistics ignore until OrderCreated fills in the order, so the order
+-- is never counted at its full value. refunded_in_full marks a pending row
+-- refunded without an amount, whose currency is not known yet.
+ALTER TABLE customer_orders ADD COLUMN IF NOT EXISTS pending BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE customer_orders ADD COLUMN IF NOT EXISTS refunded_in_full BOOLEAN NOT NULL DEFAULT FALSE;